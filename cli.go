@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+)
+
+// runSubcommand は `nebula <command>` 形式のサブコマンドを実行し、終了コードを返す
+func runSubcommand(args []string) int {
+	switch args[0] {
+	case "usage":
+		return runUsageCommand(args[1:])
+	case "history":
+		return runHistoryCommand(args[1:])
+	case "db":
+		return runDBCommand(args[1:])
+	case "session":
+		return runSessionCommand(args[1:])
+	case "help", "-h", "--help":
+		printSubcommandUsage()
+		return 0
+	default:
+		fmt.Printf("Unknown command: %s\n", args[0])
+		printSubcommandUsage()
+		return 2
+	}
+}
+
+// printSubcommandUsage はサブコマンドの一覧を表示する
+func printSubcommandUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  nebula                     Start an interactive session")
+	fmt.Println("  nebula usage [--since 7d]  Show token usage and cost across projects")
+	fmt.Println("  nebula history search \"<query>\" [--project] [--limit N]")
+	fmt.Println("                             Search messages and tool results of past sessions")
+	fmt.Println("  nebula db migrate [--status]")
+	fmt.Println("                             Apply or list schema migrations of the memory database")
+	fmt.Println("  nebula db prune [--dry-run] [--vacuum]")
+	fmt.Println("                             Delete sessions beyond the retention limits")
+	fmt.Println("  nebula session list [--limit N]")
+	fmt.Println("                             List recent sessions of all projects")
+	fmt.Println("  nebula session export <id> [--format md|json|html] [--output file]")
+	fmt.Println("                             Export a session with tool calls, timestamps and token usage")
+	fmt.Println("  nebula session import <file> [--project path]")
+	fmt.Println("                             Import a JSON export so the session can be resumed here")
+}
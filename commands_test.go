@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+// TestSlashCommand only treats input starting with the slash command as a command
+func TestSlashCommand(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantArg string
+		wantOK  bool
+	}{
+		{"/search config loader", "config loader", true},
+		{"/search   spaced  ", "spaced", true},
+		{"/search", "", true},
+		{"search the repo for the config loader", "", false},
+		{"/searching", "", false},
+		{"please /search this", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			arg, ok := slashCommand(tt.input, "search")
+			if arg != tt.wantArg || ok != tt.wantOK {
+				t.Errorf("slashCommand(%q) = %q, %v, want %q, %v", tt.input, arg, ok, tt.wantArg, tt.wantOK)
+			}
+		})
+	}
+}
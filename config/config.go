@@ -5,17 +5,61 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"slices"
 
-	"github.com/sashabaranov/go-openai"
+	"nebula/permission"
 )
 
 // Config represents the nebula configuration
 type Config struct {
-	Model        string `json:"model"`
-	DatabasePath string `json:"database_path"`
-	MaxSessions  int    `json:"max_sessions"`
-	APIKey       string `json:"-"` // APIキーは設定ファイルに保存しない
+	Model                string                    `json:"model"`
+	Provider             string                    `json:"provider"`            // 使用するプロバイダー名（providersのキー）
+	Providers            map[string]ProviderConfig `json:"providers,omitempty"` // 名前ごとのプロバイダー設定
+	DatabasePath         string                    `json:"database_path"`
+	MaxSessions          int                       `json:"max_sessions"`         // 全プロジェクトで残すセッション数（0で無制限）
+	MaxProjectSessions   int                       `json:"max_project_sessions"` // プロジェクトごとに残すセッション数（0で無制限）
+	MaxSessionAgeDays    int                       `json:"max_session_age_days"` // 最後のやり取りからこの日数が経ったセッションを削除（0で無制限）
+	VacuumAfterPrune     bool                      `json:"vacuum_after_prune"`   // 起動時にセッションを削除したらVACUUMでDBファイルを縮める
+	Permissions          []permission.Rule         `json:"permissions,omitempty"`
+	AllowedDirs          []string                  `json:"allowed_dirs,omitempty"`  // ワークスペース外でアクセスを許可するディレクトリ
+	MaxToolRounds        int                       `json:"max_tool_rounds"`         // 1ターンあたりのツール呼び出しラウンドの上限（0で無制限）
+	MaxRepeatedToolCalls int                       `json:"max_repeated_tool_calls"` // 同じ引数での同一ツール呼び出しを許容する回数（0で検知しない）
+	MaxParallelTools     int                       `json:"max_parallel_tools"`      // 読み取り専用ツールを並列実行するワーカー数
+	Models               []ModelConfig             `json:"models,omitempty"`        // 組み込みのモデルに追加・上書きするモデル
+	ReasoningEffort      string                    `json:"reasoning_effort"`        // 推論モデルのreasoning_effortの既定値（空でモデルの既定）
+	ModeModels           ModeModels                `json:"mode_models"`             // モードごとに使うモデル（空の場合はmodel）
+	EscalationModel      string                    `json:"escalation_model"`        // 失敗が続いたときに切り替えるモデル（空で無効）
+	MaxToolErrors        int                       `json:"max_tool_errors"`         // エスカレーションするまでに1ターンで許容するツールエラーの回数
+	SnapshotTokens       int                       `json:"snapshot_tokens"`         // セッション開始時のプロジェクトスナップショットのトークン上限（0で無効）
+	RepoMapTokens        int                       `json:"repo_map_tokens"`         // システムプロンプトに含めるリポジトリマップのトークン上限（0で無効）
+	Embedding            EmbeddingConfig           `json:"embedding"`               // セマンティック検索の埋め込み
+	SummaryModel         string                    `json:"summary_model"`           // セッションのタイトルと要約を生成するモデル（空でmodel）
+}
+
+// EmbeddingConfig selects how code chunks are embedded for semantic search
+type EmbeddingConfig struct {
+	Provider   string `json:"provider"`             // "hash"（ローカルで計算）またはprovidersのキー
+	Model      string `json:"model,omitempty"`      // 埋め込みモデル（providersを使う場合）
+	Dimensions int    `json:"dimensions,omitempty"` // ベクトルの次元数（0でモデルの既定）
+}
+
+// ModeModels assigns models to PLAN and AGENT mode
+type ModeModels struct {
+	Plan  string `json:"plan,omitempty"`
+	Agent string `json:"agent,omitempty"`
+}
+
+// ProviderConfig describes how to reach an LLM provider
+type ProviderConfig struct {
+	Type      string            `json:"type"`                  // "openai"（OpenAI互換APIを含む）または "anthropic"
+	BaseURL   string            `json:"base_url,omitempty"`    // 空の場合は公式のエンドポイント
+	APIKeyEnv string            `json:"api_key_env,omitempty"` // APIキーを読み込む環境変数（空の場合はキー不要）
+	Headers   map[string]string `json:"headers,omitempty"`     // リクエストに追加するヘッダー
+}
+
+// ProjectConfig represents per-project settings stored in <project>/.nebula/config.json
+type ProjectConfig struct {
+	Permissions []permission.Rule `json:"permissions,omitempty"`
+	AllowedDirs []string          `json:"allowed_dirs,omitempty"` // プロジェクトルートからの相対パスも可
 }
 
 // DefaultConfig returns the default configuration
@@ -27,6 +71,23 @@ func DefaultConfig() *Config {
 		Model:        "gpt-4.1-nano", // デフォルトはgpt-4.1-nano
 		DatabasePath: defaultDBPath,
 		MaxSessions:  100,
+		Provider:     "openai",
+		Providers: map[string]ProviderConfig{
+			"openai":    {Type: "openai", APIKeyEnv: "OPENAI_API_KEY"},
+			"anthropic": {Type: "anthropic", APIKeyEnv: "ANTHROPIC_API_KEY"},
+		},
+		// ツールループの暴走を防ぐための上限
+		MaxToolRounds:        25,
+		MaxRepeatedToolCalls: 3,
+		MaxParallelTools:     4,
+		MaxToolErrors:        3,
+		// プロジェクトスナップショットはシステムプロンプトを圧迫しない程度に抑える
+		SnapshotTokens: 2000,
+		RepoMapTokens:  1000,
+		// 埋め込みはAPIキーなしで動くローカルのハッシュ埋め込みを既定にする
+		Embedding: EmbeddingConfig{Provider: "hash", Dimensions: 512},
+		// max_sessionsに加えてプロジェクトごとにも古いセッションを削除する（ピン留めしたものは残す）
+		MaxProjectSessions: 50,
 	}
 }
 
@@ -49,15 +110,25 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	// 設定ファイルに無い項目はデフォルト値を使う
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
-	// APIキーは環境変数から取得
-	config.APIKey = os.Getenv("OPENAI_API_KEY")
+	if err := validateRules(config.Permissions); err != nil {
+		return nil, fmt.Errorf("invalid permissions in config file: %w", err)
+	}
 
-	return &config, nil
+	if err := config.validateModels(); err != nil {
+		return nil, fmt.Errorf("invalid models in config file: %w", err)
+	}
+
+	if err := ValidateReasoningEffort(config.ReasoningEffort); err != nil {
+		return nil, fmt.Errorf("invalid config file: %w", err)
+	}
+
+	return config, nil
 }
 
 // SaveConfig saves configuration to file
@@ -82,6 +153,81 @@ func SaveConfig(config *Config) error {
 	return nil
 }
 
+// LoadProjectConfig loads the project-level configuration. A missing file yields an empty config.
+func LoadProjectConfig(projectPath string) (*ProjectConfig, error) {
+	data, err := os.ReadFile(getProjectConfigPath(projectPath))
+	if os.IsNotExist(err) {
+		return &ProjectConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project config file: %w", err)
+	}
+
+	var config ProjectConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse project config file: %w", err)
+	}
+
+	if err := validateRules(config.Permissions); err != nil {
+		return nil, fmt.Errorf("invalid permissions in project config file: %w", err)
+	}
+
+	return &config, nil
+}
+
+// SaveProjectConfig saves the project-level configuration
+func SaveProjectConfig(projectPath string, config *ProjectConfig) error {
+	configPath := getProjectConfigPath(projectPath)
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("failed to create project config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal project config: %w", err)
+	}
+
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write project config file: %w", err)
+	}
+
+	return nil
+}
+
+// GetProvider returns the configuration of a provider by name
+func (c *Config) GetProvider(name string) (ProviderConfig, error) {
+	provider, ok := c.Providers[name]
+	if !ok {
+		return ProviderConfig{}, fmt.Errorf("unknown provider %q (not found in providers)", name)
+	}
+	return provider, nil
+}
+
+// APIKey reads the API key of the provider from its environment variable.
+// APIキーは設定ファイルに保存しない
+func (p ProviderConfig) APIKey() string {
+	if p.APIKeyEnv == "" {
+		return ""
+	}
+	return os.Getenv(p.APIKeyEnv)
+}
+
+// validateRules checks every permission rule
+func validateRules(rules []permission.Rule) error {
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getProjectConfigPath returns the path to the project configuration file
+func getProjectConfigPath(projectPath string) string {
+	return filepath.Join(projectPath, ".nebula", "config.json")
+}
+
 // getConfigPath returns the path to the configuration file
 func getConfigPath() string {
 
@@ -93,26 +239,12 @@ func getConfigPath() string {
 	return filepath.Join(homeDir, ".nebula", "config.json")
 }
 
-// GetOpenAIModel returns the appropriate OpenAI model identifier
-func (c *Config) GetOpenAIModel() string {
-	switch c.Model {
-	case "gpt-4.1-nano":
-		return openai.GPT4Dot1Nano // OpenAIライブラリでの実際の識別子
-	case "gpt-4.1-mini":
-		return openai.GPT4Dot1Mini // 現在は同じモデルを使用（将来的に変更可能）
-	default:
-		return openai.GPT4Dot1Nano // デフォルト
-	}
-}
-
 // SetModel updates the model in configuration
 func (c *Config) SetModel(model string) error {
-	validModels := []string{"gpt-4.1-nano", "gpt-4.1-mini"}
-
-	if slices.Contains(validModels, model) {
+	if _, ok := c.FindModel(model); ok {
 		c.Model = model
 		return SaveConfig(c)
 	}
 
-	return fmt.Errorf("invalid model: %s. Valid models: %v", model, validModels)
+	return fmt.Errorf("invalid model: %s. Valid models: %v", model, c.modelNames())
 }
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ModelConfig describes a model that can be selected with the model command
+type ModelConfig struct {
+	Name            string            `json:"name"`               // 表示名（modelコマンドや設定のmodelで使う名前）
+	Provider        string            `json:"provider,omitempty"` // providersのキー（空の場合は設定のprovider）
+	ModelID         string            `json:"model_id"`           // APIに渡すモデル識別子
+	ContextWindow   int               `json:"context_window"`     // コンテキストウィンドウのトークン数
+	MaxOutputTokens int               `json:"max_output_tokens"`  // 1回の応答の最大出力トークン数
+	Price           ModelPrice        `json:"price"`              // 料金（USD / 100万トークン）
+	Capabilities    ModelCapabilities `json:"capabilities"`       // モデルが対応している機能
+	Description     string            `json:"description,omitempty"`
+}
+
+// ModelCapabilities lists the features a model supports
+type ModelCapabilities struct {
+	Tools     bool `json:"tools"`
+	Streaming bool `json:"streaming"`
+	Vision    bool `json:"vision"`
+	Reasoning bool `json:"reasoning"`
+}
+
+// ModelPrice is the price of a model in USD per one million tokens
+type ModelPrice struct {
+	Input       float64 `json:"input"`
+	CachedInput float64 `json:"cached_input,omitempty"` // 0の場合はInputと同じ料金
+	CacheWrite  float64 `json:"cache_write,omitempty"`  // プロンプトキャッシュへの書き込みの料金（0の場合はInputと同じ料金）
+	Output      float64 `json:"output"`
+}
+
+// builtinModels returns the models known without any configuration
+func builtinModels() []ModelConfig {
+	gpt41 := ModelCapabilities{Tools: true, Streaming: true, Vision: true}
+	return []ModelConfig{
+		{
+			Name:            "gpt-4.1-nano",
+			Provider:        "openai",
+			ModelID:         "gpt-4.1-nano",
+			ContextWindow:   1_047_576,
+			MaxOutputTokens: 32_768,
+			Price:           ModelPrice{Input: 0.10, CachedInput: 0.025, Output: 0.40},
+			Capabilities:    gpt41,
+			Description:     "default, faster",
+		},
+		{
+			Name:            "gpt-4.1-mini",
+			Provider:        "openai",
+			ModelID:         "gpt-4.1-mini",
+			ContextWindow:   1_047_576,
+			MaxOutputTokens: 32_768,
+			Price:           ModelPrice{Input: 0.40, CachedInput: 0.10, Output: 1.60},
+			Capabilities:    gpt41,
+			Description:     "complex tasks",
+		},
+		{
+			Name:            "gpt-4.1",
+			Provider:        "openai",
+			ModelID:         "gpt-4.1",
+			ContextWindow:   1_047_576,
+			MaxOutputTokens: 32_768,
+			Price:           ModelPrice{Input: 2.00, CachedInput: 0.50, Output: 8.00},
+			Capabilities:    gpt41,
+		},
+		{
+			Name:            "o4-mini",
+			Provider:        "openai",
+			ModelID:         "o4-mini",
+			ContextWindow:   200_000,
+			MaxOutputTokens: 100_000,
+			Price:           ModelPrice{Input: 1.10, CachedInput: 0.275, Output: 4.40},
+			Capabilities:    ModelCapabilities{Tools: true, Streaming: true, Vision: true, Reasoning: true},
+		},
+		{
+			Name:            "gpt-5",
+			Provider:        "openai",
+			ModelID:         "gpt-5",
+			ContextWindow:   400_000,
+			MaxOutputTokens: 128_000,
+			Price:           ModelPrice{Input: 1.25, CachedInput: 0.125, Output: 10.00},
+			Capabilities:    ModelCapabilities{Tools: true, Streaming: true, Vision: true, Reasoning: true},
+			Description:     "deep reasoning",
+		},
+		{
+			Name:            "gpt-5-mini",
+			Provider:        "openai",
+			ModelID:         "gpt-5-mini",
+			ContextWindow:   400_000,
+			MaxOutputTokens: 128_000,
+			Price:           ModelPrice{Input: 0.25, CachedInput: 0.025, Output: 2.00},
+			Capabilities:    ModelCapabilities{Tools: true, Streaming: true, Vision: true, Reasoning: true},
+		},
+		{
+			Name:            "claude-sonnet-4",
+			Provider:        "anthropic",
+			ModelID:         "claude-sonnet-4-20250514",
+			ContextWindow:   200_000,
+			MaxOutputTokens: 64_000,
+			Price:           ModelPrice{Input: 3.00, CachedInput: 0.30, CacheWrite: 3.75, Output: 15.00},
+			Capabilities:    ModelCapabilities{Tools: true, Streaming: true, Vision: true},
+		},
+	}
+}
+
+// ModelRegistry returns the built-in models followed by the configured ones.
+// A configured model with the same name replaces the built-in entry.
+func (c *Config) ModelRegistry() []ModelConfig {
+	registry := builtinModels()
+	for _, model := range c.Models {
+		replaced := false
+		for i := range registry {
+			if registry[i].Name == model.Name {
+				registry[i] = model
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			registry = append(registry, model)
+		}
+	}
+	return registry
+}
+
+// FindModel looks up a model in the registry by name
+func (c *Config) FindModel(name string) (ModelConfig, bool) {
+	for _, model := range c.ModelRegistry() {
+		if model.Name == name {
+			return model, true
+		}
+	}
+	return ModelConfig{}, false
+}
+
+// GetModel returns the registry entry of the current model
+func (c *Config) GetModel() (ModelConfig, error) {
+	model, ok := c.FindModel(c.Model)
+	if !ok {
+		return ModelConfig{}, fmt.Errorf("unknown model %q. Valid models: %s", c.Model, strings.Join(c.modelNames(), ", "))
+	}
+	return model, nil
+}
+
+// ModelForMode returns the model assigned to PLAN or AGENT mode. Modes without
+// an assignment use the current model.
+func (c *Config) ModelForMode(planMode bool) (ModelConfig, error) {
+	name := c.ModeModels.Agent
+	if planMode {
+		name = c.ModeModels.Plan
+	}
+	if name == "" {
+		return c.GetModel()
+	}
+
+	model, ok := c.FindModel(name)
+	if !ok {
+		return ModelConfig{}, fmt.Errorf("unknown model %q in mode_models. Valid models: %s", name, strings.Join(c.modelNames(), ", "))
+	}
+	return model, nil
+}
+
+// GetEscalationModel returns the model to escalate to, if one is configured
+func (c *Config) GetEscalationModel() (ModelConfig, bool) {
+	if c.EscalationModel == "" {
+		return ModelConfig{}, false
+	}
+	return c.FindModel(c.EscalationModel)
+}
+
+// GetSummaryModel returns the model that titles and summarizes sessions.
+// Without a summary_model the current model is used.
+func (c *Config) GetSummaryModel() (ModelConfig, error) {
+	if c.SummaryModel == "" {
+		return c.GetModel()
+	}
+	model, ok := c.FindModel(c.SummaryModel)
+	if !ok {
+		return ModelConfig{}, fmt.Errorf("unknown summary_model %q. Valid models: %s", c.SummaryModel, strings.Join(c.modelNames(), ", "))
+	}
+	return model, nil
+}
+
+// ModelProvider returns the provider name and configuration used by a model
+func (c *Config) ModelProvider(model ModelConfig) (string, ProviderConfig, error) {
+	name := model.Provider
+	if name == "" {
+		name = c.Provider
+	}
+	provider, err := c.GetProvider(name)
+	if err != nil {
+		return "", ProviderConfig{}, err
+	}
+	return name, provider, nil
+}
+
+// Cost returns the price in USD of an API call made with the model. Cached
+// tokens and tokens written to the cache are part of the prompt tokens.
+func (m ModelConfig) Cost(promptTokens, cachedTokens, cacheWriteTokens, completionTokens int) float64 {
+	cachedPrice := m.Price.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = m.Price.Input
+	}
+	cacheWritePrice := m.Price.CacheWrite
+	if cacheWritePrice == 0 {
+		cacheWritePrice = m.Price.Input
+	}
+
+	// キャッシュの読み書きのトークンはプロンプトトークンに含まれている
+	uncached := promptTokens - cachedTokens - cacheWriteTokens
+	return (float64(uncached)*m.Price.Input + float64(cachedTokens)*cachedPrice + float64(cacheWriteTokens)*cacheWritePrice +
+		float64(completionTokens)*m.Price.Output) / 1_000_000
+}
+
+// Reasoning effort levels accepted by reasoning models
+var ReasoningEfforts = []string{"minimal", "low", "medium", "high"}
+
+// ValidateReasoningEffort checks a reasoning effort level. Empty means the model default.
+func ValidateReasoningEffort(effort string) error {
+	if effort == "" || slices.Contains(ReasoningEfforts, effort) {
+		return nil
+	}
+	return fmt.Errorf("invalid reasoning effort %q (expected %s)", effort, strings.Join(ReasoningEfforts, ", "))
+}
+
+// validateModels checks the configured models and the current model
+func (c *Config) validateModels() error {
+	for _, model := range c.Models {
+		if model.Name == "" || model.ModelID == "" {
+			return fmt.Errorf("model entries need a name and a model_id")
+		}
+		if _, _, err := c.ModelProvider(model); err != nil {
+			return fmt.Errorf("model %s: %w", model.Name, err)
+		}
+	}
+	if _, err := c.GetModel(); err != nil {
+		return err
+	}
+	for _, planMode := range []bool{true, false} {
+		if _, err := c.ModelForMode(planMode); err != nil {
+			return err
+		}
+	}
+	if c.EscalationModel != "" {
+		if _, ok := c.GetEscalationModel(); !ok {
+			return fmt.Errorf("unknown escalation_model %q. Valid models: %s", c.EscalationModel, strings.Join(c.modelNames(), ", "))
+		}
+	}
+	if _, err := c.GetSummaryModel(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// modelNames returns the names of all registered models
+func (c *Config) modelNames() []string {
+	var names []string
+	for _, model := range c.ModelRegistry() {
+		names = append(names, model.Name)
+	}
+	return names
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nebula/config"
+	"nebula/llm"
+	"nebula/memory"
+	"nebula/tools"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newConversationTest returns a router backed by a fake provider, a memory
+// manager with an active session and a tool map holding a single echo tool
+func newConversationTest(t *testing.T, responses ...openai.ChatCompletionResponse) (*modelRouter, *config.Config, *memory.Manager, *llm.FakeProvider, map[string]tools.ToolDefinition, *[]string) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	router := newModelRouter(cfg)
+	model, err := cfg.ModelForMode(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerName, _, err := cfg.ModelProvider(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := llm.NewFakeProvider(responses...)
+	router.providers[providerName] = fake
+
+	memoryManager, err := memory.NewManager(filepath.Join(t.TempDir(), "memory.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { memoryManager.Close() })
+	if _, err := memoryManager.StartSession(t.TempDir(), model.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	toolsMap := map[string]tools.ToolDefinition{
+		"echo": {
+			Schema: openai.Tool{
+				Type:     openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{Name: "echo", Description: "Echo the text back"},
+			},
+			Function: func(args string) (string, error) {
+				calls = append(calls, args)
+				var input struct {
+					Text string `json:"text"`
+				}
+				if err := json.Unmarshal([]byte(args), &input); err != nil {
+					return "", err
+				}
+				return `{"text":"` + input.Text + `"}`, nil
+			},
+			Capabilities: tools.Capabilities{ReadOnly: true},
+		},
+	}
+	return router, cfg, memoryManager, fake, toolsMap, &calls
+}
+
+// TestHandleConversationToolLoop runs a tool call and the final answer through handleConversation
+func TestHandleConversationToolLoop(t *testing.T) {
+	router, cfg, memoryManager, fake, toolsMap, calls := newConversationTest(t,
+		llm.FakeToolCall("call_1", "echo", `{"text":"hi"}`),
+		llm.FakeText("done"),
+	)
+
+	messages, outcome := handleConversation(router, cfg, memoryManager, toolsMap, "say hi", nil, false)
+	if outcome != conversationCompleted {
+		t.Fatalf("got outcome %d, want %d", outcome, conversationCompleted)
+	}
+
+	if len(*calls) != 1 || (*calls)[0] != `{"text":"hi"}` {
+		t.Errorf("echo calls = %q, want one call with the model's arguments", *calls)
+	}
+
+	wantRoles := []string{
+		openai.ChatMessageRoleSystem,
+		openai.ChatMessageRoleUser,
+		openai.ChatMessageRoleAssistant,
+		openai.ChatMessageRoleTool,
+		openai.ChatMessageRoleAssistant,
+	}
+	if len(messages) != len(wantRoles) {
+		t.Fatalf("got %d messages, want %d", len(messages), len(wantRoles))
+	}
+	for i, role := range wantRoles {
+		if messages[i].Role != role {
+			t.Errorf("messages[%d].Role = %s, want %s", i, messages[i].Role, role)
+		}
+	}
+	if got := messages[3]; got.ToolCallID != "call_1" || got.Content != `{"text":"hi"}` {
+		t.Errorf("tool result = %+v, want the echo output for call_1", got)
+	}
+	if got := messages[4].Content; got != "done" {
+		t.Errorf("final answer = %q, want %q", got, "done")
+	}
+
+	// 2回目のリクエストにはツールの結果が含まれる
+	requests := fake.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if len(requests[0].Tools) != 1 || requests[0].Tools[0].Function.Name != "echo" {
+		t.Errorf("first request tools = %+v, want the echo tool", requests[0].Tools)
+	}
+	second := requests[1].Messages
+	if last := second[len(second)-1]; last.Role != openai.ChatMessageRoleTool || last.ToolCallID != "call_1" {
+		t.Errorf("last message of the second request = %+v, want the tool result", last)
+	}
+
+	saved, err := memoryManager.GetSessionMessages(memoryManager.GetCurrentSession().ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSaved := []string{"user", "assistant", "tool", "assistant"}
+	if len(saved) != len(wantSaved) {
+		t.Fatalf("got %d saved messages, want %d", len(saved), len(wantSaved))
+	}
+	for i, role := range wantSaved {
+		if saved[i].Role != role {
+			t.Errorf("saved[%d].Role = %s, want %s", i, saved[i].Role, role)
+		}
+	}
+}
+
+// TestHandleConversationFailure reports a failed turn when the API errors after a tool call
+func TestHandleConversationFailure(t *testing.T) {
+	router, cfg, memoryManager, _, toolsMap, _ := newConversationTest(t,
+		llm.FakeToolCall("call_1", "echo", `{"text":"hi"}`),
+	)
+
+	messages, outcome := handleConversation(router, cfg, memoryManager, toolsMap, "say hi", nil, false)
+	if outcome != conversationFailed {
+		t.Fatalf("got outcome %d, want %d", outcome, conversationFailed)
+	}
+	if last := messages[len(messages)-1]; last.Role != openai.ChatMessageRoleTool {
+		t.Errorf("last message role = %s, want the tool result to be kept", last.Role)
+	}
+}
+
+// TestHandleConversationLoopEscalation tells the escalated model that the
+// previous one kept repeating the same tool call
+func TestHandleConversationLoopEscalation(t *testing.T) {
+	router, cfg, memoryManager, fake, toolsMap, calls := newConversationTest(t,
+		llm.FakeToolCall("call_1", "echo", `{"text":"hi"}`),
+		llm.FakeToolCall("call_2", "echo", `{"text":"hi"}`),
+		llm.FakeToolCall("call_3", "echo", `{"text":"hi"}`),
+		llm.FakeText("done"),
+	)
+	cfg.EscalationModel = "gpt-4.1"
+
+	messages, outcome := handleConversation(router, cfg, memoryManager, toolsMap, "say hi", nil, false)
+	if outcome != conversationCompleted {
+		t.Fatalf("got outcome %d, want %d", outcome, conversationCompleted)
+	}
+	if len(*calls) != 3 {
+		t.Errorf("got %d echo calls, want 3", len(*calls))
+	}
+
+	requests := fake.Requests()
+	if len(requests) != 4 {
+		t.Fatalf("got %d requests, want 4", len(requests))
+	}
+	last := requests[3]
+	if last.Model != "gpt-4.1" {
+		t.Errorf("model after the loop guard = %s, want gpt-4.1", last.Model)
+	}
+	note := last.Messages[len(last.Messages)-1]
+	if note.Role != openai.ChatMessageRoleUser || !strings.Contains(note.Content, "repeated 3 times") {
+		t.Errorf("last message of the escalated request = %+v, want the repeat note", note)
+	}
+	if got := messages[len(messages)-2]; got.Content != note.Content {
+		t.Errorf("history message = %+v, want the repeat note", got)
+	}
+}
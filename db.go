@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"nebula/config"
+	"nebula/memory"
+)
+
+// runDBCommand は `nebula db` を実行する
+func runDBCommand(args []string) int {
+	if len(args) == 0 {
+		printDBUsage()
+		return 2
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runMigrateCommand(args[1:])
+	case "prune":
+		return runPruneCommand(args[1:])
+	default:
+		fmt.Printf("Unknown db command: %s\n", args[0])
+		printDBUsage()
+		return 2
+	}
+}
+
+// printDBUsage は `nebula db` のサブコマンドの一覧を表示する
+func printDBUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  nebula db migrate [--status]           Apply pending schema migrations to the memory database")
+	fmt.Println("  nebula db prune [--dry-run] [--vacuum] Delete sessions beyond the retention limits")
+}
+
+// runMigrateCommand は `nebula db migrate` を実行し、メモリDBのスキーマを最新にする
+func runMigrateCommand(args []string) int {
+	fs := flag.NewFlagSet("db migrate", flag.ContinueOnError)
+	status := fs.Bool("status", false, "only report the schema version and pending migrations")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return 1
+	}
+
+	if *status {
+		version, statuses, err := memory.GetMigrationStatus(cfg.DatabasePath)
+		if err != nil {
+			fmt.Printf("Error reading migration status: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Database: %s\n", cfg.DatabasePath)
+		fmt.Printf("Schema version: %d (latest %d)\n\n", version, memory.LatestSchemaVersion())
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+			fmt.Printf("  %3d  %-8s %s\n", s.Version, state, s.Description)
+		}
+		return 0
+	}
+
+	result, err := memory.Migrate(cfg.DatabasePath)
+	if err != nil {
+		fmt.Printf("Error migrating database: %v\n", err)
+		if result != nil {
+			for _, backup := range result.Backups {
+				fmt.Printf("Backup: %s\n", backup)
+			}
+		}
+		return 1
+	}
+
+	for _, backup := range result.Backups {
+		fmt.Printf("Backup: %s\n", backup)
+	}
+	if result.From == result.To {
+		fmt.Printf("Database is up to date (schema version %d)\n", result.To)
+	} else {
+		fmt.Printf("Migrated database from schema version %d to %d\n", result.From, result.To)
+	}
+	return 0
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"nebula/memory"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// /forkと引数なしで実行したときに表示するメッセージ数
+const maxForkPointsShown = 20
+
+// handleForkCommand copies the conversation up to a message into a new session
+// and switches to it, keeping the original session unchanged. Without an
+// argument it lists the messages of the current session that can be forked.
+func handleForkCommand(memoryManager *memory.Manager, router *modelRouter, summarizer *sessionSummarizer, model, arg string, messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, *sessionSummarizer) {
+	if arg == "" {
+		printForkPoints(memoryManager)
+		return messages, summarizer
+	}
+
+	messageID, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil || messageID <= 0 {
+		fmt.Println("Usage: /fork <message-id>")
+		return messages, summarizer
+	}
+
+	// 分岐する前に元のセッションの要約を更新しておく
+	summarizer.finish()
+
+	parent := memoryManager.GetCurrentSession()
+	session, err := memoryManager.ForkSession(messageID, model)
+	if err != nil {
+		fmt.Printf("Error forking session: %v\n", err)
+		return messages, summarizer
+	}
+
+	memoryMessages, err := memoryManager.GetSessionMessages(session.ID)
+	if err != nil {
+		fmt.Printf("Error loading session messages: %v\n", err)
+	}
+	forked := convertToOpenAIMessages(memoryMessages)
+
+	from := session.ParentSessionID
+	if parent != nil && parent.ID == session.ParentSessionID && parent.Title != "" {
+		from = parent.Title
+	}
+	fmt.Printf("Forked session: %s (from %s at message #%d, %d messages)\n", session.ID, from, messageID, len(forked))
+	fmt.Println("The original session is kept and can be restored at the next start")
+	return forked, newSessionSummarizer(router, memoryManager)
+}
+
+// printForkPoints は現在のセッションの最近の発言をメッセージIDとともに表示する
+func printForkPoints(memoryManager *memory.Manager) {
+	session := memoryManager.GetCurrentSession()
+	if session == nil {
+		fmt.Println("No active session")
+		return
+	}
+	memoryMessages, err := memoryManager.GetSessionMessages(session.ID)
+	if err != nil {
+		fmt.Printf("Error loading session messages: %v\n", err)
+		return
+	}
+
+	// ツールの呼び出しと結果は一覧が長くなるので省く
+	var points []*memory.Message
+	for _, msg := range memoryMessages {
+		if (msg.Role == "user" || msg.Role == "assistant") && strings.TrimSpace(msg.Content) != "" {
+			points = append(points, msg)
+		}
+	}
+	if len(points) == 0 {
+		fmt.Println("No messages to fork from yet")
+		return
+	}
+	if len(points) > maxForkPointsShown {
+		fmt.Printf("(%d earlier messages not shown)\n", len(points)-maxForkPointsShown)
+		points = points[len(points)-maxForkPointsShown:]
+	}
+
+	for _, msg := range points {
+		content := strings.Join(strings.Fields(msg.Content), " ")
+		if truncated := truncateText(content, 80); truncated != content {
+			content = truncated + "..."
+		}
+		fmt.Printf("  #%-6d %-9s %s  %s\n", msg.ID, msg.Role, msg.Timestamp.Local().Format("15:04"), content)
+	}
+	fmt.Println("Usage: /fork <message-id> - start a new session with the conversation up to and including that message")
+}
+
+// sessionTreeNode はセッション一覧の1行
+type sessionTreeNode struct {
+	Session *memory.SessionSummary
+	Prefix  string // 親からの枝を表す罫線
+	Indent  string // 同じセッションの2行目以降の字下げ
+}
+
+// sessionTree はフォークしたセッションを親の下に並べる
+// 親が一覧にないセッションは最上位に表示し、兄弟は一覧の順序のまま並べる
+func sessionTree(sessions []*memory.SessionSummary) []sessionTreeNode {
+	listed := make(map[string]bool, len(sessions))
+	for _, s := range sessions {
+		listed[s.ID] = true
+	}
+
+	children := make(map[string][]*memory.SessionSummary)
+	var roots []*memory.SessionSummary
+	for _, s := range sessions {
+		if s.ParentSessionID != "" && listed[s.ParentSessionID] {
+			children[s.ParentSessionID] = append(children[s.ParentSessionID], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+
+	nodes := make([]sessionTreeNode, 0, len(sessions))
+	var walk func(s *memory.SessionSummary, prefix, indent string)
+	walk = func(s *memory.SessionSummary, prefix, indent string) {
+		nodes = append(nodes, sessionTreeNode{Session: s, Prefix: prefix, Indent: indent})
+		kids := children[s.ID]
+		for i, child := range kids {
+			if i == len(kids)-1 {
+				walk(child, indent+"└─ ", indent+"   ")
+			} else {
+				walk(child, indent+"├─ ", indent+"│  ")
+			}
+		}
+	}
+	for _, root := range roots {
+		walk(root, "", "")
+	}
+	return nodes
+}
+
+// formatForkPoint はフォークしたセッションの分岐元を表示用にまとめる
+// 親が一覧に表示されていない場合は親のIDも示す
+func formatForkPoint(s *memory.SessionSummary, parentListed bool) string {
+	if s.ParentSessionID == "" {
+		return ""
+	}
+	if parentListed {
+		return fmt.Sprintf("forked at #%d", s.ForkPoint)
+	}
+	return fmt.Sprintf("forked from %s at #%d", truncateText(s.ParentSessionID, 8), s.ForkPoint)
+}
@@ -0,0 +1,68 @@
+package glob
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether the slash-separated path matches the pattern.
+//
+// Patterns follow path.Match syntax per segment, with two extensions:
+//   - "**" matches zero or more whole segments
+//   - a pattern without "/" matches any single segment of the path, so
+//     ".env*" matches ".env", "config/.env.local" and everything under ".env/"
+//
+// A pattern that matches a directory also matches everything below it.
+// Absolute names only match patterns that start with "/", so that a relative
+// pattern such as "etc/**" never matches "/etc/passwd".
+func Match(pattern, name string) bool {
+	if path.IsAbs(pattern) != path.IsAbs(name) {
+		return false
+	}
+	pattern = strings.Trim(pattern, "/")
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if pattern == "" {
+		return false
+	}
+
+	nameSegs := strings.Split(name, "/")
+
+	// スラッシュを含まないパターンはどの階層のセグメントにもマッチする
+	if !strings.Contains(pattern, "/") && pattern != "**" {
+		for _, seg := range nameSegs {
+			if ok, _ := path.Match(pattern, seg); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return matchSegments(strings.Split(pattern, "/"), nameSegs)
+}
+
+// matchSegments matches pattern segments against path segments. Trailing path
+// segments left over after the pattern is exhausted are accepted, so that a
+// directory pattern covers its contents.
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+
+	if pattern[0] == "**" {
+		// "**" は0個以上のセグメントにマッチする
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
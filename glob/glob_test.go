@@ -0,0 +1,67 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		// 1つのセグメント
+		{"main.go", "main.go", true},
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/tool/main.go", true},
+		{"*.go", "main.go.bak", false},
+		{".env*", ".env", true},
+		{".env*", "config/.env.local", true},
+		{".env*", ".env/secrets.json", true},
+		{".env*", "environment.go", false},
+
+		// "/"を含むパターンはルートからのパス
+		{"internal/*.go", "internal/a.go", true},
+		{"internal/*.go", "internal/sub/a.go", false},
+		{"internal/*.go", "pkg/internal/a.go", false},
+		{"internal", "internal/sub/a.go", true},
+		{"internal/sub", "internal/sub/a.go", true},
+		{"internal/sub", "internal/subway/a.go", false},
+
+		// "**"は0個以上のセグメント
+		{"**", "a/b/c.go", true},
+		{"internal/**", "internal", true},
+		{"internal/**", "internal/a/b/c.go", true},
+		{"internal/**", "internals/a.go", false},
+		{"**/testdata/**", "testdata/x.json", true},
+		{"**/testdata/**", "pkg/a/testdata/x.json", true},
+		{"**/*_test.go", "pkg/a/b_test.go", true},
+		{"**/*_test.go", "pkg/a/b.go", false},
+		{"src/**/gen/*.go", "src/gen/a.go", true},
+		{"src/**/gen/*.go", "src/a/b/gen/a.go", true},
+		{"src/**/gen/*.go", "src/a/b/gen/sub/a.go", false},
+
+		// 名前の正規化
+		{"internal/*.go", "./internal/a.go", true},
+		{"internal/*.go", "internal//a.go", true},
+		{"internal/**", "internal/../secret/a.go", false},
+		{"", "main.go", false},
+
+		// 絶対パスは"/"で始まるパターンとだけ照合する
+		{"etc/**", "/etc/passwd", false},
+		{"etc/passwd", "/etc/passwd", false},
+		{"**", "/etc/passwd", false},
+		{"passwd", "/etc/passwd", false},
+		{"/etc/**", "/etc/passwd", true},
+		{"/etc/*", "/etc/passwd", true},
+		{"/home/**/*.go", "/home/u/src/a.go", true},
+		{"/etc/**", "etc/passwd", false},
+		{"/etc/**", "/var/etc/passwd", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := Match(tt.pattern, tt.name); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
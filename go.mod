@@ -2,11 +2,14 @@ module nebula
 
 go 1.23.1
 
-require github.com/sashabaranov/go-openai v1.40.3
+require (
+	github.com/google/uuid v1.6.0
+	github.com/sashabaranov/go-openai v1.40.3
+	modernc.org/sqlite v1.38.0
+)
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/ncruces/go-strftime v0.1.9 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
@@ -15,5 +18,4 @@ require (
 	modernc.org/libc v1.65.10 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
 	modernc.org/memory v1.11.0 // indirect
-	modernc.org/sqlite v1.38.0 // indirect
 )
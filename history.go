@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"nebula/config"
+	"nebula/memory"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultHistorySearchLimit は履歴検索で表示する結果のデフォルト件数
+const defaultHistorySearchLimit = 20
+
+// saveToolResults はツールの実行結果をメモリに保存し、後のセッションから検索できるようにする
+// ツール名と引数を本文に、結果をtool_resultsに記録する
+func saveToolResults(memoryManager *memory.Manager, toolCalls []openai.ToolCall, toolMessages []openai.ChatCompletionMessage) {
+	for i, toolCall := range toolCalls {
+		if i >= len(toolMessages) {
+			break
+		}
+		content := strings.TrimSpace(toolCall.Function.Name + " " + toolCall.Function.Arguments)
+		if _, err := memoryManager.SaveMessage("tool", content, nil, toolMessages[i].Content); err != nil {
+			fmt.Printf("Error saving tool result: %v\n", err)
+		}
+	}
+}
+
+// handleSearchCommand searches the messages of earlier sessions of this project
+func handleSearchCommand(memoryManager *memory.Manager, query string) {
+	if query == "" {
+		fmt.Println("Usage: /search <query>")
+		return
+	}
+
+	results, err := memoryManager.SearchHistory(query, false, defaultHistorySearchLimit)
+	if err != nil {
+		fmt.Printf("Error searching history: %v\n", err)
+		return
+	}
+	printSearchResults(results, false)
+}
+
+// printSearchResults は履歴検索の結果をセッション・日時・スニペットの形式で表示する
+func printSearchResults(results []*memory.SearchResult, withProject bool) {
+	if len(results) == 0 {
+		fmt.Println("No matching messages found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		header := fmt.Sprintf("%s\t%s\t%s", r.Timestamp.Format("2006-01-02 15:04"), r.SessionID, r.Role)
+		if withProject {
+			header += "\t" + r.ProjectPath
+		}
+		fmt.Fprintln(w, header)
+		fmt.Fprintf(w, "  %s\n", r.Snippet)
+	}
+	w.Flush()
+}
+
+// runHistoryCommand は `nebula history` を実行する
+func runHistoryCommand(args []string) int {
+	if len(args) == 0 || args[0] != "search" {
+		fmt.Println("Usage: nebula history search [--project] [--limit N] \"<query>\"")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("history search", flag.ContinueOnError)
+	projectOnly := fs.Bool("project", false, "only search sessions of the current directory")
+	limit := fs.Int("limit", defaultHistorySearchLimit, "maximum number of results")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	query := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if query == "" {
+		fmt.Println("Usage: nebula history search [--project] [--limit N] \"<query>\"")
+		return 2
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return 1
+	}
+	memoryManager, err := memory.NewManager(cfg.DatabasePath)
+	if err != nil {
+		fmt.Printf("Error initializing memory: %v\n", err)
+		return 1
+	}
+	defer memoryManager.Close()
+
+	opts := memory.SearchOptions{Limit: *limit}
+	if *projectOnly {
+		currentDir, err := os.Getwd()
+		if err != nil {
+			fmt.Printf("Error getting current directory: %v\n", err)
+			return 1
+		}
+		opts.ProjectPath = currentDir
+	}
+
+	results, err := memoryManager.SearchMessages(query, opts)
+	if err != nil {
+		fmt.Printf("Error searching history: %v\n", err)
+		return 1
+	}
+	printSearchResults(results, !*projectOnly)
+	return 0
+}
@@ -0,0 +1,94 @@
+package indexer
+
+import (
+	"sort"
+	"strings"
+
+	"nebula/memory"
+	"nebula/repomap"
+)
+
+// Chunk size limits in lines
+const (
+	maxChunkLines = 80 // これより長い関数は windowLines ごとに分割する
+	windowLines   = 60
+)
+
+// docCommentPrefixes start lines that belong to the declaration below them
+var docCommentPrefixes = []string{"//", "#", "/*", "*", "--", "@"}
+
+// ChunkFile splits a source file into chunks at its top-level declarations.
+// Doc comments stay with the declaration they describe, long declarations are
+// split into windows and files without declarations are cut into windows.
+func ChunkFile(path string, src []byte) []memory.CodeChunk {
+	lines := strings.Split(string(src), "\n")
+	symbols, _ := repomap.Extract(path, src)
+
+	// 関数・型・クラスの宣言の行を境界にする（定数や変数の1行ごとには分けない）
+	type boundary struct {
+		line   int // 0始まりの行番号
+		symbol string
+	}
+	var boundaries []boundary
+	seen := make(map[int]bool)
+	for _, symbol := range symbols {
+		if symbol.Kind == "const" || symbol.Kind == "var" {
+			continue
+		}
+		line := symbol.Line - 1
+		if line < 0 || line >= len(lines) {
+			continue
+		}
+		// 直前のドキュメントコメントやデコレーターを含める
+		for line > 0 && isDocLine(lines[line-1]) {
+			line--
+		}
+		if seen[line] {
+			continue
+		}
+		seen[line] = true
+		boundaries = append(boundaries, boundary{line: line, symbol: symbol.Name})
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].line < boundaries[j].line })
+
+	var chunks []memory.CodeChunk
+	add := func(start, end int, symbol string) {
+		// 長いブロックは窓に分割する
+		for start < end {
+			stop := end
+			if stop-start > maxChunkLines {
+				stop = start + windowLines
+			}
+			content := strings.Join(lines[start:stop], "\n")
+			if strings.TrimSpace(content) != "" {
+				chunks = append(chunks, memory.CodeChunk{
+					Path:      path,
+					StartLine: start + 1,
+					EndLine:   stop,
+					Symbol:    symbol,
+					Content:   content,
+				})
+			}
+			start = stop
+		}
+	}
+
+	start, symbol := 0, ""
+	for _, b := range boundaries {
+		add(start, b.line, symbol)
+		start, symbol = b.line, b.symbol
+	}
+	add(start, len(lines), symbol)
+	return chunks
+}
+
+// isDocLine reports whether a line is a comment or decorator
+func isDocLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range docCommentPrefixes {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return false
+}
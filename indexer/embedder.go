@@ -0,0 +1,192 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// HashEmbedderName is the provider name of the local hashing embedder
+const HashEmbedderName = "hash"
+
+// Embedder turns texts into vectors. Texts with similar meaning should get
+// vectors with a high cosine similarity.
+type Embedder interface {
+	// Name identifies the model; the index is rebuilt when it changes
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// HashEmbedder is a deterministic local embedder. It hashes words (split at
+// camelCase and snake_case boundaries) and character trigrams into a fixed
+// number of buckets. It needs no network access, which makes it the default
+// and the embedder used in offline tests.
+type HashEmbedder struct {
+	dimensions int
+}
+
+// NewHashEmbedder creates a hashing embedder with the given number of dimensions
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	if dimensions <= 0 {
+		dimensions = 512
+	}
+	return &HashEmbedder{dimensions: dimensions}
+}
+
+// Name returns the name of the embedder including its dimensions
+func (e *HashEmbedder) Name() string {
+	return fmt.Sprintf("%s-%d", HashEmbedderName, e.dimensions)
+}
+
+// Embed hashes each text into a normalized vector
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, e.dimensions)
+		for _, word := range Tokenize(text) {
+			// 単語そのものを重く、文字トライグラムで表記揺れを拾う
+			e.add(vector, "w:"+word, 1)
+			padded := "^" + word + "$"
+			for j := 0; j+3 <= len(padded); j++ {
+				e.add(vector, "t:"+padded[j:j+3], 0.25)
+			}
+		}
+		normalize(vector)
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// add adds a weighted feature to the bucket chosen by its hash. The sign is
+// taken from the hash as well so that collisions cancel out on average.
+func (e *HashEmbedder) add(vector []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum&1 == 1 {
+		weight = -weight
+	}
+	vector[(sum>>1)%uint64(len(vector))] += weight
+}
+
+// stopWords are words that carry no meaning in code search queries
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "where": true,
+	"what": true, "which": true, "how": true, "does": true, "are": true,
+	"is": true, "do": true, "we": true, "our": true, "in": true, "of": true,
+	"to": true, "a": true, "an": true, "it": true, "be": true, "on": true,
+	"this": true, "that": true, "from": true, "func": true, "return": true,
+	"if": true, "err": true, "nil": true,
+}
+
+// Tokenize splits text into lower-case words, breaking identifiers at
+// camelCase and snake_case boundaries and dropping stop words. Plural
+// endings are removed so that "titles" matches "Title".
+func Tokenize(text string) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		word := strings.ToLower(string(current))
+		current = current[:0]
+		if len(word) < 2 || stopWords[word] {
+			return
+		}
+		if len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") {
+			word = word[:len(word)-1]
+		}
+		words = append(words, word)
+	}
+
+	runes := []rune(text)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		// camelCase の境界（小文字→大文字、または "HTTPServer" の "PS"）で区切る
+		if unicode.IsUpper(r) && len(current) > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+	return words
+}
+
+// normalize scales a vector to unit length
+func normalize(vector []float32) {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
+
+// EmbeddingClient is an API client that can create embeddings, such as
+// llm.OpenAI
+type EmbeddingClient interface {
+	CreateEmbeddings(ctx context.Context, req openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error)
+}
+
+// APIEmbedder creates embeddings through an OpenAI-compatible embeddings API
+type APIEmbedder struct {
+	client     EmbeddingClient
+	model      string
+	dimensions int
+}
+
+// NewAPIEmbedder creates an embedder that calls the embeddings API. A
+// dimensions value of 0 uses the model default.
+func NewAPIEmbedder(client EmbeddingClient, model string, dimensions int) *APIEmbedder {
+	return &APIEmbedder{client: client, model: model, dimensions: dimensions}
+}
+
+// Name returns the embedding model and its dimensions
+func (e *APIEmbedder) Name() string {
+	if e.dimensions > 0 {
+		return fmt.Sprintf("%s-%d", e.model, e.dimensions)
+	}
+	return e.model
+}
+
+// Embed sends the texts to the embeddings API in one request
+func (e *APIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input:      texts,
+		Model:      openai.EmbeddingModel(e.model),
+		Dimensions: e.dimensions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding API returned %d vectors for %d texts", len(resp.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding API returned an invalid index %d", data.Index)
+		}
+		vectors[data.Index] = data.Embedding
+	}
+	return vectors, nil
+}
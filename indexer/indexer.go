@@ -0,0 +1,278 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"nebula/memory"
+	"nebula/project"
+	"nebula/repomap"
+)
+
+// Indexing limits
+const (
+	maxFileSize      = 512 * 1024 // これより大きいファイルは生成コードとみなして索引しない
+	embedBatchSize   = 32         // 1回の埋め込みリクエストに含めるチャンク数
+	maxEmbedTextSize = 8000       // 埋め込むテキストの最大バイト数
+)
+
+// Store keeps the chunks and their vectors between sessions
+type Store interface {
+	GetIndexedFiles(projectPath string) ([]memory.IndexedFile, error)
+	ReplaceFileChunks(projectPath string, file memory.IndexedFile, chunks []memory.CodeChunk) error
+	DeleteIndexedFiles(projectPath string, paths []string) error
+	GetCodeChunks(projectPath string) ([]memory.CodeChunk, error)
+}
+
+// Indexer maintains a semantic search index of the source files of a
+// project. Only files that changed since the last update are embedded again,
+// and searches query the chunks cached by the last update.
+type Indexer struct {
+	root     string
+	store    Store
+	embedder Embedder
+	updateMu sync.Mutex         // Updateを直列化する（検索は更新の完了を待たない）
+	mu       sync.Mutex         // chunksとloadedを保護する
+	chunks   []memory.CodeChunk // 検索に使うチャンク（変更があった更新のたびに読み直す）
+	loaded   bool
+}
+
+// Stats reports what an update did
+type Stats struct {
+	Files   int // 索引に含まれるファイル数
+	Indexed int // 新しく索引したファイル数
+	Removed int // 索引から削除したファイル数
+	Chunks  int // 索引に含まれるチャンク数
+}
+
+// Result is a chunk that matched a search query
+type Result struct {
+	Path      string  `json:"path"`
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Symbol    string  `json:"symbol,omitempty"`
+	Score     float64 `json:"score"`
+	Content   string  `json:"content"`
+}
+
+// New creates an indexer for a project root
+func New(root string, store Store, embedder Embedder) *Indexer {
+	return &Indexer{root: root, store: store, embedder: embedder}
+}
+
+// Embedder returns the embedder used by the index
+func (ix *Indexer) Embedder() Embedder {
+	return ix.embedder
+}
+
+// Update indexes new and changed files and removes deleted ones
+func (ix *Indexer) Update(ctx context.Context) (Stats, error) {
+	ix.updateMu.Lock()
+	defer ix.updateMu.Unlock()
+
+	var stats Stats
+
+	indexed, err := ix.store.GetIndexedFiles(ix.root)
+	if err != nil {
+		return stats, err
+	}
+	known := make(map[string]memory.IndexedFile)
+	for _, file := range indexed {
+		known[file.Path] = file
+	}
+
+	// 追加・変更されたファイルを探す
+	embedderName := ix.embedder.Name()
+	ignore := project.LoadIgnore(ix.root)
+	seen := make(map[string]bool)
+	var changed []memory.IndexedFile
+	err = filepath.WalkDir(ix.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if entry != nil && entry.IsDir() && path != ix.root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if path == ix.root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(ix.root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ignore.Match(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() || !repomap.Supported(rel) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.Size() > maxFileSize {
+			return nil
+		}
+		seen[rel] = true
+
+		file := memory.IndexedFile{Path: rel, ModTime: info.ModTime().UnixNano(), Size: info.Size(), Embedder: embedderName}
+		if previous, ok := known[rel]; !ok || previous != file {
+			changed = append(changed, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to scan project: %w", err)
+	}
+
+	for _, file := range changed {
+		if err := ix.indexFile(ctx, file); err != nil {
+			return stats, err
+		}
+	}
+
+	var removed []string
+	for path := range known {
+		if !seen[path] {
+			removed = append(removed, path)
+		}
+	}
+	if len(removed) > 0 {
+		if err := ix.store.DeleteIndexedFiles(ix.root, removed); err != nil {
+			return stats, err
+		}
+	}
+
+	// 変更があった場合だけ検索用のチャンクを読み直す
+	chunks, err := ix.cachedChunks(len(changed) > 0 || len(removed) > 0)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Files = len(seen)
+	stats.Indexed = len(changed)
+	stats.Removed = len(removed)
+	stats.Chunks = len(chunks)
+	return stats, nil
+}
+
+// cachedChunks returns the chunks used by searches, reading them from the
+// store when they have not been loaded yet or reload is set
+func (ix *Indexer) cachedChunks(reload bool) ([]memory.CodeChunk, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.loaded && !reload {
+		return ix.chunks, nil
+	}
+	chunks, err := ix.store.GetCodeChunks(ix.root)
+	if err != nil {
+		return nil, err
+	}
+	ix.chunks = chunks
+	ix.loaded = true
+	return chunks, nil
+}
+
+// indexFile chunks and embeds a single file
+func (ix *Indexer) indexFile(ctx context.Context, file memory.IndexedFile) error {
+	src, err := os.ReadFile(filepath.Join(ix.root, filepath.FromSlash(file.Path)))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file.Path, err)
+	}
+
+	chunks := ChunkFile(file.Path, src)
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(chunks))
+
+		texts := make([]string, 0, end-start)
+		for _, chunk := range chunks[start:end] {
+			texts = append(texts, embeddingText(chunk))
+		}
+		vectors, err := ix.embedder.Embed(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("failed to embed %s: %w", file.Path, err)
+		}
+		for i, vector := range vectors {
+			chunks[start+i].Embedding = vector
+		}
+	}
+
+	return ix.store.ReplaceFileChunks(ix.root, file, chunks)
+}
+
+// embeddingText is the text embedded for a chunk. The path and symbol name
+// are included because they often carry the meaning a question refers to.
+func embeddingText(chunk memory.CodeChunk) string {
+	text := chunk.Path + " " + chunk.Symbol + "\n" + chunk.Content
+	if len(text) > maxEmbedTextSize {
+		text = text[:maxEmbedTextSize]
+	}
+	return text
+}
+
+// Search returns the indexed chunks most similar to the query. It does not
+// scan the project; files changed since the last Update are not reflected.
+func (ix *Indexer) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	chunks, err := ix.cachedChunks(false)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	vectors, err := ix.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	var results []Result
+	for _, chunk := range chunks {
+		score := cosine(vectors[0], chunk.Embedding)
+		if score <= 0 {
+			continue
+		}
+		results = append(results, Result{
+			Path:      chunk.Path,
+			StartLine: chunk.StartLine,
+			EndLine:   chunk.EndLine,
+			Symbol:    chunk.Symbol,
+			Score:     score,
+			Content:   chunk.Content,
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// cosine returns the cosine similarity of two vectors, or 0 when their
+// dimensions differ
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,390 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"nebula/memory"
+)
+
+const todoFixture = `package todo
+
+import (
+	"errors"
+	"strings"
+)
+
+// Todo is an item of the todo list
+type Todo struct {
+	Title string
+	Done  bool
+}
+
+// validateTitle checks that a todo title is not empty and not too long
+func validateTitle(title string) error {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return errors.New("title is required")
+	}
+	if len(title) > 100 {
+		return errors.New("title is too long")
+	}
+	return nil
+}
+
+// saveTodos writes the todo list to disk
+func saveTodos(path string, todos []Todo) error {
+	return nil
+}
+`
+
+const serverFixture = `package server
+
+import "net/http"
+
+// startServer listens for HTTP requests on the given address
+func startServer(addr string) error {
+	return http.ListenAndServe(addr, nil)
+}
+
+// handleHealth reports that the server is running
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+`
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"validate todo titles", []string{"validate", "todo", "title"}},
+		{"validateTodoTitle", []string{"validate", "todo", "title"}},
+		{"max_tool_errors", []string{"max", "tool", "error"}},
+		{"HTTPServer", []string{"http", "server"}},
+		{"where is the config loaded from", []string{"config", "loaded"}},
+		{"class address", []string{"class", "address"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkFile(t *testing.T) {
+	chunks := ChunkFile("todo/todo.go", []byte(todoFixture))
+
+	// パッケージ宣言とimportの後に、ドキュメントコメントを含む宣言ごとのチャンクが続く
+	want := []struct {
+		symbol    string
+		startLine int
+		endLine   int
+	}{
+		{"", 1, 7},
+		{"Todo", 8, 13},
+		{"validateTitle", 14, 25},
+		{"saveTodos", 26, 30},
+	}
+	if len(chunks) != len(want) {
+		for _, c := range chunks {
+			t.Logf("%s %d-%d", c.Symbol, c.StartLine, c.EndLine)
+		}
+		t.Fatalf("got %d chunks, want %d", len(chunks), len(want))
+	}
+	for i, w := range want {
+		c := chunks[i]
+		if c.Path != "todo/todo.go" || c.Symbol != w.symbol || c.StartLine != w.startLine || c.EndLine != w.endLine {
+			t.Errorf("chunks[%d] = %s %s %d-%d, want %s %d-%d", i, c.Path, c.Symbol, c.StartLine, c.EndLine, w.symbol, w.startLine, w.endLine)
+		}
+	}
+	if !strings.HasPrefix(chunks[2].Content, "// validateTitle checks") {
+		t.Errorf("chunk of validateTitle does not start with its doc comment: %q", chunks[2].Content)
+	}
+}
+
+func TestChunkFileWindows(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		src        string
+		wantRanges [][2]int
+	}{
+		{
+			name:       "long function",
+			path:       "long.go",
+			src:        "package long\n\nfunc long() {\n" + strings.Repeat("\tx++\n", 100) + "}\n",
+			wantRanges: [][2]int{{1, 2}, {3, 62}, {63, 105}},
+		},
+		{
+			name:       "file without declarations",
+			path:       "notes.txt",
+			src:        strings.Repeat("note\n", 150),
+			wantRanges: [][2]int{{1, 60}, {61, 120}, {121, 151}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][2]int
+			for _, c := range ChunkFile(tt.path, []byte(tt.src)) {
+				got = append(got, [2]int{c.StartLine, c.EndLine})
+			}
+			if !reflect.DeepEqual(got, tt.wantRanges) {
+				t.Errorf("chunk ranges = %v, want %v", got, tt.wantRanges)
+			}
+		})
+	}
+}
+
+func TestHashEmbedder(t *testing.T) {
+	texts := []string{"validate todo titles", "func validateTitle(title string) error", ""}
+	first, err := NewHashEmbedder(256).Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewHashEmbedder(256).Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Error("embedding the same texts twice gave different vectors")
+	}
+
+	for i, vector := range first {
+		if len(vector) != 256 {
+			t.Fatalf("vector %d has %d dimensions, want 256", i, len(vector))
+		}
+		var sum float64
+		for _, v := range vector {
+			sum += float64(v) * float64(v)
+		}
+		// 空のテキストはゼロベクトル、それ以外は長さ1に正規化される
+		want := 1.0
+		if texts[i] == "" {
+			want = 0
+		}
+		if math.Abs(sum-want) > 1e-5 {
+			t.Errorf("squared norm of vector %d = %f, want %f", i, sum, want)
+		}
+	}
+
+	if got := NewHashEmbedder(0).Name(); got != "hash-512" {
+		t.Errorf("Name() = %q, want %q", got, "hash-512")
+	}
+}
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"same direction", []float32{1, 2, 3}, []float32{2, 4, 6}, 1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 1}, 0},
+		{"opposite", []float32{1, 1}, []float32{-1, -1}, -1},
+		{"different dimensions", []float32{1, 0}, []float32{1, 0, 0}, 0},
+		{"zero vector", []float32{0, 0}, []float32{1, 0}, 0},
+		{"empty", nil, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cosine(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("cosine = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestIndexer writes files into a temporary project and returns an indexer
+// backed by a temporary memory database
+func newTestIndexer(t *testing.T, files map[string]string) (*Indexer, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		writeFixture(t, root, name, content)
+	}
+
+	store, err := memory.NewManager(filepath.Join(t.TempDir(), "memory.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return New(root, store, NewHashEmbedder(512)), root
+}
+
+func writeFixture(t *testing.T, root, name, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSearchRanking checks that the validating function ranks first for a
+// question about validating todo titles
+func TestSearchRanking(t *testing.T) {
+	ix, _ := newTestIndexer(t, map[string]string{
+		"todo/todo.go":     todoFixture,
+		"server/server.go": serverFixture,
+	})
+	if _, err := ix.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query      string
+		wantPath   string
+		wantSymbol string
+	}{
+		{"validate todo titles", "todo/todo.go", "validateTitle"},
+		{"where do we start the http server", "server/server.go", "startServer"},
+		{"health check handler", "server/server.go", "handleHealth"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := ix.Search(context.Background(), tt.query, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) == 0 {
+				t.Fatal("got no results")
+			}
+			if len(results) > 3 {
+				t.Errorf("got %d results, want at most 3", len(results))
+			}
+			if got := results[0]; got.Path != tt.wantPath || got.Symbol != tt.wantSymbol {
+				var ranking []string
+				for _, r := range results {
+					ranking = append(ranking, fmt.Sprintf("%s:%s(%.3f)", r.Path, r.Symbol, r.Score))
+				}
+				t.Errorf("top result = %s:%s, want %s:%s (ranking %v)", got.Path, got.Symbol, tt.wantPath, tt.wantSymbol, ranking)
+			}
+			for i := 1; i < len(results); i++ {
+				if results[i].Score > results[i-1].Score {
+					t.Errorf("results are not sorted by score: %f before %f", results[i-1].Score, results[i].Score)
+				}
+			}
+		})
+	}
+}
+
+// TestUpdate checks that only new and changed files are embedded again
+func TestUpdate(t *testing.T) {
+	ix, root := newTestIndexer(t, map[string]string{
+		"todo/todo.go":     todoFixture,
+		"server/server.go": serverFixture,
+		"README.txt":       "not a source file\n",
+	})
+	ctx := context.Background()
+
+	stats, err := ix.Update(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 2 || stats.Indexed != 2 || stats.Removed != 0 || stats.Chunks != 7 {
+		t.Errorf("first update = %+v, want 2 files, 2 indexed, 0 removed, 7 chunks", stats)
+	}
+
+	stats, err = ix.Update(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Indexed != 0 || stats.Removed != 0 {
+		t.Errorf("update without changes = %+v, want nothing indexed or removed", stats)
+	}
+
+	writeFixture(t, root, "server/server.go", serverFixture+"\n// stopServer shuts the server down\nfunc stopServer() {}\n")
+	if err := os.Remove(filepath.Join(root, "todo", "todo.go")); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = ix.Update(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 1 || stats.Indexed != 1 || stats.Removed != 1 || stats.Chunks != 4 {
+		t.Errorf("update after changes = %+v, want 1 file, 1 indexed, 1 removed, 4 chunks", stats)
+	}
+
+	results, err := ix.Search(ctx, "validate todo titles", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Path == "todo/todo.go" {
+			t.Errorf("search returned a chunk of a deleted file: %s:%s", r.Path, r.Symbol)
+		}
+	}
+}
+
+// TestSearchUsesCachedIndex checks that searches query the chunks of the last
+// update without scanning the project, and that a new indexer reads them back
+// from the store
+func TestSearchUsesCachedIndex(t *testing.T) {
+	ix, root := newTestIndexer(t, map[string]string{"server/server.go": serverFixture})
+	ctx := context.Background()
+
+	results, err := ix.Search(ctx, "start the http server", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("search before any update returned %d results, want 0", len(results))
+	}
+
+	if _, err := ix.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	writeFixture(t, root, "todo/todo.go", todoFixture)
+
+	// 更新するまで新しいファイルは検索されない
+	if hasSymbol(t, ix, "validate todo titles", "validateTitle") {
+		t.Error("search found a file added after the last update")
+	}
+	if !hasSymbol(t, ix, "start the http server", "startServer") {
+		t.Error("search did not find an indexed chunk")
+	}
+
+	if _, err := ix.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !hasSymbol(t, ix, "validate todo titles", "validateTitle") {
+		t.Error("search did not find a file indexed by the update")
+	}
+
+	// 同じストアを使う新しいIndexerは更新しなくても保存済みの索引を検索できる
+	reopened := New(root, ix.store, ix.embedder)
+	if !hasSymbol(t, reopened, "validate todo titles", "validateTitle") {
+		t.Error("search did not read the stored index")
+	}
+}
+
+// hasSymbol reports whether a search for the query returns a chunk of the symbol
+func hasSymbol(t *testing.T, ix *Indexer, query, symbol string) bool {
+	t.Helper()
+	results, err := ix.Search(context.Background(), query, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Symbol == symbol {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"nebula/config"
+	"nebula/indexer"
+	"nebula/llm"
+)
+
+// defaultEmbeddingModel はembedding.modelを省略したときの埋め込みモデル
+const defaultEmbeddingModel = "text-embedding-3-small"
+
+// newEmbedder は設定に応じてセマンティック検索の埋め込みを作成する
+func newEmbedder(cfg *config.Config) (indexer.Embedder, error) {
+	embedding := cfg.Embedding
+	if embedding.Provider == "" || embedding.Provider == indexer.HashEmbedderName {
+		return indexer.NewHashEmbedder(embedding.Dimensions), nil
+	}
+
+	providerCfg, err := cfg.GetProvider(embedding.Provider)
+	if err != nil {
+		return nil, err
+	}
+	// 埋め込みAPIはOpenAI互換のプロバイダーだけが提供している
+	if providerCfg.Type != llm.TypeOpenAI {
+		return nil, fmt.Errorf("provider %s (%s) does not support embeddings", embedding.Provider, providerCfg.Type)
+	}
+	apiKey := providerCfg.APIKey()
+	if providerCfg.APIKeyEnv != "" && apiKey == "" {
+		return nil, fmt.Errorf("%s environment variable is not set (export %s=your_api_key_here)", providerCfg.APIKeyEnv, providerCfg.APIKeyEnv)
+	}
+
+	model := embedding.Model
+	if model == "" {
+		model = defaultEmbeddingModel
+	}
+	client := llm.NewOpenAI(embedding.Provider, apiKey, providerCfg.BaseURL, providerCfg.Headers)
+	return indexer.NewAPIEmbedder(client, model, embedding.Dimensions), nil
+}
+
+// handleIndexCommand updates the semantic search index and prints what changed
+func handleIndexCommand(ix *indexer.Indexer) {
+	fmt.Printf("Indexing with %s...\n", ix.Embedder().Name())
+	start := time.Now()
+	stats, err := ix.Update(context.Background())
+	if err != nil {
+		fmt.Printf("Error updating index: %v\n", err)
+		return
+	}
+	fmt.Printf("Indexed %d files (%d chunks): %d updated, %d removed in %s\n",
+		stats.Files, stats.Chunks, stats.Indexed, stats.Removed, time.Since(start).Round(time.Millisecond))
+}
+
+// refreshIndex updates the semantic search index at session start. It runs in
+// the background, so only failures are printed.
+func refreshIndex(ix *indexer.Indexer) {
+	if _, err := ix.Update(context.Background()); err != nil {
+		fmt.Printf("\nError updating index: %v (run 'index' to retry)\n", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"nebula/config"
+	"nebula/memory"
+	"nebula/project"
+	"nebula/repomap"
+	"nebula/tools"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// projectInstructions はシステムプロンプトに追加するNEBULA.mdの内容
+var projectInstructions []project.Instructions
+
+// projectSnapshot はセッション開始時に作成したプロジェクトの概要
+var projectSnapshot string
+
+// projectRepoMap はセッション開始時に作成したリポジトリマップ
+var projectRepoMap string
+
+// initPrompt はinitコマンドでエージェントに渡す指示
+const initPrompt = `Explore this repository and draft a %s file at the project root (%s).
+Use the read-only tools first: list the top-level directories, read the README and the build files, and look at a few representative source files.
+The file is read by coding agents at the start of every session, so keep it short and specific to this project. Cover:
+- what the project is and how the code is organized
+- how to build, run and test it (exact commands)
+- coding conventions that are not obvious from a single file (naming, error handling, comments, test layout)
+- anything an agent must not do in this repository
+%s`
+
+// loadProjectInstructions はプロジェクトルートと親ディレクトリ、グローバル設定のNEBULA.mdを読み込む
+func loadProjectInstructions(root string) {
+	instructions, err := project.LoadInstructions(root)
+	if err != nil {
+		fmt.Printf("Error loading project instructions: %v\n", err)
+		return
+	}
+	projectInstructions = instructions
+}
+
+// loadProjectSnapshot はプロジェクトの概要を作成する（budgetが0の場合は作成しない）
+func loadProjectSnapshot(root string, budget int) {
+	if budget <= 0 {
+		projectSnapshot = ""
+		return
+	}
+	snapshot, err := project.BuildSnapshot(root)
+	if err != nil {
+		fmt.Printf("Error building project snapshot: %v\n", err)
+		return
+	}
+	projectSnapshot = snapshot.Format(budget)
+}
+
+// loadRepoMapContext はシステムプロンプトに含めるリポジトリマップを作成する（budgetが0の場合は作成しない）
+func loadRepoMapContext(repoMap *repomap.RepoMap, budget int) {
+	if budget <= 0 {
+		projectRepoMap = ""
+		return
+	}
+	rendered, err := repoMap.Render(budget, nil)
+	if err != nil {
+		fmt.Printf("Error building repository map: %v\n", err)
+		return
+	}
+	projectRepoMap = rendered
+}
+
+// effectiveSystemPrompt は共通のシステムプロンプトにプロジェクトの概要・リポジトリマップ・指示を加えたものを返す
+func effectiveSystemPrompt() string {
+	prompt := getSystemPrompt()
+	if projectSnapshot != "" {
+		prompt += "\n\n" + projectSnapshot
+	}
+	if projectRepoMap != "" {
+		prompt += "\n\n" + projectRepoMap
+	}
+	if instructions := project.FormatInstructions(projectInstructions); instructions != "" {
+		prompt += "\n\n" + instructions
+	}
+	return prompt
+}
+
+// refreshSystemPrompt は履歴の先頭のシステムプロンプトを最新の内容に置き換える
+func refreshSystemPrompt(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if len(messages) > 0 && messages[0].Role == openai.ChatMessageRoleSystem {
+		messages[0].Content = effectiveSystemPrompt()
+	}
+	return messages
+}
+
+// handlePromptShow prints the system prompt sent to the model
+func handlePromptShow(planMode bool) {
+	if len(projectInstructions) == 0 {
+		fmt.Printf("Project instructions: none (create %s with 'init')\n", project.InstructionsFileName)
+	} else {
+		fmt.Println("Project instructions (in order):")
+		for _, inst := range projectInstructions {
+			fmt.Printf("  %s\n", inst.Path)
+		}
+	}
+	fmt.Println("---")
+	fmt.Println(effectiveSystemPrompt())
+	if planMode {
+		fmt.Println()
+		fmt.Println(planModeInstructions)
+	}
+	fmt.Println("---")
+}
+
+// handleInit はエージェントにリポジトリを調べさせてNEBULA.mdの下書きを作らせる
+func handleInit(router *modelRouter, cfg *config.Config, memoryManager *memory.Manager, toolsMap map[string]tools.ToolDefinition, messages []openai.ChatCompletionMessage, root string) []openai.ChatCompletionMessage {
+	path := filepath.Join(root, project.InstructionsFileName)
+
+	// 既存のファイルがある場合は書き直しではなく改善を依頼する
+	action := "Create it with 'writeFile'. The user will review the content before it is written."
+	if _, err := os.Stat(path); err == nil {
+		action = "The file already exists. Read it first and improve it with 'editFile' instead of replacing it; keep the parts that are still accurate."
+	}
+
+	fmt.Printf("Drafting %s...\n", path)
+	messages, _ = handleConversation(router, cfg, memoryManager, toolsMap, fmt.Sprintf(initPrompt, project.InstructionsFileName, path, action), messages, false)
+
+	// 書き込まれた内容をシステムプロンプトに反映
+	loadProjectInstructions(root)
+	return refreshSystemPrompt(messages)
+}
@@ -0,0 +1,472 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	anthropicDefaultBaseURL   = "https://api.anthropic.com/v1"
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096
+)
+
+// cacheWriteTokensHeader carries the prompt tokens written to the prompt cache.
+// OpenAI usage has no field for them, so the Anthropic provider reports them
+// in a header of the converted response.
+const cacheWriteTokensHeader = "Nebula-Cache-Write-Tokens"
+
+// CacheWriteTokens returns how many of the prompt tokens of a response were
+// written to the prompt cache. Providers that do not report them return 0.
+func CacheWriteTokens(resp openai.ChatCompletionResponse) int {
+	tokens, _ := strconv.Atoi(resp.Header().Get(cacheWriteTokensHeader))
+	return tokens
+}
+
+// Anthropic talks to the Anthropic Messages API. OpenAI-style messages and
+// tool calls are translated to content blocks and back.
+type Anthropic struct {
+	name       string
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewAnthropic creates an Anthropic provider. An empty baseURL uses the official API.
+func NewAnthropic(name, apiKey, baseURL string, headers map[string]string) *Anthropic {
+	if baseURL == "" {
+		baseURL = anthropicDefaultBaseURL
+	}
+	return &Anthropic{
+		name:       name,
+		apiKey:     apiKey,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: newHTTPClient(headers),
+	}
+}
+
+// anthropicRequest is the body of a Messages API request
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float32           `json:"temperature,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+// anthropicMessage is a user or assistant turn made of content blocks
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a text, tool_use or tool_result content block
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+// anthropicTool is a tool definition
+type anthropicTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+// anthropicResponse is the body of a Messages API response
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+// anthropicUsage is the token usage of a response
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// anthropicError is the body of an error response or error event
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Name returns the configured name of the provider
+func (p *Anthropic) Name() string {
+	return p.name
+}
+
+// CreateChatCompletion sends a request and waits for the whole response
+func (p *Anthropic) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	body, err := p.send(ctx, req, false)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer body.Close()
+
+	var resp anthropicResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("failed to decode anthropic response: %w", err)
+	}
+
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			message.Content += block.Text
+		case "tool_use":
+			message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+				ID:   block.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      block.Name,
+					Arguments: string(block.Input),
+				},
+			})
+		}
+	}
+
+	completion := openai.ChatCompletionResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      message,
+			FinishReason: toFinishReason(resp.StopReason),
+		}},
+		Usage: toOpenAIUsage(resp.Usage),
+	}
+	completion.SetHeader(http.Header{cacheWriteTokensHeader: {strconv.Itoa(resp.Usage.CacheCreationInputTokens)}})
+	return completion, nil
+}
+
+// CreateChatCompletionStream sends a request and streams the response
+func (p *Anthropic) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	body, err := p.send(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	return &anthropicStream{
+		body:      body,
+		reader:    bufio.NewReader(body),
+		toolIndex: make(map[int]int),
+	}, nil
+}
+
+// send posts a request to the Messages API and returns the response body
+func (p *Anthropic) send(ctx context.Context, req openai.ChatCompletionRequest, stream bool) (io.ReadCloser, error) {
+	payload, err := json.Marshal(toAnthropicRequest(req, stream))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode anthropic request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	if p.apiKey != "" {
+		httpReq.Header.Set("x-api-key", p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		var apiErr anthropicError
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			return nil, fmt.Errorf("anthropic API error (%d %s): %s", resp.StatusCode, apiErr.Error.Type, apiErr.Error.Message)
+		}
+		return nil, fmt.Errorf("anthropic API error (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	return resp.Body, nil
+}
+
+// toAnthropicRequest converts an OpenAI chat request. System messages become
+// the system prompt, and tool results are sent back as tool_result blocks in
+// a user turn.
+func toAnthropicRequest(req openai.ChatCompletionRequest, stream bool) anthropicRequest {
+	out := anthropicRequest{
+		Model:     req.Model,
+		MaxTokens: anthropicDefaultMaxTokens,
+		Stream:    stream,
+	}
+	if req.MaxCompletionTokens > 0 {
+		out.MaxTokens = req.MaxCompletionTokens
+	} else if req.MaxTokens > 0 {
+		out.MaxTokens = req.MaxTokens
+	}
+	if req.Temperature != 0 {
+		temperature := req.Temperature
+		out.Temperature = &temperature
+	}
+
+	var system []string
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleDeveloper:
+			system = append(system, msg.Content)
+		case openai.ChatMessageRoleTool:
+			out.Messages = appendAnthropicBlocks(out.Messages, "user", anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+			})
+		case openai.ChatMessageRoleAssistant:
+			var blocks []anthropicBlock
+			if msg.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: input,
+				})
+			}
+			out.Messages = appendAnthropicBlocks(out.Messages, "assistant", blocks...)
+		default:
+			if msg.Content != "" {
+				out.Messages = appendAnthropicBlocks(out.Messages, "user", anthropicBlock{Type: "text", Text: msg.Content})
+			}
+		}
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	for _, tool := range req.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		schema := tool.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		out.Tools = append(out.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	return out
+}
+
+// appendAnthropicBlocks adds blocks to the conversation, merging them into the
+// previous turn when it has the same role (the API requires alternating roles)
+func appendAnthropicBlocks(messages []anthropicMessage, role string, blocks ...anthropicBlock) []anthropicMessage {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content = append(messages[n-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, anthropicMessage{Role: role, Content: blocks})
+}
+
+// toFinishReason maps an Anthropic stop reason to the OpenAI finish reason
+func toFinishReason(stopReason string) openai.FinishReason {
+	switch stopReason {
+	case "tool_use":
+		return openai.FinishReasonToolCalls
+	case "max_tokens":
+		return openai.FinishReasonLength
+	case "":
+		return ""
+	default:
+		return openai.FinishReasonStop
+	}
+}
+
+// toOpenAIUsage maps Anthropic token usage. Cached input is reported as part
+// of the prompt tokens like OpenAI does. Cache writes are also prompt tokens;
+// CacheWriteTokens reports them so that they can be priced separately.
+func toOpenAIUsage(usage anthropicUsage) openai.Usage {
+	prompt := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	return openai.Usage{
+		PromptTokens:        prompt,
+		CompletionTokens:    usage.OutputTokens,
+		TotalTokens:         prompt + usage.OutputTokens,
+		PromptTokensDetails: &openai.PromptTokensDetails{CachedTokens: usage.CacheReadInputTokens},
+	}
+}
+
+// anthropicStreamEvent is a server-sent event of a streamed response
+type anthropicStreamEvent struct {
+	Type         string             `json:"type"`
+	Index        int                `json:"index"`
+	Message      *anthropicResponse `json:"message"`
+	ContentBlock *anthropicBlock    `json:"content_block"`
+	Delta        *struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicStream converts server-sent events to OpenAI stream chunks
+type anthropicStream struct {
+	body      io.ReadCloser
+	reader    *bufio.Reader
+	id        string
+	model     string
+	usage     anthropicUsage
+	toolIndex map[int]int // content block index -> tool call index
+}
+
+// Recv returns the next chunk, or io.EOF when the message is complete
+func (s *anthropicStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	for {
+		data, err := s.readEvent()
+		if err != nil {
+			return openai.ChatCompletionStreamResponse{}, err
+		}
+
+		var event anthropicStreamEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return openai.ChatCompletionStreamResponse{}, fmt.Errorf("failed to decode anthropic stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				s.id = event.Message.ID
+				s.model = event.Message.Model
+				s.usage = event.Message.Usage
+			}
+			return s.chunk(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, ""), nil
+		case "content_block_start":
+			if event.ContentBlock == nil || event.ContentBlock.Type != "tool_use" {
+				continue
+			}
+			index := len(s.toolIndex)
+			s.toolIndex[event.Index] = index
+			return s.chunk(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+				Index:    &index,
+				ID:       event.ContentBlock.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: event.ContentBlock.Name},
+			}}}, ""), nil
+		case "content_block_delta":
+			if event.Delta == nil {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				return s.chunk(openai.ChatCompletionStreamChoiceDelta{Content: event.Delta.Text}, ""), nil
+			case "input_json_delta":
+				index, ok := s.toolIndex[event.Index]
+				if !ok {
+					continue
+				}
+				return s.chunk(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+					Index:    &index,
+					Function: openai.FunctionCall{Arguments: event.Delta.PartialJSON},
+				}}}, ""), nil
+			}
+		case "message_delta":
+			if event.Usage != nil {
+				s.usage.OutputTokens = event.Usage.OutputTokens
+			}
+			stopReason := ""
+			if event.Delta != nil {
+				stopReason = event.Delta.StopReason
+			}
+			chunk := s.chunk(openai.ChatCompletionStreamChoiceDelta{}, toFinishReason(stopReason))
+			usage := toOpenAIUsage(s.usage)
+			chunk.Usage = &usage
+			return chunk, nil
+		case "message_stop":
+			return openai.ChatCompletionStreamResponse{}, io.EOF
+		case "error":
+			if event.Error != nil {
+				return openai.ChatCompletionStreamResponse{}, fmt.Errorf("anthropic stream error (%s): %s", event.Error.Type, event.Error.Message)
+			}
+			return openai.ChatCompletionStreamResponse{}, fmt.Errorf("anthropic stream error")
+		}
+	}
+}
+
+// Close releases the underlying connection
+func (s *anthropicStream) Close() error {
+	return s.body.Close()
+}
+
+// readEvent reads the data of the next server-sent event
+func (s *anthropicStream) readEvent() ([]byte, error) {
+	var data []byte
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF && len(data) > 0 {
+				return data, nil
+			}
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if len(data) > 0 {
+				return data, nil
+			}
+			continue
+		}
+		if payload, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimSpace(payload)...)
+		}
+	}
+}
+
+// chunk builds a stream chunk with a single choice
+func (s *anthropicStream) chunk(delta openai.ChatCompletionStreamChoiceDelta, finishReason openai.FinishReason) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{
+		ID:     s.id,
+		Object: "chat.completion.chunk",
+		Model:  s.model,
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta:        delta,
+			FinishReason: finishReason,
+		}},
+	}
+}
@@ -0,0 +1,425 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// assertJSON compares the JSON encoding of got with the expected JSON
+func assertJSON(t *testing.T, got any, want string) {
+	t.Helper()
+	gotJSON, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotValue, wantValue any
+	if err := json.Unmarshal(gotJSON, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid expected JSON: %v", err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got  %s\nwant %s", gotJSON, want)
+	}
+}
+
+func TestToAnthropicRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    openai.ChatCompletionRequest
+		stream bool
+		want   string
+	}{
+		{
+			name: "system messages become the system prompt",
+			req: openai.ChatCompletionRequest{
+				Model: "claude-sonnet-4",
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleSystem, Content: "You are nebula."},
+					{Role: openai.ChatMessageRoleDeveloper, Content: "PLAN mode."},
+					{Role: openai.ChatMessageRoleUser, Content: "hello"},
+				},
+			},
+			want: `{
+				"model": "claude-sonnet-4",
+				"system": "You are nebula.\n\nPLAN mode.",
+				"messages": [{"role": "user", "content": [{"type": "text", "text": "hello"}]}],
+				"max_tokens": 4096
+			}`,
+		},
+		{
+			name: "max tokens, temperature and stream",
+			req: openai.ChatCompletionRequest{
+				Model:               "claude-sonnet-4",
+				MaxTokens:           100,
+				MaxCompletionTokens: 200,
+				Temperature:         0.5,
+				Messages:            []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+			},
+			stream: true,
+			want: `{
+				"model": "claude-sonnet-4",
+				"messages": [{"role": "user", "content": [{"type": "text", "text": "hi"}]}],
+				"max_tokens": 200,
+				"temperature": 0.5,
+				"stream": true
+			}`,
+		},
+		{
+			name: "tool calls and results become tool_use and tool_result blocks",
+			req: openai.ChatCompletionRequest{
+				Model: "claude-sonnet-4",
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleUser, Content: "read both files"},
+					{
+						Role:    openai.ChatMessageRoleAssistant,
+						Content: "Reading them.",
+						ToolCalls: []openai.ToolCall{
+							{ID: "toolu_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "readFile", Arguments: `{"path":"a.go"}`}},
+							{ID: "toolu_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "readFile", Arguments: `{"path":`}},
+						},
+					},
+					{Role: openai.ChatMessageRoleTool, ToolCallID: "toolu_1", Content: `{"content":"package a"}`},
+					{Role: openai.ChatMessageRoleTool, ToolCallID: "toolu_2", Content: `{"error":"invalid arguments"}`},
+					{Role: openai.ChatMessageRoleUser, Content: "thanks"},
+				},
+			},
+			want: `{
+				"model": "claude-sonnet-4",
+				"messages": [
+					{"role": "user", "content": [{"type": "text", "text": "read both files"}]},
+					{"role": "assistant", "content": [
+						{"type": "text", "text": "Reading them."},
+						{"type": "tool_use", "id": "toolu_1", "name": "readFile", "input": {"path": "a.go"}},
+						{"type": "tool_use", "id": "toolu_2", "name": "readFile", "input": {}}
+					]},
+					{"role": "user", "content": [
+						{"type": "tool_result", "tool_use_id": "toolu_1", "content": "{\"content\":\"package a\"}"},
+						{"type": "tool_result", "tool_use_id": "toolu_2", "content": "{\"error\":\"invalid arguments\"}"},
+						{"type": "text", "text": "thanks"}
+					]}
+				],
+				"max_tokens": 4096
+			}`,
+		},
+		{
+			name: "empty messages are dropped and same roles are merged",
+			req: openai.ChatCompletionRequest{
+				Model: "claude-sonnet-4",
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleUser, Content: "first"},
+					{Role: openai.ChatMessageRoleUser, Content: ""},
+					{Role: openai.ChatMessageRoleUser, Content: "second"},
+					{Role: openai.ChatMessageRoleAssistant, Content: ""},
+				},
+			},
+			want: `{
+				"model": "claude-sonnet-4",
+				"messages": [{"role": "user", "content": [{"type": "text", "text": "first"}, {"type": "text", "text": "second"}]}],
+				"max_tokens": 4096
+			}`,
+		},
+		{
+			name: "tools use their parameters as the input schema",
+			req: openai.ChatCompletionRequest{
+				Model:    "claude-sonnet-4",
+				Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+				Tools: []openai.Tool{
+					{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+						Name:        "readFile",
+						Description: "Read a file",
+						Parameters: jsonschema.Definition{
+							Type:       jsonschema.Object,
+							Properties: map[string]jsonschema.Definition{"path": {Type: jsonschema.String}},
+							Required:   []string{"path"},
+						},
+					}},
+					{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "todoRead"}},
+					{Type: openai.ToolTypeFunction},
+				},
+			},
+			want: `{
+				"model": "claude-sonnet-4",
+				"messages": [{"role": "user", "content": [{"type": "text", "text": "hi"}]}],
+				"tools": [
+					{"name": "readFile", "description": "Read a file", "input_schema": {"type": "object", "properties": {"path": {"type": "string"}}, "required": ["path"]}},
+					{"name": "todoRead", "input_schema": {"type": "object"}}
+				],
+				"max_tokens": 4096
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertJSON(t, toAnthropicRequest(tt.req, tt.stream), tt.want)
+		})
+	}
+}
+
+func TestAnthropicCreateChatCompletion(t *testing.T) {
+	var gotHeader http.Header
+	var gotBody anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("request path = %s, want /messages", r.URL.Path)
+		}
+		gotHeader = r.Header
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, `{
+			"id": "msg_1",
+			"model": "claude-sonnet-4",
+			"content": [
+				{"type": "text", "text": "Let me read it."},
+				{"type": "tool_use", "id": "toolu_1", "name": "readFile", "input": {"path": "main.go"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 10, "output_tokens": 7, "cache_creation_input_tokens": 5, "cache_read_input_tokens": 20}
+		}`)
+	}))
+	defer server.Close()
+
+	p := NewAnthropic("anthropic", "secret", server.URL+"/", map[string]string{"X-Team": "platform"})
+	resp, err := p.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:    "claude-sonnet-4",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "read main.go"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{"x-api-key": "secret", "anthropic-version": anthropicVersion, "X-Team": "platform"} {
+		if got := gotHeader.Get(key); got != want {
+			t.Errorf("header %s = %q, want %q", key, got, want)
+		}
+	}
+	if gotBody.Stream {
+		t.Error("non-streaming request was sent with stream: true")
+	}
+
+	if len(resp.Choices) != 1 {
+		t.Fatalf("got %d choices, want 1", len(resp.Choices))
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason != openai.FinishReasonToolCalls {
+		t.Errorf("finish reason = %q, want %q", choice.FinishReason, openai.FinishReasonToolCalls)
+	}
+	if choice.Message.Content != "Let me read it." {
+		t.Errorf("content = %q", choice.Message.Content)
+	}
+	wantCalls := []openai.ToolCall{{ID: "toolu_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "readFile", Arguments: `{"path": "main.go"}`}}}
+	if !reflect.DeepEqual(choice.Message.ToolCalls, wantCalls) {
+		t.Errorf("tool calls = %+v, want %+v", choice.Message.ToolCalls, wantCalls)
+	}
+	if resp.Usage.PromptTokens != 35 || resp.Usage.CompletionTokens != 7 || resp.Usage.PromptTokensDetails.CachedTokens != 20 {
+		t.Errorf("usage = %+v (cached %d), want 35 prompt, 7 completion, 20 cached", resp.Usage, resp.Usage.PromptTokensDetails.CachedTokens)
+	}
+	if got := CacheWriteTokens(resp); got != 5 {
+		t.Errorf("cache write tokens = %d, want 5", got)
+	}
+}
+
+func TestAnthropicAPIError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "error object",
+			status:  http.StatusBadRequest,
+			body:    `{"type": "error", "error": {"type": "invalid_request_error", "message": "max_tokens is too large"}}`,
+			wantErr: "anthropic API error (400 invalid_request_error): max_tokens is too large",
+		},
+		{
+			name:    "plain body",
+			status:  http.StatusBadGateway,
+			body:    "upstream unavailable\n",
+			wantErr: "anthropic API error (502): upstream unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			p := NewAnthropic("anthropic", "", server.URL, nil)
+			_, err := p.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{Model: "claude-sonnet-4"})
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// describeChunk summarizes a stream chunk for comparison
+func describeChunk(chunk openai.ChatCompletionStreamResponse) string {
+	var parts []string
+	for _, choice := range chunk.Choices {
+		delta := choice.Delta
+		if delta.Role != "" {
+			parts = append(parts, "role:"+delta.Role)
+		}
+		if delta.Content != "" {
+			parts = append(parts, "text:"+delta.Content)
+		}
+		for _, call := range delta.ToolCalls {
+			if call.ID != "" {
+				parts = append(parts, fmt.Sprintf("tool:%d:%s:%s", *call.Index, call.ID, call.Function.Name))
+			} else {
+				parts = append(parts, fmt.Sprintf("args:%d:%s", *call.Index, call.Function.Arguments))
+			}
+		}
+		if choice.FinishReason != "" {
+			parts = append(parts, "finish:"+string(choice.FinishReason))
+		}
+	}
+	if chunk.Usage != nil {
+		parts = append(parts, fmt.Sprintf("usage:%d/%d", chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens))
+	}
+	return strings.Join(parts, " ")
+}
+
+// sse builds a server-sent event stream from event names and data
+func sse(events ...string) string {
+	var sb strings.Builder
+	for i := 0; i+1 < len(events); i += 2 {
+		fmt.Fprintf(&sb, "event: %s\r\ndata: %s\r\n\r\n", events[i], events[i+1])
+	}
+	return sb.String()
+}
+
+func TestAnthropicStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "text",
+			body: sse(
+				"message_start", `{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4","usage":{"input_tokens":12,"output_tokens":1}}}`,
+				"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				"ping", `{"type":"ping"}`,
+				"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+				"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+				"content_block_stop", `{"type":"content_block_stop","index":0}`,
+				"message_delta", `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":4}}`,
+				"message_stop", `{"type":"message_stop"}`,
+			),
+			want: []string{"role:assistant", "text:Hel", "text:lo", "finish:stop usage:12/4"},
+		},
+		{
+			name: "tool calls are numbered in order of their content blocks",
+			body: sse(
+				"message_start", `{"type":"message_start","message":{"id":"msg_2","model":"claude-sonnet-4","usage":{"input_tokens":30,"output_tokens":1}}}`,
+				"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Reading."}}`,
+				"content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"readFile","input":{}}}`,
+				"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"path\":"}}`,
+				"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"a.go\"}"}}`,
+				"content_block_start", `{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_2","name":"list","input":{}}}`,
+				"content_block_delta", `{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{}"}}`,
+				"message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}`,
+				"message_stop", `{"type":"message_stop"}`,
+			),
+			want: []string{
+				"role:assistant",
+				"text:Reading.",
+				"tool:0:toolu_1:readFile",
+				`args:0:{"path":`,
+				`args:0:"a.go"}`,
+				"tool:1:toolu_2:list",
+				"args:1:{}",
+				"finish:tool_calls usage:30/20",
+			},
+		},
+		{
+			name: "error event",
+			body: sse(
+				"message_start", `{"type":"message_start","message":{"id":"msg_3","model":"claude-sonnet-4","usage":{}}}`,
+				"error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			),
+			want:    []string{"role:assistant"},
+			wantErr: "anthropic stream error (overloaded_error): Overloaded",
+		},
+		{
+			name:    "invalid event data",
+			body:    "data: {not json}\n\n",
+			wantErr: "failed to decode anthropic stream event",
+		},
+		{
+			name: "last event without a trailing blank line",
+			body: "data: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_4\",\"model\":\"claude-sonnet-4\",\"usage\":{}}}",
+			want: []string{"role:assistant"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody anthropicRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+					t.Error(err)
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			p := NewAnthropic("anthropic", "", server.URL, nil)
+			stream, err := p.CreateChatCompletionStream(context.Background(), openai.ChatCompletionRequest{
+				Model:    "claude-sonnet-4",
+				Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stream.Close()
+			if !gotBody.Stream {
+				t.Error("streaming request was sent without stream: true")
+			}
+
+			var got []string
+			for {
+				chunk, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					if tt.wantErr != "" {
+						t.Errorf("stream ended without error, want %q", tt.wantErr)
+					}
+					break
+				}
+				if err != nil {
+					if tt.wantErr == "" || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Errorf("error = %v, want %q", err, tt.wantErr)
+					}
+					break
+				}
+				got = append(got, describeChunk(chunk))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunks = %q\nwant     %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrScriptExhausted is returned when a FakeProvider has no responses left
+var ErrScriptExhausted = errors.New("fake provider: no scripted responses left")
+
+// FakeProvider replays scripted responses in order and records every
+// request it receives. It is meant for tests and offline demos.
+type FakeProvider struct {
+	mu        sync.Mutex
+	responses []openai.ChatCompletionResponse
+	requests  []openai.ChatCompletionRequest
+}
+
+// NewFakeProvider creates a fake provider that returns the given responses in order
+func NewFakeProvider(responses ...openai.ChatCompletionResponse) *FakeProvider {
+	return &FakeProvider{responses: responses}
+}
+
+// FakeText builds a scripted response with a plain assistant message
+func FakeText(content string) openai.ChatCompletionResponse {
+	return fakeResponse(openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: content,
+	}, openai.FinishReasonStop)
+}
+
+// FakeToolCall builds a scripted response that calls a single tool
+func FakeToolCall(id, name, arguments string) openai.ChatCompletionResponse {
+	return fakeResponse(openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleAssistant,
+		ToolCalls: []openai.ToolCall{{
+			ID:       id,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: name, Arguments: arguments},
+		}},
+	}, openai.FinishReasonToolCalls)
+}
+
+// fakeResponse wraps a message in a response
+func fakeResponse(message openai.ChatCompletionMessage, finishReason openai.FinishReason) openai.ChatCompletionResponse {
+	return openai.ChatCompletionResponse{
+		Object:  "chat.completion",
+		Model:   "fake",
+		Choices: []openai.ChatCompletionChoice{{Message: message, FinishReason: finishReason}},
+	}
+}
+
+// Script appends responses to the end of the script
+func (p *FakeProvider) Script(responses ...openai.ChatCompletionResponse) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.responses = append(p.responses, responses...)
+}
+
+// Requests returns the requests received so far
+func (p *FakeProvider) Requests() []openai.ChatCompletionRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]openai.ChatCompletionRequest(nil), p.requests...)
+}
+
+// Name returns the name of the provider
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// CreateChatCompletion returns the next scripted response
+func (p *FakeProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, req)
+	if len(p.responses) == 0 {
+		return openai.ChatCompletionResponse{}, ErrScriptExhausted
+	}
+	resp := p.responses[0]
+	p.responses = p.responses[1:]
+	return resp, nil
+}
+
+// CreateChatCompletionStream returns the next scripted response split into chunks
+func (p *FakeProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	resp, err := p.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeStream{chunks: splitIntoChunks(resp)}, nil
+}
+
+// splitIntoChunks turns a response into role, content, tool call and finish chunks
+func splitIntoChunks(resp openai.ChatCompletionResponse) []openai.ChatCompletionStreamResponse {
+	chunk := func(delta openai.ChatCompletionStreamChoiceDelta, finishReason openai.FinishReason) openai.ChatCompletionStreamResponse {
+		return openai.ChatCompletionStreamResponse{
+			ID:      resp.ID,
+			Object:  "chat.completion.chunk",
+			Model:   resp.Model,
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: delta, FinishReason: finishReason}},
+		}
+	}
+
+	var chunks []openai.ChatCompletionStreamResponse
+	if len(resp.Choices) == 0 {
+		return chunks
+	}
+	choice := resp.Choices[0]
+
+	chunks = append(chunks, chunk(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, ""))
+	if choice.Message.Content != "" {
+		chunks = append(chunks, chunk(openai.ChatCompletionStreamChoiceDelta{Content: choice.Message.Content}, ""))
+	}
+	for i, call := range choice.Message.ToolCalls {
+		index := i
+		call.Index = &index
+		chunks = append(chunks, chunk(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{call}}, ""))
+	}
+
+	last := chunk(openai.ChatCompletionStreamChoiceDelta{}, choice.FinishReason)
+	usage := resp.Usage
+	last.Usage = &usage
+	return append(chunks, last)
+}
+
+// fakeStream yields prepared chunks
+type fakeStream struct {
+	chunks []openai.ChatCompletionStreamResponse
+}
+
+// Recv returns the next chunk, or io.EOF when all chunks were returned
+func (s *fakeStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if len(s.chunks) == 0 {
+		return openai.ChatCompletionStreamResponse{}, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+// Close does nothing
+func (s *fakeStream) Close() error {
+	return nil
+}
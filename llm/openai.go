@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAI talks to the OpenAI API or any OpenAI-compatible endpoint such as
+// Ollama, llama.cpp or vLLM
+type OpenAI struct {
+	name   string
+	client *openai.Client
+}
+
+// NewOpenAI creates an OpenAI provider. An empty baseURL uses the official API.
+func NewOpenAI(name, apiKey, baseURL string, headers map[string]string) *OpenAI {
+	clientConfig := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		clientConfig.BaseURL = baseURL
+	}
+	clientConfig.HTTPClient = newHTTPClient(headers)
+
+	return &OpenAI{
+		name:   name,
+		client: openai.NewClientWithConfig(clientConfig),
+	}
+}
+
+// Name returns the configured name of the provider
+func (p *OpenAI) Name() string {
+	return p.name
+}
+
+// CreateChatCompletion sends a request and waits for the whole response
+func (p *OpenAI) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return p.client.CreateChatCompletion(ctx, req)
+}
+
+// CreateChatCompletionStream sends a request and streams the response
+func (p *OpenAI) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	req.Stream = true
+	stream, err := p.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// CreateEmbeddings creates embeddings with the embeddings endpoint
+func (p *OpenAI) CreateEmbeddings(ctx context.Context, req openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error) {
+	return p.client.CreateEmbeddings(ctx, req)
+}
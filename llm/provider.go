@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"nebula/config"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Provider is a chat completion backend. Requests and responses use the
+// OpenAI chat types so that tool calls look the same for every provider.
+type Provider interface {
+	// Name returns the configured name of the provider
+	Name() string
+	// CreateChatCompletion sends a request and waits for the whole response
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	// CreateChatCompletionStream sends a request and streams the response
+	CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error)
+}
+
+// Stream yields response chunks until Recv returns io.EOF
+type Stream interface {
+	Recv() (openai.ChatCompletionStreamResponse, error)
+	Close() error
+}
+
+// Provider types
+const (
+	TypeOpenAI    = "openai"
+	TypeAnthropic = "anthropic"
+)
+
+// NewProvider creates the provider described by the configuration
+func NewProvider(name string, providerCfg config.ProviderConfig, apiKey string) (Provider, error) {
+	switch providerCfg.Type {
+	case TypeOpenAI, "":
+		return NewOpenAI(name, apiKey, providerCfg.BaseURL, providerCfg.Headers), nil
+	case TypeAnthropic:
+		return NewAnthropic(name, apiKey, providerCfg.BaseURL, providerCfg.Headers), nil
+	default:
+		return nil, fmt.Errorf("unknown provider type %q for provider %s (expected openai or anthropic)", providerCfg.Type, name)
+	}
+}
+
+// headerTransport adds fixed headers to every request
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newHTTPClient returns an HTTP client that sends the extra headers
+func newHTTPClient(headers map[string]string) *http.Client {
+	if len(headers) == 0 {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: &headerTransport{base: http.DefaultTransport, headers: headers}}
+}
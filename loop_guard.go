@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// toolLoopGuard は1ターン内のツール呼び出しの回数と、同一呼び出しの繰り返しを監視する
+type toolLoopGuard struct {
+	maxRounds  int
+	maxRepeats int
+	rounds     int
+	callCounts map[string]int
+}
+
+// newToolLoopGuard は上限値を指定してガードを作成する（0以下の値はその検知を無効にする）
+func newToolLoopGuard(maxRounds, maxRepeats int) *toolLoopGuard {
+	return &toolLoopGuard{
+		maxRounds:  maxRounds,
+		maxRepeats: maxRepeats,
+		callCounts: make(map[string]int),
+	}
+}
+
+// record は1ラウンド分のツール呼び出しを記録し、上限に達した場合はその理由を返す
+func (g *toolLoopGuard) record(toolCalls []openai.ToolCall) string {
+	g.rounds++
+
+	reason := ""
+	for _, toolCall := range toolCalls {
+		key := toolCall.Function.Name + "\x00" + toolCall.Function.Arguments
+		g.callCounts[key]++
+		if reason == "" && g.maxRepeats > 0 && g.callCounts[key] >= g.maxRepeats {
+			reason = fmt.Sprintf("the tool call %s(%s) was repeated %d times with identical arguments",
+				toolCall.Function.Name, toolCall.Function.Arguments, g.callCounts[key])
+		}
+	}
+
+	if reason == "" && g.maxRounds > 0 && g.rounds >= g.maxRounds {
+		reason = fmt.Sprintf("the limit of %d tool rounds for a single turn was reached", g.maxRounds)
+	}
+	return reason
+}
+
+// reset はユーザーが続行を選んだ後にカウントをやり直す
+func (g *toolLoopGuard) reset() {
+	g.rounds = 0
+	g.callCounts = make(map[string]int)
+}
+
+// handleLoopPause はツールループを一時停止してユーザーに続行・停止・指示を尋ねる
+// モデルに伝えるメッセージと、停止するかどうかを返す
+func handleLoopPause(reason string) (note string, stop bool) {
+	fmt.Printf("\nTool loop paused: %s.\n", reason)
+	fmt.Print("Continue (c), stop (s) or give guidance (g)? ")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return fmt.Sprintf("[nebula] The tool loop was paused because %s. The user stopped the task.", reason), true
+	}
+
+	switch strings.TrimSpace(scanner.Text()) {
+	case "c", "C":
+		return fmt.Sprintf("[nebula] The tool loop was paused because %s. The user chose to continue. Do not repeat identical tool calls; use the results you already have.", reason), false
+	case "g", "G":
+		fmt.Print("Guidance for the model: ")
+		guidance := ""
+		if scanner.Scan() {
+			guidance = strings.TrimSpace(scanner.Text())
+		}
+		return fmt.Sprintf("[nebula] The tool loop was paused because %s. The user gave this guidance: %s", reason, guidance), false
+	default:
+		return fmt.Sprintf("[nebula] The tool loop was paused because %s. The user stopped the task; wait for further instructions.", reason), true
+	}
+}
+
+// loopEscalationNote は強いモデルへ切り替えてループを続ける場合にモデルに伝えるメッセージを返す
+func loopEscalationNote(reason string) string {
+	return fmt.Sprintf("[nebula] The tool loop was paused because %s. A stronger model has taken over this turn. Do not repeat identical tool calls; use the results you already have.", reason)
+}
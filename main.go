@@ -7,9 +7,14 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 
 	"nebula/config"
+	"nebula/indexer"
 	"nebula/memory"
+	"nebula/permission"
+	"nebula/project"
+	"nebula/repomap"
 	"nebula/tools"
 
 	"github.com/sashabaranov/go-openai"
@@ -18,8 +23,20 @@ import (
 // executeToolCall は単一のツールコールを実行する
 func executeToolCall(toolCall openai.ToolCall, toolsMap map[string]tools.ToolDefinition, planMode bool) openai.ChatCompletionMessage {
 	if tool, exists := toolsMap[toolCall.Function.Name]; exists {
-		// planモードでは書き込み系ツールの実行を制限
-		if planMode && (toolCall.Function.Name == "writeFile" || toolCall.Function.Name == "editFile") {
+		// agentモードではplan専用のツールを実行しない
+		if !planMode && tool.Capabilities.PlanOnly {
+			result := fmt.Sprintf(`{"error": "Tool '%s' is only available in plan mode."}`, toolCall.Function.Name)
+			fmt.Printf("Agent mode: Blocked execution of '%s'\n", toolCall.Function.Name)
+			return openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    result,
+				ToolCallID: toolCall.ID,
+			}
+		}
+
+		// planモードでは読み取り専用でないツールの実行を制限
+		// （スキーマは絞り込み済みだが、モデルが送ってきた場合に備える）
+		if planMode && !tool.Capabilities.AllowedInPlanMode() {
 			result := fmt.Sprintf(`{"error": "Tool '%s' is not allowed in plan mode. Plan mode is read-only."}`, toolCall.Function.Name)
 			fmt.Printf("Plan mode: Blocked execution of '%s'\n", toolCall.Function.Name)
 			return openai.ChatCompletionMessage{
@@ -55,17 +72,56 @@ func executeToolCall(toolCall openai.ToolCall, toolsMap map[string]tools.ToolDef
 }
 
 // processToolCalls は複数のツールコールを処理する
-func processToolCalls(toolCalls []openai.ToolCall, toolsMap map[string]tools.ToolDefinition, planMode bool) []openai.ChatCompletionMessage {
-	var toolMessages []openai.ChatCompletionMessage
+// 連続する読み取り専用のツールコールは最大maxParallel個まで並列に実行し、
+// 書き込み系など承認が必要なツールコールは順番に1つずつ実行する。結果は元の順番で返す
+func processToolCalls(toolCalls []openai.ToolCall, toolsMap map[string]tools.ToolDefinition, planMode bool, maxParallel int) []openai.ChatCompletionMessage {
+	toolMessages := make([]openai.ChatCompletionMessage, len(toolCalls))
+
+	for start := 0; start < len(toolCalls); {
+		if !canRunInParallel(toolCalls[start], toolsMap) {
+			toolMessages[start] = executeToolCall(toolCalls[start], toolsMap, planMode)
+			start++
+			continue
+		}
 
-	for _, toolCall := range toolCalls {
-		toolMessage := executeToolCall(toolCall, toolsMap, planMode)
-		toolMessages = append(toolMessages, toolMessage)
+		// 並列に実行できるツールコールが続く範囲をまとめて実行
+		end := start
+		for end < len(toolCalls) && canRunInParallel(toolCalls[end], toolsMap) {
+			end++
+		}
+		executeToolCallsInParallel(toolCalls[start:end], toolMessages[start:end], toolsMap, planMode, maxParallel)
+		start = end
 	}
 
 	return toolMessages
 }
 
+// canRunInParallel はツールコールを他の呼び出しと並列に実行してよいかを返す
+func canRunInParallel(toolCall openai.ToolCall, toolsMap map[string]tools.ToolDefinition) bool {
+	tool, exists := toolsMap[toolCall.Function.Name]
+	return exists && tool.Capabilities.ReadOnly && !tool.Capabilities.NeedsApproval && !tool.Capabilities.Sequential
+}
+
+// executeToolCallsInParallel はワーカー数を制限してツールコールを並列に実行し、結果をresultsの同じ位置に格納する
+func executeToolCallsInParallel(toolCalls []openai.ToolCall, results []openai.ChatCompletionMessage, toolsMap map[string]tools.ToolDefinition, planMode bool, maxParallel int) {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+
+	semaphore := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for i, toolCall := range toolCalls {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, toolCall openai.ToolCall) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i] = executeToolCall(toolCall, toolsMap, planMode)
+		}(i, toolCall)
+	}
+	wg.Wait()
+}
+
 // getSystemPrompt はnebulaエージェント用のシステムプロンプトを返す
 func getSystemPrompt() string {
 	return `# Role
@@ -88,9 +144,12 @@ You are "nebula", an expert software developer and autonomous coding agent.
 When you receive a request, follow this mandatory sequence and proceed automatically without asking for permission:
 
 ## Step 1: Information Gathering (Required, but proceed automatically)
-- **Discover project structure**: Use 'list' to understand what files exist and their organization when working with multiple files or unclear requirements
+- **Discover project structure**: Start from the Project Snapshot when one is provided below; use 'list' for directories it does not cover, or when there is no snapshot
 - **Use 'readFile'**: Read ALL reference files mentioned in the request to understand actual content
 - **Use 'searchInDirectory'**: Find related files when unsure about locations or patterns
+- **Use 'semanticSearch'**: Find code by describing what it does when you do not know the identifiers (e.g. "where are todo titles validated")
+- **Use 'repoMap'**: In large repositories, find the central files and signatures related to the task (pass the files or symbols you care about as focus)
+- **Use 'recallMemory'**: Look up how a similar problem was solved or what was agreed in an earlier session before starting over
 - **Verify reality**: What you discover often differs from assumptions
 
 **Internal Verification (check silently, do not ask user):**
@@ -106,6 +165,12 @@ When you receive a request, follow this mandatory sequence and proceed automatic
 
 **IMPORTANT: Proceed from Step 1 to Step 2 automatically without asking for permission or confirmation.**
 
+# Task Tracking
+- For tasks that touch multiple files or need three or more steps, call 'todoWrite' before implementing to break the work into concrete items
+- Keep exactly one item 'in_progress' while you work on it, and mark it 'done' as soon as it is finished; always send the full list
+- Call 'todoRead' to check what remains before continuing, especially in a restored session
+- Skip the list for single, trivial changes
+
 # Common Mistakes to Avoid
 ❌ **FORBIDDEN**: Guessing file names (e.g., assuming "todo.ts" exists without checking)
 ❌ **FORBIDDEN**: Guessing file extensions (e.g., assuming .js when it might be .ts)
@@ -127,7 +192,7 @@ When you receive a request, follow this mandatory sequence and proceed automatic
 ## Example 1: File Extension Discovery
 Request: "Add a todo feature to the app"
 **Correct sequence:**
-1. list(".") ← Discover if files are .js, .ts, .py, .go, etc.
+1. Check the languages in the Project Snapshot (or list(".")) ← Discover if files are .js, .ts, .py, .go, etc.
 2. Find actual todo-related files with search or list
 3. readFile the discovered files to understand patterns
 4. Implement using the correct extension and patterns
@@ -148,7 +213,7 @@ Request: "Create tools/copyFile.go based on tools/writeFile.go"
 ## Example 3: Directory Structure Discovery
 Request: "Add authentication middleware"
 **Correct sequence:**
-1. list(".") ← Discover project structure
+1. Check the tree in the Project Snapshot (or list(".")) ← Discover project structure
 2. list("src/") or searchInDirectory("middleware") ← Find where middleware belongs
 3. readFile existing middleware files to understand patterns
 4. Implement in the correct location with correct patterns
@@ -160,8 +225,37 @@ Request: "Add authentication middleware"
 Complete the entire task following this protocol in one continuous flow. No shortcuts, no assumptions, no guessing, and no asking for permission between steps.`
 }
 
-// handleConversation はLLMとの対話セッションを処理する
-func handleConversation(client *openai.Client, cfg *config.Config, memoryManager *memory.Manager, toolSchemas []openai.Tool, toolsMap map[string]tools.ToolDefinition, userInput string, messages []openai.ChatCompletionMessage, planMode bool) []openai.ChatCompletionMessage {
+// reasoningEffort はこのセッションで推論モデルに渡すreasoning_effort（空の場合はモデルの既定）
+var reasoningEffort string
+
+// newChatRequest はモデルの機能に応じてチャットリクエストを組み立てる
+// 推論モデルではtemperatureを指定せず、max_completion_tokensとreasoning_effortを使う
+func newChatRequest(model config.ModelConfig, messages []openai.ChatCompletionMessage, toolSchemas []openai.Tool) openai.ChatCompletionRequest {
+	req := openai.ChatCompletionRequest{
+		Model:    model.ModelID,
+		Messages: messages,
+		Tools:    toolSchemas,
+	}
+
+	if model.Capabilities.Reasoning {
+		req.MaxCompletionTokens = model.MaxOutputTokens
+		req.ReasoningEffort = reasoningEffort
+	}
+
+	return req
+}
+
+// conversationOutcome はhandleConversationの1ターンがどう終わったかを表す
+type conversationOutcome int
+
+const (
+	conversationCompleted conversationOutcome = iota // モデルが最終応答を返した
+	conversationFailed                               // APIエラーや空の応答で中断した
+	conversationStopped                              // ツールループの一時停止でユーザーが停止を選んだ
+)
+
+// handleConversation はLLMとの対話セッションを処理し、ターンの終わり方を返す
+func handleConversation(router *modelRouter, cfg *config.Config, memoryManager *memory.Manager, toolsMap map[string]tools.ToolDefinition, userInput string, messages []openai.ChatCompletionMessage, planMode bool) ([]openai.ChatCompletionMessage, conversationOutcome) {
 	// システムプロンプトが設定されていない場合は最初に追加
 	// （復元されたメッセージにはシステムプロンプトが含まれていない可能性があるため）
 	hasSystemPrompt := false
@@ -173,7 +267,7 @@ func handleConversation(client *openai.Client, cfg *config.Config, memoryManager
 		// システムプロンプトを先頭に追加
 		systemMessage := openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleSystem,
-			Content: getSystemPrompt(),
+			Content: effectiveSystemPrompt(),
 		}
 		messages = append([]openai.ChatCompletionMessage{systemMessage}, messages...)
 	}
@@ -187,98 +281,254 @@ func handleConversation(client *openai.Client, cfg *config.Config, memoryManager
 	// メモリに保存
 	memoryManager.SaveMessage("user", userInput, nil, nil)
 
+	// モードに割り当てられたモデルを使う
+	model, provider, err := router.forMode(planMode)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return messages, conversationFailed
+	}
+
+	// モードに応じてモデルに渡すツールを決める（planモードでは読み取り専用ツールのみ）
+	// ツール呼び出しに対応していないモデルにはツールを渡さない
+	var toolSchemas []openai.Tool
+	if model.Capabilities.Tools {
+		toolSchemas = tools.ToolSchemas(toolsMap, planMode)
+	}
+
+	// 失敗が続いた場合に、このターンの残りを強いモデルに切り替える
+	escalated := false
+	toolErrors := 0
+	escalateModel := func(reason string) bool {
+		if escalated {
+			return false
+		}
+		nextModel, nextProvider, ok := router.escalate(model)
+		if !ok {
+			return false
+		}
+		fmt.Printf("Escalating from %s to %s: %s\n", model.Name, nextModel.Name, reason)
+		model, provider, escalated = nextModel, nextProvider, true
+		toolSchemas = nil
+		if model.Capabilities.Tools {
+			toolSchemas = tools.ToolSchemas(toolsMap, planMode)
+		}
+		return true
+	}
+
 	// 最初のAPI呼び出し
-	resp, err := client.CreateChatCompletion(
+	resp, err := provider.CreateChatCompletion(
 		context.Background(),
-		openai.ChatCompletionRequest{
-			Model:    cfg.GetOpenAIModel(),
-			Messages: messages,
-			Tools:    toolSchemas,
-		},
+		newChatRequest(model, withModeInstructions(messages, planMode), toolSchemas),
 	)
 
 	if err != nil {
-		fmt.Printf("Error calling OpenAI API: %v\n", err)
-		return messages
+		fmt.Printf("Error calling %s API: %v\n", provider.Name(), err)
+		return messages, conversationFailed
 	}
 
 	if len(resp.Choices) == 0 {
-		fmt.Println("No response received from OpenAI")
-		return messages
+		fmt.Printf("No response received from %s\n", provider.Name())
+		return messages, conversationFailed
 	}
 
+	// ツール呼び出しループの暴走を監視
+	loopGuard := newToolLoopGuard(cfg.MaxToolRounds, cfg.MaxRepeatedToolCalls)
+
 	// レスポンスを処理するループ
 	for {
 		responseMessage := resp.Choices[0].Message
 		messages = append(messages, responseMessage)
 
+		// アシスタントの応答とトークン使用量をメモリに保存
+		saveAssistantResponse(model, memoryManager, resp)
+
 		// ツールコールがある場合の処理
 		if len(responseMessage.ToolCalls) > 0 {
 			fmt.Println("Assistant is using tools...")
 
 			// ツールを実行して結果をメッセージ履歴に追加
-			toolMessages := processToolCalls(responseMessage.ToolCalls, toolsMap, planMode)
+			toolMessages := processToolCalls(responseMessage.ToolCalls, toolsMap, planMode, cfg.MaxParallelTools)
 			messages = append(messages, toolMessages...)
+			saveToolResults(memoryManager, responseMessage.ToolCalls, toolMessages)
+
+			// 不正なツール引数やツールエラーが続く場合は強いモデルに切り替える
+			if reason := escalationReason(responseMessage.ToolCalls, toolMessages, &toolErrors, cfg.MaxToolErrors); reason != "" {
+				escalateModel(reason)
+			}
+
+			// 上限回数や同一呼び出しの繰り返しを検知したら、まず強いモデルへの切り替えを試み、
+			// 切り替えられない場合は一時停止してユーザーに確認（どちらの場合も理由をモデルに伝える）
+			if reason := loopGuard.record(responseMessage.ToolCalls); reason != "" {
+				note, stop := loopEscalationNote(reason), false
+				if !escalateModel(reason) {
+					note, stop = handleLoopPause(reason)
+				}
+				messages = append(messages, openai.ChatCompletionMessage{
+					Role:    openai.ChatMessageRoleUser,
+					Content: note,
+				})
+				memoryManager.SaveMessage("user", note, nil, nil)
+				if stop {
+					fmt.Println("Stopped.")
+					return messages, conversationStopped
+				}
+				loopGuard.reset()
+			}
 
 			// 次のAPI呼び出し
-			resp, err = client.CreateChatCompletion(
+			resp, err = provider.CreateChatCompletion(
 				context.Background(),
-				openai.ChatCompletionRequest{
-					Model:    cfg.GetOpenAIModel(),
-					Messages: messages,
-					Tools:    toolSchemas,
-				},
+				newChatRequest(model, withModeInstructions(messages, planMode), toolSchemas),
 			)
 
 			if err != nil {
-				fmt.Printf("Error calling OpenAI API after tool execution: %v\n", err)
-				break
+				fmt.Printf("Error calling %s API after tool execution: %v\n", provider.Name(), err)
+				return messages, conversationFailed
 			}
 
 			if len(resp.Choices) == 0 {
-				break
+				fmt.Printf("No response received from %s\n", provider.Name())
+				return messages, conversationFailed
 			}
 		} else {
 			// ツールコールがない場合は最終応答
 			fmt.Printf("Assistant: %s\n\n", responseMessage.Content)
-
-			// アシスタントメッセージをメモリに保存
-			memoryManager.SaveMessage("assistant", responseMessage.Content, nil, nil)
-			break
+			return messages, conversationCompleted
 		}
 	}
+}
 
-	return messages
+// slashCommand は「/name」または「/name 引数」の形の入力であれば引数を返す
+// 引数をとるコマンドは、同じ単語で始まる通常の指示と区別するために「/」を付けて入力する
+func slashCommand(input, name string) (string, bool) {
+	rest, ok := strings.CutPrefix(input, "/"+name)
+	if !ok || (rest != "" && rest[0] != ' ') {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
 }
 
 // handleModelSwitch handles interactive model switching
-func handleModelSwitch(cfg *config.Config) {
+func handleModelSwitch(cfg *config.Config, router *modelRouter) {
+	registry := cfg.ModelRegistry()
+
 	fmt.Printf("Current model: %s\n", cfg.Model)
+	if cfg.ModeModels.Plan != "" || cfg.ModeModels.Agent != "" {
+		fmt.Printf("Mode models: %s (modes without an assignment use the current model)\n", formatModeModels(cfg))
+	}
 	fmt.Println("Available models:")
-	fmt.Println("1. gpt-4.1-nano (default, faster)")
-	fmt.Println("2. gpt-4.1-mini (complex tasks)")
-	fmt.Print("Select model (1 or 2): ")
+	for i, model := range registry {
+		fmt.Printf("%d. %s\n", i+1, formatModelEntry(model))
+	}
+	fmt.Printf("Select model (1-%d or name): ", len(registry))
 
 	scanner := bufio.NewScanner(os.Stdin)
 	if scanner.Scan() {
 		choice := strings.TrimSpace(scanner.Text())
-		var newModel string
 
-		switch choice {
-		case "1":
-			newModel = "gpt-4.1-nano"
-		case "2":
-			newModel = "gpt-4.1-mini"
-		default:
+		// 番号または名前でモデルを選択
+		var selected *config.ModelConfig
+		if index, err := strconv.Atoi(choice); err == nil && index >= 1 && index <= len(registry) {
+			selected = &registry[index-1]
+		} else if model, ok := cfg.FindModel(choice); ok {
+			selected = &model
+		}
+		if selected == nil {
 			fmt.Println("Invalid choice. No changes made.")
 			return
 		}
 
-		if err := cfg.SetModel(newModel); err != nil {
+		// プロバイダーを作れない場合（APIキー未設定など）は切り替えない
+		provider, err := router.providerFor(*selected)
+		if err != nil {
+			fmt.Printf("Error setting model: %v\n", err)
+			return
+		}
+
+		if err := cfg.SetModel(selected.Name); err != nil {
 			fmt.Printf("Error setting model: %v\n", err)
 		} else {
-			fmt.Printf("Model switched to: %s\n", newModel)
+			fmt.Printf("Model switched to: %s (%s)\n", selected.Name, provider.Name())
+		}
+	}
+}
+
+// formatModelEntry formats a registry entry for the model menu
+func formatModelEntry(model config.ModelConfig) string {
+	var features []string
+	if model.Capabilities.Tools {
+		features = append(features, "tools")
+	}
+	if model.Capabilities.Streaming {
+		features = append(features, "streaming")
+	}
+	if model.Capabilities.Vision {
+		features = append(features, "vision")
+	}
+	if model.Capabilities.Reasoning {
+		features = append(features, "reasoning")
+	}
+
+	entry := fmt.Sprintf("%s [%s] ctx %dk, out %dk, $%.2f/$%.2f per 1M tokens, %s",
+		model.Name, model.Provider, model.ContextWindow/1000, model.MaxOutputTokens/1000,
+		model.Price.Input, model.Price.Output, strings.Join(features, "/"))
+	if model.Description != "" {
+		entry += " - " + model.Description
+	}
+	return entry
+}
+
+// formatModeModels describes which model each mode uses
+func formatModeModels(cfg *config.Config) string {
+	describe := func(planMode bool) string {
+		model, err := cfg.ModelForMode(planMode)
+		if err != nil {
+			return "?"
+		}
+		return model.Name
+	}
+	return fmt.Sprintf("plan=%s, agent=%s", describe(true), describe(false))
+}
+
+// handleEffortCommand shows or sets the reasoning effort for this session.
+// The note about non-reasoning models refers to the model routed to the
+// current mode, which may differ from the default model with mode_models.
+func handleEffortCommand(cfg *config.Config, planMode bool, args string) {
+	model, err := cfg.ModelForMode(planMode)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if args == "" {
+		effort := reasoningEffort
+		if effort == "" {
+			effort = "model default"
+		}
+		fmt.Printf("Reasoning effort: %s\n", effort)
+		if !model.Capabilities.Reasoning {
+			fmt.Printf("Note: the model of this mode (%s) is not a reasoning model, so this setting is not sent.\n", model.Name)
 		}
+		return
+	}
+
+	effort := args
+	if effort == "default" {
+		effort = ""
+	}
+	if err := config.ValidateReasoningEffort(effort); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	reasoningEffort = effort
+	if effort == "" {
+		fmt.Println("Reasoning effort reset to the model default for this session")
+	} else {
+		fmt.Printf("Reasoning effort set to %s for this session\n", effort)
+	}
+	if !model.Capabilities.Reasoning {
+		fmt.Printf("Note: the model of this mode (%s) is not a reasoning model, so this setting is not sent.\n", model.Name)
 	}
 }
 
@@ -312,6 +562,17 @@ func handleModeSwitch(planMode *bool) {
 	}
 }
 
+// handleTodoShow prints the task list of the current session
+func handleTodoShow(memoryManager *memory.Manager) {
+	items, err := memoryManager.GetTodos()
+	if err != nil {
+		fmt.Printf("Error loading todos: %v\n", err)
+		return
+	}
+	fmt.Println("Todo:")
+	fmt.Print(tools.FormatTodos(items))
+}
+
 // startNewSession creates a new session and returns empty messages
 func startNewSession(memoryManager *memory.Manager, currentDir, model string) ([]openai.ChatCompletionMessage, error) {
 	session, err := memoryManager.StartSession(currentDir, model)
@@ -331,6 +592,10 @@ func convertToOpenAIMessages(memoryMessages []*memory.Message) []openai.ChatComp
 		if msg.Role == "tool" {
 			continue
 		}
+		// Tool call requests are skipped together with their results
+		if msg.ToolCalls != nil {
+			continue
+		}
 
 		messages = append(messages, openai.ChatCompletionMessage{
 			Role:    msg.Role,
@@ -354,18 +619,34 @@ func handleSessionSelection(memoryManager *memory.Manager, currentDir, model str
 		return startNewSession(memoryManager, currentDir, model)
 	}
 
-	// 既存セッションを表示
+	// 既存セッションを表示（フォークしたセッションは親の下に並べる）
 	fmt.Printf("Found %d previous sessions for this project:\n", len(sessions))
-	for i, session := range sessions {
+	tree := sessionTree(sessions)
+	for i, node := range tree {
+		session := node.Session
 		status := "completed"
 		if session.EndedAt == nil {
 			status = "active"
 		}
-		lastMsg := session.LastMessage
-		if len(lastMsg) > 50 {
-			lastMsg = lastMsg[:50] + "..."
+		if session.Pinned {
+			status += ", pinned"
+		}
+		if fork := formatForkPoint(session, node.Prefix != ""); fork != "" {
+			status += ", " + fork
+		}
+		// タイトルがまだない古いセッションはIDと最後のメッセージで表示
+		if session.Title == "" {
+			lastMsg := session.LastMessage
+			if len(lastMsg) > 50 {
+				lastMsg = lastMsg[:50] + "..."
+			}
+			fmt.Printf("%d. %s%s (%s) - %s\n", i+1, node.Prefix, session.ID, status, lastMsg)
+			continue
+		}
+		fmt.Printf("%d. %s%s (%s, %s, %d messages)\n", i+1, node.Prefix, session.Title, session.StartedAt.Local().Format("2006-01-02 15:04"), status, session.MessageCount)
+		if session.Summary != "" {
+			fmt.Printf("   %s%s\n", node.Indent, truncateText(session.Summary, 160))
 		}
-		fmt.Printf("%d. %s (%s) - %s\n", i+1, session.ID, status, lastMsg)
 	}
 	fmt.Print("Start new session or restore (new/1-5): ")
 
@@ -395,14 +676,18 @@ func handleSessionSelection(memoryManager *memory.Manager, currentDir, model str
 	}
 
 	// セッションを復元
-	selectedSession := sessions[sessionIndex-1]
+	selectedSession := tree[sessionIndex-1].Session
 	restoredSession, err := memoryManager.RestoreSession(selectedSession.ID)
 	if err != nil {
 		fmt.Printf("Error restoring session: %v\n", err)
 		return startNewSession(memoryManager, currentDir, model)
 	}
 
-	fmt.Printf("Restored session: %s\n", restoredSession.ID)
+	if restoredSession.Title != "" {
+		fmt.Printf("Restored session: %s (%s)\n", restoredSession.Title, restoredSession.ID)
+	} else {
+		fmt.Printf("Restored session: %s\n", restoredSession.ID)
+	}
 
 	// 過去の会話履歴を読み込み
 	memoryMessages, err := memoryManager.GetSessionMessages(selectedSession.ID)
@@ -414,10 +699,21 @@ func handleSessionSelection(memoryManager *memory.Manager, currentDir, model str
 	// OpenAI形式に変換
 	messages := convertToOpenAIMessages(memoryMessages)
 	fmt.Printf("Loaded %d previous messages\n", len(messages))
+
+	// 保存されているtodoリストを表示
+	if items, err := memoryManager.GetTodos(); err == nil && len(items) > 0 {
+		fmt.Println("Todo:")
+		fmt.Print(tools.FormatTodos(items))
+	}
 	return messages, nil
 }
 
 func main() {
+	// サブコマンドが指定された場合は対話モードに入らずに実行
+	if len(os.Args) > 1 {
+		os.Exit(runSubcommand(os.Args[1:]))
+	}
+
 	// デフォルトはagentモード
 	planMode := false
 
@@ -428,13 +724,18 @@ func main() {
 		os.Exit(1)
 	}
 
-	// APIキーが設定されているかチェック
-	if cfg.APIKey == "" {
-		fmt.Println("Error: OPENAI_API_KEY environment variable is not set")
-		fmt.Println("Please set your OpenAI API key: export OPENAI_API_KEY=your_api_key_here")
-		os.Exit(1)
+	// 各モードのモデルのプロバイダーを初期化（APIキーが必要な場合は設定されているかチェック）
+	router := newModelRouter(cfg)
+	for _, mode := range []bool{false, true} {
+		if _, _, err := router.forMode(mode); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
+	// reasoning effortは設定の値から始め、セッション中は/effortコマンドで変更する
+	reasoningEffort = cfg.ReasoningEffort
+
 	// メモリマネージャーを初期化
 	memoryManager, err := memory.NewManager(cfg.DatabasePath)
 	if err != nil {
@@ -450,6 +751,9 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 保存期間や上限を超えた古いセッションを削除
+	pruneSessionsOnStartup(cfg, memoryManager)
+
 	// セッション管理
 	messages, err := handleSessionSelection(memoryManager, currentDir, cfg.Model)
 	if err != nil {
@@ -457,23 +761,81 @@ func main() {
 		os.Exit(1)
 	}
 
-	// OpenAIクライアントを初期化
-	client := openai.NewClient(cfg.APIKey)
+	// セッションのタイトルと要約は安いモデルで生成する
+	summarizer := newSessionSummarizer(router, memoryManager)
 
-	// 利用可能なツールを取得
-	toolsMap := tools.GetAvailableTools()
+	// パーミッションルールを読み込み（グローバル設定とプロジェクト設定）
+	projectCfg, err := config.LoadProjectConfig(currentDir)
+	if err != nil {
+		fmt.Printf("Error loading project config: %v\n", err)
+		os.Exit(1)
+	}
+	permissionChecker := permission.NewChecker(cfg.Permissions, projectCfg.Permissions, func(rules []permission.Rule) error {
+		projectCfg.Permissions = rules
+		return config.SaveProjectConfig(currentDir, projectCfg)
+	})
+	tools.SetPermissionChecker(permissionChecker)
 
-	// ツールのスキーマを配列に変換
-	var toolSchemas []openai.Tool
-	for _, tool := range toolsMap {
-		toolSchemas = append(toolSchemas, tool.Schema)
+	// ファイルツールをセッション開始時のディレクトリに閉じ込める
+	workspaceRoot := currentDir
+	if session := memoryManager.GetCurrentSession(); session != nil {
+		workspaceRoot = session.ProjectPath
 	}
+	allowedDirs := append(append([]string{}, cfg.AllowedDirs...), projectCfg.AllowedDirs...)
+	if err := tools.SetWorkspace(workspaceRoot, allowedDirs); err != nil {
+		fmt.Printf("Error setting up workspace: %v\n", err)
+		os.Exit(1)
+	}
+
+	// シンボルのキャッシュはメモリDBに保存し、変更されたファイルだけを解析し直す
+	repoMap := repomap.New(workspaceRoot, memoryManager)
+
+	// セマンティック検索の索引も同じくメモリDBに保存する
+	embedder, err := newEmbedder(cfg)
+	if err != nil {
+		fmt.Printf("Error setting up embeddings: %v\n", err)
+		os.Exit(1)
+	}
+	codeIndex := indexer.New(workspaceRoot, memoryManager, embedder)
+	// 変更されたファイルの索引はセッション開始時にバックグラウンドで更新し、検索は保存済みの索引だけを使う
+	go refreshIndex(codeIndex)
+
+	// NEBULA.mdのプロジェクト指示を読み込み、復元した履歴のシステムプロンプトにも反映
+	loadProjectInstructions(workspaceRoot)
+	loadProjectSnapshot(workspaceRoot, cfg.SnapshotTokens)
+	loadRepoMapContext(repoMap, cfg.RepoMapTokens)
+	messages = refreshSystemPrompt(messages)
+
+	// 利用可能なツールを取得
+	toolsMap := tools.GetAvailableTools()
+	toolsMap["submitPlan"] = tools.GetSubmitPlanTool(newPlanHandler(memoryManager))
+	toolsMap["todoWrite"] = tools.GetTodoWriteTool(memoryManager)
+	toolsMap["todoRead"] = tools.GetTodoReadTool(memoryManager)
+	toolsMap["repoMap"] = tools.GetRepoMapTool(repoMap)
+	_, localEmbeddings := embedder.(*indexer.HashEmbedder)
+	toolsMap["semanticSearch"] = tools.GetSemanticSearchTool(codeIndex, !localEmbeddings)
+	toolsMap["recallMemory"] = tools.GetRecallMemoryTool(memoryManager)
 
 	fmt.Println("nebula - OpenAI Chat CLI with Function Calling")
 	fmt.Printf("Current model: %s\n", cfg.Model)
+	if cfg.ModeModels.Plan != "" || cfg.ModeModels.Agent != "" {
+		fmt.Printf("Mode models: %s\n", formatModeModels(cfg))
+	}
+	if cfg.EscalationModel != "" {
+		fmt.Printf("Escalation model: %s\n", cfg.EscalationModel)
+	}
 	fmt.Println("Memory: enabled")
 	fmt.Println("Mode: AGENT (full capabilities)")
-	fmt.Println("Available tools: readFile, list, searchInDirectory, writeFile, editFile")
+	fmt.Printf("Available tools: %s\n", strings.Join(tools.ToolNames(toolsMap), ", "))
+	for _, inst := range projectInstructions {
+		fmt.Printf("Instructions: %s\n", inst.Path)
+	}
+	if projectSnapshot != "" {
+		fmt.Printf("Project snapshot: ~%d tokens\n", project.EstimateTokens(projectSnapshot))
+	}
+	if projectRepoMap != "" {
+		fmt.Printf("Repository map: ~%d tokens\n", project.EstimateTokens(projectRepoMap))
+	}
 	fmt.Println()
 	fmt.Println("Commands:")
 	fmt.Println("  'exit' or 'quit' - End the conversation")
@@ -481,8 +843,24 @@ func main() {
 	fmt.Println("  'mode' - Interactive mode switching")
 	fmt.Println("  'plan' - Switch to PLAN mode (read-only)")
 	fmt.Println("  'agent' - Switch to AGENT mode (full capabilities)")
+	fmt.Println("  'plan show|edit|run|resume' - Show, edit, execute or resume the approved plan")
+	fmt.Println("  'todo' - Show the agent's task list for this session")
+	fmt.Println("  'cost' - Show token usage and cost of this session")
+	fmt.Println("  '/effort [minimal|low|medium|high|default]' - Show or set reasoning effort for this session")
+	fmt.Println("  'prompt' - Show the effective system prompt including NEBULA.md instructions")
+	fmt.Println("  'init' - Let the agent explore the repository and draft NEBULA.md")
+	fmt.Println("  'index' - Build or update the semantic search index")
+	fmt.Println("  '/search <query>' - Search messages and tool results of earlier sessions")
+	fmt.Println("  '/rename <title>' - Set the title of this session")
+	fmt.Println("  'pin' / 'unpin' - Keep this session from being pruned, or allow it again")
+	fmt.Println("  '/fork [message-id]' - List message IDs, or continue in a new session branched at a message")
 	fmt.Println("---")
 
+	// 未完了の計画があれば知らせる
+	if plans, err := memoryManager.GetResumablePlans(1); err == nil && len(plans) > 0 {
+		fmt.Printf("Unfinished plan found: #%d %s (use 'plan resume')\n", plans[0].ID, plans[0].Goal)
+	}
+
 	scanner := bufio.NewScanner(os.Stdin)
 
 	for {
@@ -506,7 +884,7 @@ func main() {
 
 		// モデル切り替えコマンドをチェック
 		if userInput == "model" {
-			handleModelSwitch(cfg)
+			handleModelSwitch(cfg, router)
 			continue
 		}
 
@@ -522,6 +900,63 @@ func main() {
 			fmt.Println("Mode switched to: PLAN (read-only)")
 			continue
 		}
+		// todoリストの表示
+		if userInput == "todo" {
+			handleTodoShow(memoryManager)
+			continue
+		}
+		// 推論モデルのreasoning effortの表示・変更
+		if args, ok := slashCommand(userInput, "effort"); ok {
+			handleEffortCommand(cfg, planMode, args)
+			continue
+		}
+		// 実際にモデルに渡すシステムプロンプトを表示
+		if userInput == "prompt" {
+			handlePromptShow(planMode)
+			continue
+		}
+		// エージェントにNEBULA.mdの下書きを作らせる
+		if userInput == "init" {
+			messages = handleInit(router, cfg, memoryManager, toolsMap, messages, workspaceRoot)
+			continue
+		}
+		// セマンティック検索の索引を更新
+		if userInput == "index" {
+			handleIndexCommand(codeIndex)
+			continue
+		}
+		// 過去のセッションの会話を全文検索
+		if query, ok := slashCommand(userInput, "search"); ok {
+			handleSearchCommand(memoryManager, query)
+			continue
+		}
+		// セッションのタイトルを変更
+		if title, ok := slashCommand(userInput, "rename"); ok {
+			handleRenameCommand(memoryManager, title)
+			continue
+		}
+		// セッションを自動削除の対象から外す・戻す
+		if userInput == "pin" || userInput == "unpin" {
+			handlePinCommand(memoryManager, userInput == "pin")
+			continue
+		}
+		// 会話の途中のメッセージから新しいセッションに分岐する
+		if arg, ok := slashCommand(userInput, "fork"); ok {
+			messages, summarizer = handleForkCommand(memoryManager, router, summarizer, cfg.Model, arg, messages)
+			continue
+		}
+		// 現在のセッションの料金を表示
+		if userInput == "cost" {
+			handleCostShow(memoryManager)
+			continue
+		}
+
+		// 「plan the refactor」のような指示はモデルに渡し、サブコマンドと完全に一致する場合だけ扱う
+		switch userInput {
+		case "plan show", "plan edit", "plan run", "plan resume":
+			messages = handlePlanCommand(strings.TrimPrefix(userInput, "plan "), router, cfg, memoryManager, toolsMap, messages, &planMode)
+			continue
+		}
 		if userInput == "agent" {
 			planMode = false
 			fmt.Println("Mode switched to: AGENT (full capabilities)")
@@ -533,7 +968,13 @@ func main() {
 		}
 
 		// 対話セッションを処理
-		messages = handleConversation(client, cfg, memoryManager, toolSchemas, toolsMap, userInput, messages, planMode)
+		messages, _ = handleConversation(router, cfg, memoryManager, toolsMap, userInput, messages, planMode)
+
+		// 最初のやり取りの後にセッションのタイトルと要約を生成
+		summarizer.afterExchange()
 	}
+
+	// 会話が続いていればセッションの要約を更新
+	summarizer.finish()
 }
 
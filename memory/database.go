@@ -2,43 +2,118 @@ package memory
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Lock handling for several nebula processes sharing one database
+const (
+	busyTimeout    = 5 * time.Second       // ロックが解放されるまでSQLiteが待つ時間
+	maxBusyRetries = 5                     // それでもロックを取れなかった場合の再試行回数
+	retryDelay     = 50 * time.Millisecond // 再試行の間隔（再試行のたびに倍にする）
 )
 
 // Database handles SQLite database operations
 type Database struct {
-	db *sql.DB
+	db   *sql.DB
+	path string
 }
 
-// NewDatabase creates a new database instance
+// NewDatabase opens the database and applies pending schema migrations
 func NewDatabase(dbPath string) (*Database, error) {
+	database, err := openDatabase(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := database.migrate(); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return database, nil
+}
+
+// openDatabase opens the database without touching its schema
+func openDatabase(dbPath string) (*Database, error) {
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open("sqlite", dataSourceName(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	database := &Database{db: db}
+	return &Database{db: db, path: dbPath}, nil
+}
+
+// dataSourceName adds the connection settings to the database path. WAL lets
+// readers work while another process writes, busy_timeout waits for locks held
+// by other processes, and immediate transactions take the write lock at BEGIN
+// so that two writers cannot deadlock while upgrading a read lock.
+func dataSourceName(dbPath string) string {
+	return fmt.Sprintf("%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate",
+		dbPath, busyTimeout.Milliseconds())
+}
 
-	// Initialize tables
-	if err := database.initTables(); err != nil {
-		return nil, fmt.Errorf("failed to initialize tables: %w", err)
+// isBusy reports whether an error means that another connection holds the lock
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// 拡張エラーコード（SQLITE_BUSY_SNAPSHOTなど）の下位8ビットが基本のコード
+		code := sqliteErr.Code() & 0xff
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
 	}
+	return false
+}
 
-	return database, nil
+// retry runs fn again with a growing delay while the database is busy
+func retry(fn func() error) error {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isBusy(err) || attempt >= maxBusyRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// exec runs a statement, retrying while the database is busy
+func (d *Database) exec(query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := retry(func() error {
+		var err error
+		result, err = d.db.Exec(query, args...)
+		return err
+	})
+	return result, err
+}
+
+// begin starts a transaction, retrying while the database is busy
+func (d *Database) begin() (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := retry(func() error {
+		var err error
+		tx, err = d.db.Begin()
+		return err
+	})
+	return tx, err
 }
 
 // Close closes the database connection
@@ -46,8 +121,10 @@ func (d *Database) Close() error {
 	return d.db.Close()
 }
 
-// initTables creates the necessary tables if they don't exist
-func (d *Database) initTables() error {
+// migrateBaseline creates the schema that existed before versioned
+// migrations. Databases created by older versions may have any part of it,
+// so every statement is idempotent.
+func migrateBaseline(tx *sql.Tx) error {
 	// Create sessions table
 	sessionTableSQL := `
 	CREATE TABLE IF NOT EXISTS sessions (
@@ -55,10 +132,13 @@ func (d *Database) initTables() error {
 		started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		ended_at DATETIME,
 		project_path TEXT NOT NULL,
-		model_used TEXT NOT NULL
+		model_used TEXT NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		summary TEXT NOT NULL DEFAULT '',
+		title_custom INTEGER NOT NULL DEFAULT 0
 	);`
 
-	if _, err := d.db.Exec(sessionTableSQL); err != nil {
+	if _, err := tx.Exec(sessionTableSQL); err != nil {
 		return fmt.Errorf("failed to create sessions table: %w", err)
 	}
 
@@ -71,22 +151,147 @@ func (d *Database) initTables() error {
 		role TEXT NOT NULL,
 		content TEXT,
 		tool_calls TEXT,
-		tool_results TEXT
+		tool_results TEXT,
+		model TEXT
 	);`
 
-	if _, err := d.db.Exec(messageTableSQL); err != nil {
+	if _, err := tx.Exec(messageTableSQL); err != nil {
 		return fmt.Errorf("failed to create messages table: %w", err)
 	}
 
+	// Create plans table
+	planTableSQL := `
+	CREATE TABLE IF NOT EXISTS plans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT REFERENCES sessions(id),
+		project_path TEXT NOT NULL,
+		goal TEXT NOT NULL,
+		steps TEXT NOT NULL,
+		files TEXT,
+		risks TEXT,
+		status TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := tx.Exec(planTableSQL); err != nil {
+		return fmt.Errorf("failed to create plans table: %w", err)
+	}
+
+	// Create todos table
+	todoTableSQL := `
+	CREATE TABLE IF NOT EXISTS todos (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT REFERENCES sessions(id),
+		position INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		status TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := tx.Exec(todoTableSQL); err != nil {
+		return fmt.Errorf("failed to create todos table: %w", err)
+	}
+
+	// Create usage table
+	usageTableSQL := `
+	CREATE TABLE IF NOT EXISTS api_usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT REFERENCES sessions(id),
+		message_id INTEGER REFERENCES messages(id),
+		model TEXT NOT NULL,
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		cached_tokens INTEGER NOT NULL DEFAULT 0,
+		reasoning_tokens INTEGER NOT NULL DEFAULT 0,
+		cost REAL NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := tx.Exec(usageTableSQL); err != nil {
+		return fmt.Errorf("failed to create usage table: %w", err)
+	}
+
+	// Create repository map cache table
+	repoMapTableSQL := `
+	CREATE TABLE IF NOT EXISTS repo_map_files (
+		project_path TEXT NOT NULL,
+		path TEXT NOT NULL,
+		mod_time INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		symbols TEXT NOT NULL,
+		refs TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (project_path, path)
+	);`
+
+	if _, err := tx.Exec(repoMapTableSQL); err != nil {
+		return fmt.Errorf("failed to create repo map table: %w", err)
+	}
+
+	// Create semantic search index tables
+	codeIndexTableSQL := `
+	CREATE TABLE IF NOT EXISTS code_index_files (
+		project_path TEXT NOT NULL,
+		path TEXT NOT NULL,
+		mod_time INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		embedder TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (project_path, path)
+	);
+
+	CREATE TABLE IF NOT EXISTS code_chunks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_path TEXT NOT NULL,
+		path TEXT NOT NULL,
+		start_line INTEGER NOT NULL,
+		end_line INTEGER NOT NULL,
+		symbol TEXT,
+		content TEXT NOT NULL,
+		embedding BLOB NOT NULL
+	);`
+
+	if _, err := tx.Exec(codeIndexTableSQL); err != nil {
+		return fmt.Errorf("failed to create code index tables: %w", err)
+	}
+
+	// Add columns introduced after the tables were first created
+	if err := ensureColumn(tx, "api_usage", "reasoning_tokens", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(tx, "messages", "model", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureColumn(tx, "sessions", "title", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(tx, "sessions", "summary", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(tx, "sessions", "title_custom", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if err := initMessageSearch(tx); err != nil {
+		return err
+	}
+
 	// Create indexes for better performance
 	indexSQL := []string{
 		"CREATE INDEX IF NOT EXISTS idx_sessions_project_path ON sessions(project_path);",
 		"CREATE INDEX IF NOT EXISTS idx_messages_session_id ON messages(session_id);",
 		"CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);",
+		"CREATE INDEX IF NOT EXISTS idx_plans_session_id ON plans(session_id);",
+		"CREATE INDEX IF NOT EXISTS idx_plans_project_path ON plans(project_path);",
+		"CREATE INDEX IF NOT EXISTS idx_todos_session_id ON todos(session_id);",
+		"CREATE INDEX IF NOT EXISTS idx_api_usage_session_id ON api_usage(session_id);",
+		"CREATE INDEX IF NOT EXISTS idx_api_usage_created_at ON api_usage(created_at);",
+		"CREATE INDEX IF NOT EXISTS idx_code_chunks_path ON code_chunks(project_path, path);",
 	}
 
 	for _, sql := range indexSQL {
-		if _, err := d.db.Exec(sql); err != nil {
+		if _, err := tx.Exec(sql); err != nil {
 			return fmt.Errorf("failed to create index: %w", err)
 		}
 	}
@@ -94,6 +299,82 @@ func (d *Database) initTables() error {
 	return nil
 }
 
+// initMessageSearch creates the full-text index over message content and
+// tool results. Triggers keep it in sync with the messages table; messages
+// saved before the index existed are indexed when it is first created.
+func initMessageSearch(tx *sql.Tx) error {
+	var existing int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'messages_fts'").Scan(&existing); err != nil {
+		return fmt.Errorf("failed to inspect search index: %w", err)
+	}
+
+	// trigramトークナイザーは単語の区切りがない日本語やコード片の部分一致にも対応する
+	searchSQL := `
+	CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+		content, tool_results,
+		content='messages', content_rowid='id', tokenize='trigram'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, content, tool_results) VALUES (new.id, new.content, new.tool_results);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content, tool_results) VALUES ('delete', old.id, old.content, old.tool_results);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content, tool_results) VALUES ('delete', old.id, old.content, old.tool_results);
+		INSERT INTO messages_fts(rowid, content, tool_results) VALUES (new.id, new.content, new.tool_results);
+	END;`
+
+	if _, err := tx.Exec(searchSQL); err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	if existing == 0 {
+		if _, err := tx.Exec("INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')"); err != nil {
+			return fmt.Errorf("failed to build search index: %w", err)
+		}
+	}
+	return nil
+}
+
+// ensureColumn adds a column to an existing table if it is missing
+func ensureColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
 // GetDB returns the underlying database connection
 func (d *Database) GetDB() *sql.DB {
 	return d.db
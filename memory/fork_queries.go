@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ForkSession creates session as a fork of the session that contains the
+// message forkPoint. The messages of the parent up to and including that
+// message are copied to the new session; plans, todos and usage records stay
+// with the parent. When session.ProjectPath is set the parent must belong to
+// that project.
+func (d *Database) ForkSession(session *Session, forkPoint int) error {
+	tx, err := d.begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var parentID, projectPath string
+	err = tx.QueryRow(`
+		SELECT s.id, s.project_path
+		FROM messages m
+		JOIN sessions s ON s.id = m.session_id
+		WHERE m.id = ?
+	`, forkPoint).Scan(&parentID, &projectPath)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("message #%d not found", forkPoint)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find fork point: %w", err)
+	}
+
+	if session.ProjectPath != "" && session.ProjectPath != projectPath {
+		return fmt.Errorf("message #%d belongs to a session of another project (%s)", forkPoint, projectPath)
+	}
+
+	// フォークは親と同じプロジェクトのセッション一覧に表示する
+	session.ProjectPath = projectPath
+	session.ParentSessionID = parentID
+	session.ForkPoint = forkPoint
+	_, err = tx.Exec(`
+		INSERT INTO sessions (id, started_at, project_path, model_used, parent_session_id, fork_point)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, session.ID, session.StartedAt, session.ProjectPath, session.ModelUsed, parentID, forkPoint)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	// 元の日時のままコピーし、検索の索引はトリガーで更新される
+	_, err = tx.Exec(`
+		INSERT INTO messages (session_id, timestamp, role, content, tool_calls, tool_results, model)
+		SELECT ?, timestamp, role, content, tool_calls, tool_results, model
+		FROM messages
+		WHERE session_id = ? AND id <= ?
+		ORDER BY id
+	`, session.ID, parentID, forkPoint)
+	if err != nil {
+		return fmt.Errorf("failed to copy messages: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// GetIndexedFiles retrieves the files held by the semantic index of a project
+func (d *Database) GetIndexedFiles(projectPath string) ([]IndexedFile, error) {
+	query := `
+		SELECT path, mod_time, size, embedder
+		FROM code_index_files
+		WHERE project_path = ?
+		ORDER BY path
+	`
+	rows, err := d.db.Query(query, projectPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get indexed files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []IndexedFile
+	for rows.Next() {
+		var file IndexedFile
+		if err := rows.Scan(&file.Path, &file.ModTime, &file.Size, &file.Embedder); err != nil {
+			return nil, fmt.Errorf("failed to scan indexed file: %w", err)
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// ReplaceFileChunks replaces the indexed chunks of a file
+func (d *Database) ReplaceFileChunks(projectPath string, file IndexedFile, chunks []CodeChunk) error {
+	tx, err := d.begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM code_chunks WHERE project_path = ? AND path = ?", projectPath, file.Path); err != nil {
+		return fmt.Errorf("failed to clear chunks: %w", err)
+	}
+
+	query := `
+		INSERT INTO code_chunks (project_path, path, start_line, end_line, symbol, content, embedding)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, chunk := range chunks {
+		if _, err := tx.Exec(query, projectPath, file.Path, chunk.StartLine, chunk.EndLine, chunk.Symbol, chunk.Content, encodeVector(chunk.Embedding)); err != nil {
+			return fmt.Errorf("failed to save chunk: %w", err)
+		}
+	}
+
+	fileQuery := `
+		INSERT OR REPLACE INTO code_index_files (project_path, path, mod_time, size, embedder, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	if _, err := tx.Exec(fileQuery, projectPath, file.Path, file.ModTime, file.Size, file.Embedder, time.Now()); err != nil {
+		return fmt.Errorf("failed to save indexed file: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteIndexedFiles removes files and their chunks from the semantic index
+func (d *Database) DeleteIndexedFiles(projectPath string, paths []string) error {
+	tx, err := d.begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, path := range paths {
+		if _, err := tx.Exec("DELETE FROM code_chunks WHERE project_path = ? AND path = ?", projectPath, path); err != nil {
+			return fmt.Errorf("failed to delete chunks: %w", err)
+		}
+		if _, err := tx.Exec("DELETE FROM code_index_files WHERE project_path = ? AND path = ?", projectPath, path); err != nil {
+			return fmt.Errorf("failed to delete indexed file: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetCodeChunks retrieves all indexed chunks of a project with their embeddings
+func (d *Database) GetCodeChunks(projectPath string) ([]CodeChunk, error) {
+	query := `
+		SELECT id, path, start_line, end_line, symbol, content, embedding
+		FROM code_chunks
+		WHERE project_path = ?
+		ORDER BY path, start_line
+	`
+	rows, err := d.db.Query(query, projectPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []CodeChunk
+	for rows.Next() {
+		var chunk CodeChunk
+		var symbol sql.NullString
+		var embedding []byte
+		if err := rows.Scan(&chunk.ID, &chunk.Path, &chunk.StartLine, &chunk.EndLine, &symbol, &chunk.Content, &embedding); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		chunk.Symbol = symbol.String
+		chunk.Embedding = decodeVector(embedding)
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, rows.Err()
+}
+
+// encodeVector stores a vector as little-endian float32 values
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// decodeVector reads a vector written by encodeVector
+func decodeVector(buf []byte) []float32 {
+	vector := make([]float32, len(buf)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return vector
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // Manager handles memory operations
@@ -38,11 +40,15 @@ func (m *Manager) Close() error {
 
 // StartSession creates a new session or restores an existing one
 func (m *Manager) StartSession(projectPath, modelUsed string) (*Session, error) {
-	// Generate session ID based on timestamp
-	sessionID := fmt.Sprintf("session_%s", time.Now().Format("20060102_150405"))
+	// UUIDv7 is time-ordered like the old timestamp IDs but does not collide
+	// when several processes start a session in the same second
+	sessionID, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
 
 	session := &Session{
-		ID:          sessionID,
+		ID:          sessionID.String(),
 		StartedAt:   time.Now(),
 		ProjectPath: projectPath,
 		ModelUsed:   modelUsed,
@@ -90,17 +96,59 @@ func (m *Manager) GetCurrentSession() *Session {
 	return m.currentSession
 }
 
-// SaveMessage saves a message to the current session
-func (m *Manager) SaveMessage(role, content string, toolCalls, toolResults interface{}) error {
+// SetSessionSummary stores a generated title and summary for the current session
+func (m *Manager) SetSessionSummary(title, summary string) error {
 	if m.currentSession == nil {
 		return nil
 	}
+	if err := m.db.UpdateSessionSummary(m.currentSession.ID, title, summary); err != nil {
+		return err
+	}
+
+	// /renameで付けたタイトルは上書きされないため、保存された値を読み直す
+	session, err := m.db.GetSession(m.currentSession.ID)
+	if err != nil {
+		return err
+	}
+	m.currentSession.Title = session.Title
+	m.currentSession.Summary = session.Summary
+	return nil
+}
+
+// RenameSession sets the title of the current session
+func (m *Manager) RenameSession(title string) error {
+	if m.currentSession == nil {
+		return fmt.Errorf("no active session")
+	}
+	if err := m.db.RenameSession(m.currentSession.ID, title); err != nil {
+		return err
+	}
+	m.currentSession.Title = title
+	return nil
+}
+
+// SaveMessage saves a message to the current session and returns the stored message
+func (m *Manager) SaveMessage(role, content string, toolCalls, toolResults interface{}) (*Message, error) {
+	return m.saveMessage(role, content, "", toolCalls, toolResults)
+}
+
+// SaveAssistantMessage saves an assistant message together with the model that produced it
+func (m *Manager) SaveAssistantMessage(model, content string, toolCalls interface{}) (*Message, error) {
+	return m.saveMessage("assistant", content, model, toolCalls, nil)
+}
+
+// saveMessage stores a message in the current session
+func (m *Manager) saveMessage(role, content, model string, toolCalls, toolResults interface{}) (*Message, error) {
+	if m.currentSession == nil {
+		return nil, nil
+	}
 
 	message := &Message{
 		SessionID: m.currentSession.ID,
 		Timestamp: time.Now(),
 		Role:      role,
 		Content:   content,
+		Model:     model,
 	}
 
 	// Convert tool calls/results to JSON strings if provided
@@ -115,7 +163,10 @@ func (m *Manager) SaveMessage(role, content string, toolCalls, toolResults inter
 		}
 	}
 
-	return m.db.SaveMessage(message)
+	if err := m.db.SaveMessage(message); err != nil {
+		return nil, err
+	}
+	return message, nil
 }
 
 // GetSessionsByProject returns sessions for the current project
@@ -143,6 +194,264 @@ func (m *Manager) GetRecentSessions(limit int) ([]*SessionSummary, error) {
 	return m.db.GetRecentSessions(limit)
 }
 
+// SavePlan stores a new plan for the current session
+func (m *Manager) SavePlan(plan *Plan) error {
+	if m.currentSession == nil {
+		return fmt.Errorf("no active session")
+	}
+
+	plan.SessionID = m.currentSession.ID
+	plan.ProjectPath = m.currentSession.ProjectPath
+	return m.db.CreatePlan(plan)
+}
+
+// UpdatePlan persists changes to an existing plan
+func (m *Manager) UpdatePlan(plan *Plan) error {
+	return m.db.UpdatePlan(plan)
+}
+
+// GetActivePlan returns the most recent approved or in-progress plan of the current session
+func (m *Manager) GetActivePlan() (*Plan, error) {
+	if m.currentSession == nil {
+		return nil, nil
+	}
+	return m.db.GetLatestResumablePlan(m.currentSession.ID)
+}
+
+// GetResumablePlans returns unfinished plans for the current session's project
+func (m *Manager) GetResumablePlans(limit int) ([]*Plan, error) {
+	if m.currentSession == nil {
+		return nil, nil
+	}
+	return m.db.GetResumablePlansByProject(m.currentSession.ProjectPath, limit)
+}
+
+// ResumePlan attaches a plan from an earlier session to the current session
+func (m *Manager) ResumePlan(plan *Plan) error {
+	if m.currentSession == nil {
+		return fmt.Errorf("no active session")
+	}
+
+	plan.SessionID = m.currentSession.ID
+	return m.db.UpdatePlan(plan)
+}
+
+// GetTodos returns the task list of the current session
+func (m *Manager) GetTodos() ([]TodoItem, error) {
+	if m.currentSession == nil {
+		return nil, nil
+	}
+	return m.db.GetTodos(m.currentSession.ID)
+}
+
+// SaveTodos replaces the task list of the current session
+func (m *Manager) SaveTodos(items []TodoItem) error {
+	if m.currentSession == nil {
+		return fmt.Errorf("no active session")
+	}
+	return m.db.ReplaceTodos(m.currentSession.ID, items)
+}
+
+// RecordUsage stores the token usage of an API call in the current session
+func (m *Manager) RecordUsage(usage *Usage) error {
+	if m.currentSession == nil {
+		return nil
+	}
+
+	usage.SessionID = m.currentSession.ID
+	usage.CreatedAt = time.Now()
+	return m.db.SaveUsage(usage)
+}
+
+// GetSessionUsage returns the token usage of the current session grouped by model
+func (m *Manager) GetSessionUsage() ([]*UsageSummary, error) {
+	if m.currentSession == nil {
+		return nil, nil
+	}
+	return m.db.GetSessionUsage(m.currentSession.ID)
+}
+
+// GetUsageSince returns the token usage across all projects since the given time
+func (m *Manager) GetUsageSince(since time.Time) ([]*UsageSummary, error) {
+	return m.db.GetUsageSince(since)
+}
+
+// SearchMessages searches the messages of all sessions
+func (m *Manager) SearchMessages(query string, opts SearchOptions) ([]*SearchResult, error) {
+	return m.db.SearchMessages(query, opts)
+}
+
+// SearchHistory searches earlier sessions. Unless allProjects is set, only
+// sessions of the current project are searched. The current session is
+// always left out because its messages are already in the conversation.
+func (m *Manager) SearchHistory(query string, allProjects bool, limit int) ([]*SearchResult, error) {
+	opts := SearchOptions{Limit: limit}
+	if m.currentSession != nil {
+		opts.ExcludeSessionID = m.currentSession.ID
+		if !allProjects {
+			opts.ProjectPath = m.currentSession.ProjectPath
+		}
+	}
+	return m.db.SearchMessages(query, opts)
+}
+
+// GetRepoMapFiles returns the cached repository map of a project
+func (m *Manager) GetRepoMapFiles(projectPath string) ([]RepoMapFile, error) {
+	return m.db.GetRepoMapFiles(projectPath)
+}
+
+// SaveRepoMapFiles caches repository map entries of a project
+func (m *Manager) SaveRepoMapFiles(projectPath string, files []RepoMapFile) error {
+	return m.db.SaveRepoMapFiles(projectPath, files)
+}
+
+// DeleteRepoMapFiles removes cached repository map entries of a project
+func (m *Manager) DeleteRepoMapFiles(projectPath string, paths []string) error {
+	return m.db.DeleteRepoMapFiles(projectPath, paths)
+}
+
+// GetIndexedFiles returns the files held by the semantic index of a project
+func (m *Manager) GetIndexedFiles(projectPath string) ([]IndexedFile, error) {
+	return m.db.GetIndexedFiles(projectPath)
+}
+
+// ReplaceFileChunks replaces the indexed chunks of a file
+func (m *Manager) ReplaceFileChunks(projectPath string, file IndexedFile, chunks []CodeChunk) error {
+	return m.db.ReplaceFileChunks(projectPath, file, chunks)
+}
+
+// DeleteIndexedFiles removes files from the semantic index of a project
+func (m *Manager) DeleteIndexedFiles(projectPath string, paths []string) error {
+	return m.db.DeleteIndexedFiles(projectPath, paths)
+}
+
+// GetCodeChunks returns all indexed chunks of a project
+func (m *Manager) GetCodeChunks(projectPath string) ([]CodeChunk, error) {
+	return m.db.GetCodeChunks(projectPath)
+}
+
+// ResolveSessionID returns the ID of the session with the given ID or unique ID prefix
+func (m *Manager) ResolveSessionID(prefix string) (string, error) {
+	return m.db.ResolveSessionID(prefix)
+}
+
+// ExportSession returns a portable copy of a session with its messages and usage records
+func (m *Manager) ExportSession(sessionID string) (*SessionExport, error) {
+	session, err := m.db.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := m.db.GetSessionMessages(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := m.db.GetUsageRecords(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// ピン留めとフォーク元はエクスポートしたDBだけの情報（メッセージIDは取り込むと変わる）
+	session.Pinned = false
+	session.ParentSessionID = ""
+	session.ForkPoint = 0
+	return &SessionExport{
+		Version:    SessionExportVersion,
+		ExportedAt: time.Now(),
+		Session:    *session,
+		Messages:   messages,
+		Usage:      usage,
+	}, nil
+}
+
+// ForkSession starts a new session whose history is a copy of the session
+// containing the message up to and including that message, and makes it the
+// current session. The previous current session is ended. While a session is
+// open only messages of its project can be forked.
+func (m *Manager) ForkSession(messageID int, modelUsed string) (*Session, error) {
+	sessionID, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	session := &Session{
+		ID:        sessionID.String(),
+		StartedAt: time.Now(),
+		ModelUsed: modelUsed,
+	}
+	if m.currentSession != nil {
+		session.ProjectPath = m.currentSession.ProjectPath
+	}
+	if err := m.db.ForkSession(session, messageID); err != nil {
+		return nil, err
+	}
+
+	if m.currentSession != nil && m.currentSession.IsActive() {
+		if err := m.EndSession(); err != nil {
+			return nil, err
+		}
+	}
+	m.currentSession = session
+	return session, nil
+}
+
+// ImportSession stores an exported session. A non-empty projectPath replaces
+// the project of the session, so that it shows up for another checkout.
+func (m *Manager) ImportSession(export *SessionExport, projectPath string) (*Session, error) {
+	if export.Version < 1 || export.Version > SessionExportVersion {
+		return nil, fmt.Errorf("unsupported export version %d", export.Version)
+	}
+	if export.Session.ID == "" {
+		return nil, fmt.Errorf("export has no session")
+	}
+	if projectPath != "" {
+		export.Session.ProjectPath = projectPath
+	}
+	if err := m.db.ImportSession(export); err != nil {
+		return nil, err
+	}
+	return m.db.GetSession(export.Session.ID)
+}
+
+// PruneSessions removes the sessions the retention policy no longer keeps and
+// returns them. With dryRun the sessions are only reported. The current
+// session is never pruned.
+func (m *Manager) PruneSessions(policy RetentionPolicy, dryRun bool) ([]*PrunedSession, error) {
+	keep := ""
+	if m.currentSession != nil {
+		keep = m.currentSession.ID
+	}
+	sessions, err := m.db.FindPrunableSessions(policy, keep, time.Now())
+	if err != nil || dryRun || len(sessions) == 0 {
+		return sessions, err
+	}
+
+	ids := make([]string, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+	}
+	if err := m.db.DeleteSessions(ids); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Vacuum rebuilds the database file to return the space of deleted rows
+func (m *Manager) Vacuum() error {
+	return m.db.Vacuum()
+}
+
+// SetSessionPinned pins or unpins the current session
+func (m *Manager) SetSessionPinned(pinned bool) error {
+	if m.currentSession == nil {
+		return fmt.Errorf("no active session")
+	}
+	if err := m.db.SetSessionPinned(m.currentSession.ID, pinned); err != nil {
+		return err
+	}
+	m.currentSession.Pinned = pinned
+	return nil
+}
+
 // DeleteSession deletes a session and all its messages
 func (m *Manager) DeleteSession(sessionID string) error {
 	// If deleting current session, clear it
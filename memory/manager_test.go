@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentManagers runs several managers, as separate nebula processes
+// would, that start sessions and write messages to one database at once
+func TestConcurrentManagers(t *testing.T) {
+	const (
+		managers = 8
+		messages = 25
+	)
+	dbPath := filepath.Join(t.TempDir(), "memory.db")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, managers)
+	ids := make(chan string, managers)
+	for i := 0; i < managers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			m, err := NewManager(dbPath)
+			if err != nil {
+				errs <- fmt.Errorf("manager %d: %w", i, err)
+				return
+			}
+			defer m.Close()
+
+			session, err := m.StartSession("/project", "gpt-4.1-nano")
+			if err != nil {
+				errs <- fmt.Errorf("manager %d: %w", i, err)
+				return
+			}
+			ids <- session.ID
+
+			for j := 0; j < messages; j++ {
+				if _, err := m.SaveMessage("user", fmt.Sprintf("message %d from manager %d", j, i), nil, nil); err != nil {
+					errs <- fmt.Errorf("manager %d: %w", i, err)
+					return
+				}
+				if err := m.RecordUsage(&Usage{Model: "gpt-4.1-nano", PromptTokens: 10, CompletionTokens: 5}); err != nil {
+					errs <- fmt.Errorf("manager %d: %w", i, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	close(ids)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	seen := make(map[string]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("duplicate session ID %s", id)
+		}
+		seen[id] = true
+	}
+
+	m, err := NewManager(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	sessions, err := m.GetSessionsByProject("/project", managers*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != managers {
+		t.Fatalf("got %d sessions, want %d", len(sessions), managers)
+	}
+	for _, session := range sessions {
+		if session.MessageCount != messages {
+			t.Errorf("session %s has %d messages, want %d", session.ID, session.MessageCount, messages)
+		}
+	}
+}
+
+// TestDeleteForkParent keeps the forks of a deleted session and turns them
+// into top-level sessions
+func TestDeleteForkParent(t *testing.T) {
+	m, err := NewManager(filepath.Join(t.TempDir(), "memory.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	parent, err := m.StartSession("/project", "gpt-4.1-nano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := m.SaveMessage("user", "hello", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork, err := m.ForkSession(msg.ID, "gpt-4.1-nano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.ParentSessionID != parent.ID {
+		t.Fatalf("got parent %q, want %q", fork.ParentSessionID, parent.ID)
+	}
+
+	if err := m.db.DeleteSession(parent.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := m.GetSessionsByProject("/project", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != fork.ID {
+		t.Fatalf("got %d sessions, want only the fork", len(sessions))
+	}
+	if sessions[0].ParentSessionID != "" || sessions[0].ForkPoint != 0 {
+		t.Errorf("fork still points to %q at #%d after its parent was deleted", sessions[0].ParentSessionID, sessions[0].ForkPoint)
+	}
+	if sessions[0].MessageCount != 1 {
+		t.Errorf("got %d messages in the fork, want 1", sessions[0].MessageCount)
+	}
+}
@@ -0,0 +1,185 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Migration is one versioned change to the database schema. Migrations are
+// applied in order, each in its own transaction, and PRAGMA user_version
+// records the version of the last one applied.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(tx *sql.Tx) error
+}
+
+// migrations lists every schema change in order. Add new tables and columns
+// here as a new version instead of changing an existing migration.
+var migrations = []Migration{
+	{Version: 1, Description: "baseline schema", Apply: migrateBaseline},
+	{Version: 2, Description: "pinned sessions", Apply: migratePinnedSessions},
+	{Version: 3, Description: "session forks", Apply: migrateSessionForks},
+}
+
+// migratePinnedSessions adds the flag that protects a session from pruning
+func migratePinnedSessions(tx *sql.Tx) error {
+	_, err := tx.Exec("ALTER TABLE sessions ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0")
+	return err
+}
+
+// migrateSessionForks records which session and message a session was forked from
+func migrateSessionForks(tx *sql.Tx) error {
+	if _, err := tx.Exec("ALTER TABLE sessions ADD COLUMN parent_session_id TEXT"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("ALTER TABLE sessions ADD COLUMN fork_point INTEGER")
+	return err
+}
+
+// MigrationStatus reports whether a migration has been applied to a database
+type MigrationStatus struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Applied     bool   `json:"applied"`
+}
+
+// MigrationResult describes a migration run
+type MigrationResult struct {
+	From    int      // 実行前のスキーマバージョン
+	To      int      // 実行後のスキーマバージョン
+	Backups []string // マイグレーション前に作成したバックアップ
+}
+
+// LatestSchemaVersion returns the version the migrations bring a database to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// GetMigrationStatus reports the schema version of a database and the state
+// of each migration without applying any of them
+func GetMigrationStatus(dbPath string) (int, []MigrationStatus, error) {
+	d, err := openDatabase(dbPath)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer d.Close()
+
+	version, err := schemaVersion(d.db)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Version: m.Version, Description: m.Description, Applied: m.Version <= version}
+	}
+	return version, statuses, nil
+}
+
+// Migrate applies the pending migrations to a database
+func Migrate(dbPath string) (*MigrationResult, error) {
+	d, err := openDatabase(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return d.migrate()
+}
+
+// migrate applies the pending migrations. The database file is backed up
+// before each migration unless it was empty when the run started.
+func (d *Database) migrate() (*MigrationResult, error) {
+	version, err := schemaVersion(d.db)
+	if err != nil {
+		return nil, err
+	}
+	result := &MigrationResult{From: version, To: version}
+
+	// 新しく作成したDBにはバックアップする内容がない
+	var tables int
+	if err := d.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables); err != nil {
+		return nil, fmt.Errorf("failed to inspect database: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= result.To {
+			continue
+		}
+
+		if tables > 0 {
+			backup, err := d.backup(result.To)
+			if err != nil {
+				return result, fmt.Errorf("failed to back up database before migration %d: %w", m.Version, err)
+			}
+			result.Backups = append(result.Backups, backup)
+		}
+
+		applied, err := d.applyMigration(m)
+		if err != nil {
+			return result, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+		if applied {
+			result.To = m.Version
+		} else {
+			// 同時に起動した別のプロセスが先に適用した
+			if result.To, err = schemaVersion(d.db); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// applyMigration runs a migration in a transaction and records its version.
+// It returns false when another process applied the migration first.
+func (d *Database) applyMigration(m Migration) (bool, error) {
+	tx, err := d.begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// 書き込みロックを取った後にバージョンを確認し直す
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return false, err
+	}
+	if version >= m.Version {
+		return false, nil
+	}
+
+	if err := m.Apply(tx); err != nil {
+		return false, err
+	}
+	// PRAGMAにはプレースホルダーを使えない
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", m.Version)); err != nil {
+		return false, fmt.Errorf("failed to record schema version: %w", err)
+	}
+	return true, tx.Commit()
+}
+
+// backup copies the database to a file next to it with VACUUM INTO and
+// returns its path
+func (d *Database) backup(version int) (string, error) {
+	path := fmt.Sprintf("%s.v%d-%s.bak", d.path, version, time.Now().Format("20060102-150405"))
+	if _, err := os.Stat(path); err == nil {
+		// 同じ秒に別のプロセスがバックアップを作成済み
+		return path, nil
+	}
+	if _, err := d.exec("VACUUM INTO ?", path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// schemaVersion returns the version of the last migration applied
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
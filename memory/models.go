@@ -11,6 +11,11 @@ type Session struct {
 	EndedAt     *time.Time `json:"ended_at,omitempty"`
 	ProjectPath string    `json:"project_path"`
 	ModelUsed   string    `json:"model_used"`
+	Title       string    `json:"title,omitempty"`   // 会話から生成した短いタイトル（/renameで変更できる）
+	Summary     string    `json:"summary,omitempty"` // 会話の要約
+	Pinned      bool      `json:"pinned,omitempty"`  // 古くなっても削除しない
+	ParentSessionID string `json:"parent_session_id,omitempty"` // フォーク元のセッション
+	ForkPoint       int    `json:"fork_point,omitempty"`        // フォーク元のどのメッセージまでをコピーしたか
 }
 
 // Message represents a single message in the conversation
@@ -22,6 +27,7 @@ type Message struct {
 	Content     string    `json:"content"`
 	ToolCalls   *string   `json:"tool_calls,omitempty"`   // JSON string
 	ToolResults *string   `json:"tool_results,omitempty"` // JSON string
+	Model       string    `json:"model,omitempty"`        // アシスタントの応答を生成したモデル
 }
 
 // SessionSummary represents a brief summary of a session for listing
@@ -33,6 +39,177 @@ type SessionSummary struct {
 	ModelUsed   string    `json:"model_used"`
 	MessageCount int      `json:"message_count"`
 	LastMessage  string   `json:"last_message"`
+	Title        string   `json:"title,omitempty"`
+	Summary      string   `json:"summary,omitempty"`
+	Pinned       bool     `json:"pinned,omitempty"`
+	ParentSessionID string `json:"parent_session_id,omitempty"`
+	ForkPoint       int    `json:"fork_point,omitempty"`
+}
+
+// Plan statuses
+const (
+	PlanStatusDraft      = "draft"
+	PlanStatusApproved   = "approved"
+	PlanStatusInProgress = "in_progress"
+	PlanStatusCompleted  = "completed"
+	PlanStatusRejected   = "rejected"
+)
+
+// Plan step statuses
+const (
+	StepStatusPending    = "pending"
+	StepStatusInProgress = "in_progress"
+	StepStatusDone       = "done"
+)
+
+// Plan represents a structured plan produced in PLAN mode
+type Plan struct {
+	ID          int        `json:"id"`
+	SessionID   string     `json:"session_id"`
+	ProjectPath string     `json:"project_path"`
+	Goal        string     `json:"goal"`
+	Steps       []PlanStep `json:"steps"`
+	Files       []string   `json:"files"`
+	Risks       []string   `json:"risks"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// PlanStep represents a single step of a plan
+type PlanStep struct {
+	Description string `json:"description"`
+	Status      string `json:"status"` // 'pending', 'in_progress', 'done'
+}
+
+// Progress returns the number of finished steps and the total number of steps
+func (p *Plan) Progress() (done, total int) {
+	for _, step := range p.Steps {
+		if step.Status == StepStatusDone {
+			done++
+		}
+	}
+	return done, len(p.Steps)
+}
+
+// NextStep returns the index of the first unfinished step, or -1 if all steps are done
+func (p *Plan) NextStep() int {
+	for i, step := range p.Steps {
+		if step.Status != StepStatusDone {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsResumable returns true if the plan was approved but not yet completed
+func (p *Plan) IsResumable() bool {
+	return p.Status == PlanStatusApproved || p.Status == PlanStatusInProgress
+}
+
+// Todo statuses
+const (
+	TodoStatusPending    = "pending"
+	TodoStatusInProgress = "in_progress"
+	TodoStatusDone       = "done"
+)
+
+// TodoItem represents an entry of the agent-maintained task list
+type TodoItem struct {
+	Content string `json:"content"`
+	Status  string `json:"status"` // 'pending', 'in_progress', 'done'
+}
+
+// Usage represents the token usage of a single API call
+type Usage struct {
+	ID               int       `json:"id"`
+	SessionID        string    `json:"session_id"`
+	MessageID        *int      `json:"message_id,omitempty"` // 応答として保存されたメッセージ
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CachedTokens     int       `json:"cached_tokens"`
+	ReasoningTokens  int       `json:"reasoning_tokens"` // 出力トークンのうち推論に使われた分
+	Cost             float64   `json:"cost"`             // USD
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// UsageSummary aggregates token usage for a project and model
+type UsageSummary struct {
+	ProjectPath      string  `json:"project_path"`
+	Model            string  `json:"model"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	ReasoningTokens  int     `json:"reasoning_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// RepoSymbol is a top-level symbol of a source file
+type RepoSymbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`      // 'func', 'method', 'type', 'class', 'const', 'var' など
+	Signature string `json:"signature"` // 本体を除いた宣言
+	Line      int    `json:"line"`
+}
+
+// RepoMapFile is the cached repository map entry of a source file
+type RepoMapFile struct {
+	Path       string       `json:"path"`     // プロジェクトルートからの相対パス（スラッシュ区切り）
+	ModTime    int64        `json:"mod_time"` // 解析したときの更新時刻（UnixNano）
+	Size       int64        `json:"size"`
+	Symbols    []RepoSymbol `json:"symbols"`
+	References []string     `json:"references"` // ファイル内で使われている識別子
+}
+
+// IndexedFile records which version of a file the semantic index holds
+type IndexedFile struct {
+	Path     string `json:"path"`
+	ModTime  int64  `json:"mod_time"` // 索引を作成したときの更新時刻（UnixNano）
+	Size     int64  `json:"size"`
+	Embedder string `json:"embedder"` // 埋め込みに使ったモデル（変わった場合は作り直す）
+}
+
+// CodeChunk is a piece of a source file stored in the semantic index
+type CodeChunk struct {
+	ID        int       `json:"id"`
+	Path      string    `json:"path"`
+	StartLine int       `json:"start_line"`
+	EndLine   int       `json:"end_line"`
+	Symbol    string    `json:"symbol,omitempty"` // チャンクが表す関数や型の名前
+	Content   string    `json:"content"`
+	Embedding []float32 `json:"-"`
+}
+
+// SessionExportVersion is the version of the session export format
+const SessionExportVersion = 1
+
+// SessionExport is a portable copy of a session. Message IDs are those of the
+// exporting database; importing assigns new ones.
+type SessionExport struct {
+	Version    int        `json:"version"`
+	ExportedAt time.Time  `json:"exported_at"`
+	Session    Session    `json:"session"`
+	Messages   []*Message `json:"messages"`
+	Usage      []*Usage   `json:"usage"` // API呼び出しごとのトークン使用量（message_idは上のメッセージを指す）
+}
+
+// SearchResult is a message that matched a history search
+type SearchResult struct {
+	MessageID   int       `json:"message_id"`
+	SessionID   string    `json:"session_id"`
+	ProjectPath string    `json:"project_path"`
+	Role        string    `json:"role"`
+	Timestamp   time.Time `json:"timestamp"`
+	Snippet     string    `json:"snippet"` // 一致箇所の前後（一致部分は[]で囲む）
+}
+
+// SearchOptions narrows a history search
+type SearchOptions struct {
+	ProjectPath      string // 空の場合は全プロジェクト
+	ExcludeSessionID string // 検索対象から外すセッション
+	Limit            int
 }
 
 // IsActive returns true if the session is still active (not ended)
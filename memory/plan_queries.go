@@ -0,0 +1,169 @@
+package memory
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CreatePlan creates a new plan in the database
+func (d *Database) CreatePlan(plan *Plan) error {
+	steps, files, risks, err := marshalPlanFields(plan)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	query := `
+		INSERT INTO plans (session_id, project_path, goal, steps, files, risks, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := d.exec(query, plan.SessionID, plan.ProjectPath, plan.Goal, steps, files, risks, plan.Status, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to create plan: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	plan.ID = int(id)
+	plan.CreatedAt = now
+	plan.UpdatedAt = now
+
+	return nil
+}
+
+// UpdatePlan updates the contents and status of a plan
+func (d *Database) UpdatePlan(plan *Plan) error {
+	steps, files, risks, err := marshalPlanFields(plan)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	query := `
+		UPDATE plans
+		SET session_id = ?, goal = ?, steps = ?, files = ?, risks = ?, status = ?, updated_at = ?
+		WHERE id = ?
+	`
+	if _, err := d.exec(query, plan.SessionID, plan.Goal, steps, files, risks, plan.Status, now, plan.ID); err != nil {
+		return fmt.Errorf("failed to update plan: %w", err)
+	}
+	plan.UpdatedAt = now
+
+	return nil
+}
+
+// GetPlan retrieves a plan by ID
+func (d *Database) GetPlan(planID int) (*Plan, error) {
+	query := `
+		SELECT id, session_id, project_path, goal, steps, files, risks, status, created_at, updated_at
+		FROM plans
+		WHERE id = ?
+	`
+	plan, err := scanPlan(d.db.QueryRow(query, planID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+	return plan, nil
+}
+
+// GetLatestResumablePlan retrieves the newest approved or in-progress plan of a session
+func (d *Database) GetLatestResumablePlan(sessionID string) (*Plan, error) {
+	query := `
+		SELECT id, session_id, project_path, goal, steps, files, risks, status, created_at, updated_at
+		FROM plans
+		WHERE session_id = ? AND status IN (?, ?)
+		ORDER BY updated_at DESC
+		LIMIT 1
+	`
+	plan, err := scanPlan(d.db.QueryRow(query, sessionID, PlanStatusApproved, PlanStatusInProgress))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest plan: %w", err)
+	}
+	return plan, nil
+}
+
+// GetResumablePlansByProject retrieves approved or in-progress plans for a project
+func (d *Database) GetResumablePlansByProject(projectPath string, limit int) ([]*Plan, error) {
+	query := `
+		SELECT id, session_id, project_path, goal, steps, files, risks, status, created_at, updated_at
+		FROM plans
+		WHERE project_path = ? AND status IN (?, ?)
+		ORDER BY updated_at DESC
+		LIMIT ?
+	`
+	rows, err := d.db.Query(query, projectPath, PlanStatusApproved, PlanStatusInProgress, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plans by project: %w", err)
+	}
+	defer rows.Close()
+
+	var plans []*Plan
+	for rows.Next() {
+		plan, err := scanPlan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan plan: %w", err)
+		}
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanPlan reads a plan row and decodes its JSON columns
+func scanPlan(row rowScanner) (*Plan, error) {
+	var plan Plan
+	var steps string
+	var files, risks sql.NullString
+	err := row.Scan(
+		&plan.ID, &plan.SessionID, &plan.ProjectPath, &plan.Goal,
+		&steps, &files, &risks, &plan.Status, &plan.CreatedAt, &plan.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(steps), &plan.Steps); err != nil {
+		return nil, fmt.Errorf("failed to decode plan steps: %w", err)
+	}
+	if files.Valid && files.String != "" {
+		if err := json.Unmarshal([]byte(files.String), &plan.Files); err != nil {
+			return nil, fmt.Errorf("failed to decode plan files: %w", err)
+		}
+	}
+	if risks.Valid && risks.String != "" {
+		if err := json.Unmarshal([]byte(risks.String), &plan.Risks); err != nil {
+			return nil, fmt.Errorf("failed to decode plan risks: %w", err)
+		}
+	}
+
+	return &plan, nil
+}
+
+// marshalPlanFields encodes the list columns of a plan as JSON
+func marshalPlanFields(plan *Plan) (steps, files, risks string, err error) {
+	stepsJSON, err := json.Marshal(plan.Steps)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to encode plan steps: %w", err)
+	}
+	filesJSON, err := json.Marshal(plan.Files)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to encode plan files: %w", err)
+	}
+	risksJSON, err := json.Marshal(plan.Risks)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to encode plan risks: %w", err)
+	}
+	return string(stepsJSON), string(filesJSON), string(risksJSON), nil
+}
@@ -11,7 +11,7 @@ func (d *Database) CreateSession(session *Session) error {
 		INSERT INTO sessions (id, started_at, project_path, model_used)
 		VALUES (?, ?, ?, ?)
 	`
-	_, err := d.db.Exec(query, session.ID, session.StartedAt, session.ProjectPath, session.ModelUsed)
+	_, err := d.exec(query, session.ID, session.StartedAt, session.ProjectPath, session.ModelUsed)
 	if err != nil {
 		return fmt.Errorf("failed to create session: %w", err)
 	}
@@ -21,21 +21,55 @@ func (d *Database) CreateSession(session *Session) error {
 // EndSession marks a session as ended
 func (d *Database) EndSession(sessionID string) error {
 	query := `UPDATE sessions SET ended_at = CURRENT_TIMESTAMP WHERE id = ?`
-	_, err := d.db.Exec(query, sessionID)
+	_, err := d.exec(query, sessionID)
 	if err != nil {
 		return fmt.Errorf("failed to end session: %w", err)
 	}
 	return nil
 }
 
+// UpdateSessionSummary stores a generated title and summary. A title set with
+// RenameSession is kept.
+func (d *Database) UpdateSessionSummary(sessionID, title, summary string) error {
+	query := `
+		UPDATE sessions
+		SET title = CASE WHEN title_custom = 1 THEN title ELSE ? END, summary = ?
+		WHERE id = ?
+	`
+	if _, err := d.exec(query, title, summary, sessionID); err != nil {
+		return fmt.Errorf("failed to update session summary: %w", err)
+	}
+	return nil
+}
+
+// RenameSession sets the title of a session. Generated titles no longer
+// replace it afterwards.
+func (d *Database) RenameSession(sessionID, title string) error {
+	query := `UPDATE sessions SET title = ?, title_custom = 1 WHERE id = ?`
+	if _, err := d.exec(query, title, sessionID); err != nil {
+		return fmt.Errorf("failed to rename session: %w", err)
+	}
+	return nil
+}
+
+// SetSessionPinned pins or unpins a session. Pinned sessions are never pruned.
+func (d *Database) SetSessionPinned(sessionID string, pinned bool) error {
+	if _, err := d.exec(`UPDATE sessions SET pinned = ? WHERE id = ?`, pinned, sessionID); err != nil {
+		return fmt.Errorf("failed to pin session: %w", err)
+	}
+	return nil
+}
+
 // GetSession retrieves a session by ID
 func (d *Database) GetSession(sessionID string) (*Session, error) {
-	query := `SELECT id, started_at, ended_at, project_path, model_used FROM sessions WHERE id = ?`
+	query := `SELECT id, started_at, ended_at, project_path, model_used, title, summary, pinned, parent_session_id, fork_point FROM sessions WHERE id = ?`
 	row := d.db.QueryRow(query, sessionID)
 
 	var session Session
 	var endedAt sql.NullTime
-	err := row.Scan(&session.ID, &session.StartedAt, &endedAt, &session.ProjectPath, &session.ModelUsed)
+	var parentSessionID sql.NullString
+	var forkPoint sql.NullInt64
+	err := row.Scan(&session.ID, &session.StartedAt, &endedAt, &session.ProjectPath, &session.ModelUsed, &session.Title, &session.Summary, &session.Pinned, &parentSessionID, &forkPoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
@@ -43,6 +77,8 @@ func (d *Database) GetSession(sessionID string) (*Session, error) {
 	if endedAt.Valid {
 		session.EndedAt = &endedAt.Time
 	}
+	session.ParentSessionID = parentSessionID.String
+	session.ForkPoint = int(forkPoint.Int64)
 
 	return &session, nil
 }
@@ -50,14 +86,15 @@ func (d *Database) GetSession(sessionID string) (*Session, error) {
 // GetSessionsByProject retrieves sessions for a specific project path
 func (d *Database) GetSessionsByProject(projectPath string, limit int) ([]*SessionSummary, error) {
 	query := `
-		SELECT s.id, s.started_at, s.ended_at, s.project_path, s.model_used,
+		SELECT s.id, s.started_at, s.ended_at, s.project_path, s.model_used, s.title, s.summary, s.pinned,
+			   s.parent_session_id, s.fork_point,
 			   COUNT(m.id) as message_count,
 			   COALESCE(
-				   (SELECT content FROM messages WHERE session_id = s.id ORDER BY timestamp DESC LIMIT 1),
+				   (SELECT content FROM messages WHERE session_id = s.id AND role != 'tool' ORDER BY timestamp DESC LIMIT 1),
 				   ''
 			   ) as last_message
 		FROM sessions s
-		LEFT JOIN messages m ON s.id = m.session_id
+		LEFT JOIN messages m ON s.id = m.session_id AND m.role != 'tool'
 		WHERE s.project_path = ?
 		GROUP BY s.id
 		ORDER BY s.started_at DESC
@@ -73,9 +110,12 @@ func (d *Database) GetSessionsByProject(projectPath string, limit int) ([]*Sessi
 	for rows.Next() {
 		var summary SessionSummary
 		var endedAt sql.NullTime
+		var parentSessionID sql.NullString
+		var forkPoint sql.NullInt64
 		err := rows.Scan(
 			&summary.ID, &summary.StartedAt, &endedAt, &summary.ProjectPath,
-			&summary.ModelUsed, &summary.MessageCount, &summary.LastMessage,
+			&summary.ModelUsed, &summary.Title, &summary.Summary, &summary.Pinned,
+			&parentSessionID, &forkPoint, &summary.MessageCount, &summary.LastMessage,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan session summary: %w", err)
@@ -84,6 +124,8 @@ func (d *Database) GetSessionsByProject(projectPath string, limit int) ([]*Sessi
 		if endedAt.Valid {
 			summary.EndedAt = &endedAt.Time
 		}
+		summary.ParentSessionID = parentSessionID.String
+		summary.ForkPoint = int(forkPoint.Int64)
 
 		sessions = append(sessions, &summary)
 	}
@@ -94,10 +136,14 @@ func (d *Database) GetSessionsByProject(projectPath string, limit int) ([]*Sessi
 // SaveMessage saves a message to the database
 func (d *Database) SaveMessage(message *Message) error {
 	query := `
-		INSERT INTO messages (session_id, timestamp, role, content, tool_calls, tool_results)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO messages (session_id, timestamp, role, content, tool_calls, tool_results, model)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := d.db.Exec(query, message.SessionID, message.Timestamp, message.Role, message.Content, message.ToolCalls, message.ToolResults)
+	var model sql.NullString
+	if message.Model != "" {
+		model = sql.NullString{String: message.Model, Valid: true}
+	}
+	result, err := d.exec(query, message.SessionID, message.Timestamp, message.Role, message.Content, message.ToolCalls, message.ToolResults, model)
 	if err != nil {
 		return fmt.Errorf("failed to save message: %w", err)
 	}
@@ -115,10 +161,10 @@ func (d *Database) SaveMessage(message *Message) error {
 // GetSessionMessages retrieves all messages for a session
 func (d *Database) GetSessionMessages(sessionID string) ([]*Message, error) {
 	query := `
-		SELECT id, session_id, timestamp, role, content, tool_calls, tool_results
+		SELECT id, session_id, timestamp, role, content, tool_calls, tool_results, model
 		FROM messages
 		WHERE session_id = ?
-		ORDER BY timestamp ASC
+		ORDER BY timestamp ASC, id ASC
 	`
 	rows, err := d.db.Query(query, sessionID)
 	if err != nil {
@@ -129,10 +175,10 @@ func (d *Database) GetSessionMessages(sessionID string) ([]*Message, error) {
 	var messages []*Message
 	for rows.Next() {
 		var message Message
-		var toolCalls, toolResults sql.NullString
+		var toolCalls, toolResults, model sql.NullString
 		err := rows.Scan(
 			&message.ID, &message.SessionID, &message.Timestamp,
-			&message.Role, &message.Content, &toolCalls, &toolResults,
+			&message.Role, &message.Content, &toolCalls, &toolResults, &model,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
@@ -144,6 +190,7 @@ func (d *Database) GetSessionMessages(sessionID string) ([]*Message, error) {
 		if toolResults.Valid {
 			message.ToolResults = &toolResults.String
 		}
+		message.Model = model.String
 
 		messages = append(messages, &message)
 	}
@@ -154,14 +201,15 @@ func (d *Database) GetSessionMessages(sessionID string) ([]*Message, error) {
 // GetRecentSessions retrieves the most recent sessions across all projects
 func (d *Database) GetRecentSessions(limit int) ([]*SessionSummary, error) {
 	query := `
-		SELECT s.id, s.started_at, s.ended_at, s.project_path, s.model_used,
+		SELECT s.id, s.started_at, s.ended_at, s.project_path, s.model_used, s.title, s.summary, s.pinned,
+			   s.parent_session_id, s.fork_point,
 			   COUNT(m.id) as message_count,
 			   COALESCE(
-				   (SELECT content FROM messages WHERE session_id = s.id ORDER BY timestamp DESC LIMIT 1),
+				   (SELECT content FROM messages WHERE session_id = s.id AND role != 'tool' ORDER BY timestamp DESC LIMIT 1),
 				   ''
 			   ) as last_message
 		FROM sessions s
-		LEFT JOIN messages m ON s.id = m.session_id
+		LEFT JOIN messages m ON s.id = m.session_id AND m.role != 'tool'
 		GROUP BY s.id
 		ORDER BY s.started_at DESC
 		LIMIT ?
@@ -176,9 +224,12 @@ func (d *Database) GetRecentSessions(limit int) ([]*SessionSummary, error) {
 	for rows.Next() {
 		var summary SessionSummary
 		var endedAt sql.NullTime
+		var parentSessionID sql.NullString
+		var forkPoint sql.NullInt64
 		err := rows.Scan(
 			&summary.ID, &summary.StartedAt, &endedAt, &summary.ProjectPath,
-			&summary.ModelUsed, &summary.MessageCount, &summary.LastMessage,
+			&summary.ModelUsed, &summary.Title, &summary.Summary, &summary.Pinned,
+			&parentSessionID, &forkPoint, &summary.MessageCount, &summary.LastMessage,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan session summary: %w", err)
@@ -187,6 +238,8 @@ func (d *Database) GetRecentSessions(limit int) ([]*SessionSummary, error) {
 		if endedAt.Valid {
 			summary.EndedAt = &endedAt.Time
 		}
+		summary.ParentSessionID = parentSessionID.String
+		summary.ForkPoint = int(forkPoint.Int64)
 
 		sessions = append(sessions, &summary)
 	}
@@ -196,25 +249,63 @@ func (d *Database) GetRecentSessions(limit int) ([]*SessionSummary, error) {
 
 // DeleteSession deletes a session and all its messages
 func (d *Database) DeleteSession(sessionID string) error {
-	tx, err := d.db.Begin()
+	return d.DeleteSessions([]string{sessionID})
+}
+
+// DeleteSessions deletes sessions together with their messages, plans, todos
+// and usage records in one transaction. The search index is updated by the
+// triggers on the messages table.
+func (d *Database) DeleteSessions(sessionIDs []string) error {
+	tx, err := d.begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	for _, sessionID := range sessionIDs {
+		if err := deleteSession(tx, sessionID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// deleteSession deletes a session and the rows that belong to it
+func deleteSession(tx *sql.Tx, sessionID string) error {
 	// Delete messages first
 	if _, err := tx.Exec("DELETE FROM messages WHERE session_id = ?", sessionID); err != nil {
 		return fmt.Errorf("failed to delete messages: %w", err)
 	}
 
+	// Delete plans
+	if _, err := tx.Exec("DELETE FROM plans WHERE session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to delete plans: %w", err)
+	}
+
+	// Delete todos
+	if _, err := tx.Exec("DELETE FROM todos WHERE session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to delete todos: %w", err)
+	}
+
+	// Delete usage records
+	if _, err := tx.Exec("DELETE FROM api_usage WHERE session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to delete usage: %w", err)
+	}
+
+	// フォークしたセッションは残し、最上位のセッションとして扱う
+	if _, err := tx.Exec("UPDATE sessions SET parent_session_id = NULL, fork_point = NULL WHERE parent_session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to detach forks: %w", err)
+	}
+
 	// Delete session
 	if _, err := tx.Exec("DELETE FROM sessions WHERE id = ?", sessionID); err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// GetRepoMapFiles retrieves the cached repository map of a project
+func (d *Database) GetRepoMapFiles(projectPath string) ([]RepoMapFile, error) {
+	query := `
+		SELECT path, mod_time, size, symbols, refs
+		FROM repo_map_files
+		WHERE project_path = ?
+		ORDER BY path
+	`
+	rows, err := d.db.Query(query, projectPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repo map: %w", err)
+	}
+	defer rows.Close()
+
+	var files []RepoMapFile
+	for rows.Next() {
+		var file RepoMapFile
+		var symbolsJSON, refsJSON string
+		if err := rows.Scan(&file.Path, &file.ModTime, &file.Size, &symbolsJSON, &refsJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan repo map file: %w", err)
+		}
+		if err := json.Unmarshal([]byte(symbolsJSON), &file.Symbols); err != nil {
+			return nil, fmt.Errorf("failed to parse symbols of %s: %w", file.Path, err)
+		}
+		if err := json.Unmarshal([]byte(refsJSON), &file.References); err != nil {
+			return nil, fmt.Errorf("failed to parse references of %s: %w", file.Path, err)
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// SaveRepoMapFiles inserts or replaces cached repository map entries
+func (d *Database) SaveRepoMapFiles(projectPath string, files []RepoMapFile) error {
+	tx, err := d.begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT OR REPLACE INTO repo_map_files (project_path, path, mod_time, size, symbols, refs, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	now := time.Now()
+	for _, file := range files {
+		symbolsJSON, err := json.Marshal(file.Symbols)
+		if err != nil {
+			return fmt.Errorf("failed to marshal symbols: %w", err)
+		}
+		refsJSON, err := json.Marshal(file.References)
+		if err != nil {
+			return fmt.Errorf("failed to marshal references: %w", err)
+		}
+		if _, err := tx.Exec(query, projectPath, file.Path, file.ModTime, file.Size, string(symbolsJSON), string(refsJSON), now); err != nil {
+			return fmt.Errorf("failed to save repo map file: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRepoMapFiles removes cached entries of files that no longer exist
+func (d *Database) DeleteRepoMapFiles(projectPath string, paths []string) error {
+	tx, err := d.begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, path := range paths {
+		if _, err := tx.Exec("DELETE FROM repo_map_files WHERE project_path = ? AND path = ?", projectPath, path); err != nil {
+			return fmt.Errorf("failed to delete repo map file: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
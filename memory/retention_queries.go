@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// recentActivity protects sessions that may still be open in another nebula
+// process. Sessions that are not ended cleanly (e.g. Ctrl-C) keep no end time,
+// so the last activity is used instead.
+const recentActivity = 24 * time.Hour
+
+// RetentionPolicy decides which sessions are pruned. Zero values disable a limit.
+type RetentionPolicy struct {
+	MaxSessions           int           // 全プロジェクトで残すセッション数
+	MaxSessionsPerProject int           // プロジェクトごとに残すセッション数
+	MaxAge                time.Duration // 最後のやり取りからこれより経ったセッションを削除する
+}
+
+// PrunedSession is a session removed, or to be removed, by a retention policy
+type PrunedSession struct {
+	ID           string    `json:"id"`
+	ProjectPath  string    `json:"project_path"`
+	Title        string    `json:"title,omitempty"`
+	LastActivity time.Time `json:"last_activity"`
+	MessageCount int       `json:"message_count"`
+	Reason       string    `json:"reason"`
+}
+
+// FindPrunableSessions returns the sessions the policy removes, oldest last.
+// Pinned sessions, recently active sessions and the session given as keep are
+// never returned; pinned sessions do not count toward the limits either.
+func (d *Database) FindPrunableSessions(policy RetentionPolicy, keep string, now time.Time) ([]*PrunedSession, error) {
+	// 最後のメッセージの時刻を最後のやり取りとみなす（メッセージがなければ開始時刻）
+	query := `
+		SELECT s.id, s.project_path, s.title, s.pinned, s.started_at, lm.timestamp,
+			   (SELECT COUNT(*) FROM messages WHERE session_id = s.id)
+		FROM sessions s
+		LEFT JOIN messages lm ON lm.id = (SELECT MAX(id) FROM messages WHERE session_id = s.id)
+	`
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*PrunedSession
+	pinned := make(map[string]bool)
+	for rows.Next() {
+		var session PrunedSession
+		var isPinned bool
+		var lastMessage sql.NullTime
+		if err := rows.Scan(&session.ID, &session.ProjectPath, &session.Title, &isPinned, &session.LastActivity, &lastMessage, &session.MessageCount); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		if lastMessage.Valid && lastMessage.Time.After(session.LastActivity) {
+			session.LastActivity = lastMessage.Time
+		}
+		pinned[session.ID] = isPinned
+		sessions = append(sessions, &session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 新しい順に数え、上限を超えた分と古すぎる分を削除対象にする
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastActivity.After(sessions[j].LastActivity) })
+	var prunable []*PrunedSession
+	kept := 0
+	keptPerProject := make(map[string]int)
+	for _, session := range sessions {
+		if pinned[session.ID] {
+			continue
+		}
+		protected := session.ID == keep || now.Sub(session.LastActivity) < recentActivity
+
+		switch {
+		case protected:
+		case policy.MaxAge > 0 && now.Sub(session.LastActivity) > policy.MaxAge:
+			session.Reason = fmt.Sprintf("inactive for %d days", int(now.Sub(session.LastActivity).Hours()/24))
+		case policy.MaxSessionsPerProject > 0 && keptPerProject[session.ProjectPath] >= policy.MaxSessionsPerProject:
+			session.Reason = fmt.Sprintf("more than %d sessions in project", policy.MaxSessionsPerProject)
+		case policy.MaxSessions > 0 && kept >= policy.MaxSessions:
+			session.Reason = fmt.Sprintf("more than %d sessions", policy.MaxSessions)
+		}
+
+		if session.Reason != "" {
+			prunable = append(prunable, session)
+			continue
+		}
+		kept++
+		keptPerProject[session.ProjectPath]++
+	}
+	return prunable, nil
+}
+
+// Vacuum rebuilds the database file to return the space of deleted rows
+func (d *Database) Vacuum() error {
+	if _, err := d.exec("VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
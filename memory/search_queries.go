@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// minTrigramTerm is the shortest term the trigram index can match. Shorter
+// terms are matched with LIKE instead.
+const minTrigramTerm = 3
+
+// SearchMessages finds messages whose content or tool results contain every
+// term of the query, best matches first
+func (d *Database) SearchMessages(query string, opts SearchOptions) ([]*SearchResult, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("search query is empty")
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 20
+	}
+
+	// 3文字以上の語は全文検索、短い語は部分一致で絞り込む
+	var phrases []string
+	var conditions []string
+	var args []interface{}
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) >= minTrigramTerm {
+			phrases = append(phrases, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+			continue
+		}
+		pattern := "%" + escapeLike(term) + "%"
+		conditions = append(conditions, `(m.content LIKE ? ESCAPE '\' OR m.tool_results LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+
+	var sqlQuery string
+	if len(phrases) > 0 {
+		sqlQuery = `
+			SELECT m.id, m.session_id, s.project_path, m.role, m.timestamp,
+				   snippet(messages_fts, -1, '[', ']', '…', 24)
+			FROM messages_fts
+			JOIN messages m ON m.id = messages_fts.rowid
+			JOIN sessions s ON s.id = m.session_id
+			WHERE messages_fts MATCH ?
+		`
+		args = append([]interface{}{strings.Join(phrases, " ")}, args...)
+	} else {
+		sqlQuery = `
+			SELECT m.id, m.session_id, s.project_path, m.role, m.timestamp,
+				   substr(COALESCE(NULLIF(m.content, ''), m.tool_results, ''), 1, 200)
+			FROM messages m
+			JOIN sessions s ON s.id = m.session_id
+			WHERE 1 = 1
+		`
+	}
+	for _, condition := range conditions {
+		sqlQuery += " AND " + condition
+	}
+	if opts.ProjectPath != "" {
+		sqlQuery += " AND s.project_path = ?"
+		args = append(args, opts.ProjectPath)
+	}
+	if opts.ExcludeSessionID != "" {
+		sqlQuery += " AND m.session_id != ?"
+		args = append(args, opts.ExcludeSessionID)
+	}
+	if len(phrases) > 0 {
+		sqlQuery += " ORDER BY rank, m.timestamp DESC"
+	} else {
+		sqlQuery += " ORDER BY m.timestamp DESC"
+	}
+	sqlQuery += " LIMIT ?"
+	args = append(args, opts.Limit)
+
+	rows, err := d.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		var result SearchResult
+		if err := rows.Scan(&result.MessageID, &result.SessionID, &result.ProjectPath, &result.Role, &result.Timestamp, &result.Snippet); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		result.Snippet = strings.Join(strings.Fields(result.Snippet), " ")
+		results = append(results, &result)
+	}
+
+	return results, rows.Err()
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(term string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(term)
+}
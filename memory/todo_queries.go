@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReplaceTodos replaces the whole task list of a session
+func (d *Database) ReplaceTodos(sessionID string, items []TodoItem) error {
+	tx, err := d.begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM todos WHERE session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to clear todos: %w", err)
+	}
+
+	now := time.Now()
+	for i, item := range items {
+		query := `
+			INSERT INTO todos (session_id, position, content, status, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+		`
+		if _, err := tx.Exec(query, sessionID, i, item.Content, item.Status, now); err != nil {
+			return fmt.Errorf("failed to save todo: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetTodos retrieves the task list of a session in order
+func (d *Database) GetTodos(sessionID string) ([]TodoItem, error) {
+	query := `
+		SELECT content, status
+		FROM todos
+		WHERE session_id = ?
+		ORDER BY position ASC
+	`
+	rows, err := d.db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todos: %w", err)
+	}
+	defer rows.Close()
+
+	var items []TodoItem
+	for rows.Next() {
+		var item TodoItem
+		if err := rows.Scan(&item.Content, &item.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan todo: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ResolveSessionID returns the ID of the session that has the given ID or ID
+// prefix. A prefix must match exactly one session.
+func (d *Database) ResolveSessionID(prefix string) (string, error) {
+	rows, err := d.db.Query(`SELECT id FROM sessions WHERE id = ? OR substr(id, 1, length(?)) = ? LIMIT 2`, prefix, prefix, prefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to find session: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return "", fmt.Errorf("failed to scan session: %w", err)
+		}
+		if id == prefix {
+			return id, nil
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("session %s not found", prefix)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("session ID prefix %s is ambiguous", prefix)
+	}
+}
+
+// GetUsageRecords returns the usage records of a session in the order of the calls
+func (d *Database) GetUsageRecords(sessionID string) ([]*Usage, error) {
+	query := `
+		SELECT id, session_id, message_id, model, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost, created_at
+		FROM api_usage
+		WHERE session_id = ?
+		ORDER BY id
+	`
+	rows, err := d.db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage records: %w", err)
+	}
+	defer rows.Close()
+
+	records := []*Usage{}
+	for rows.Next() {
+		var usage Usage
+		var messageID sql.NullInt64
+		err := rows.Scan(
+			&usage.ID, &usage.SessionID, &messageID, &usage.Model,
+			&usage.PromptTokens, &usage.CompletionTokens, &usage.CachedTokens, &usage.ReasoningTokens,
+			&usage.Cost, &usage.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage record: %w", err)
+		}
+		if messageID.Valid {
+			id := int(messageID.Int64)
+			usage.MessageID = &id
+		}
+		records = append(records, &usage)
+	}
+
+	return records, rows.Err()
+}
+
+// ImportSession stores an exported session with its messages and usage
+// records in one transaction. Messages get new IDs; usage records are linked
+// to the new IDs of their messages.
+func (d *Database) ImportSession(export *SessionExport) error {
+	tx, err := d.begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM sessions WHERE id = ?", export.Session.ID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check session: %w", err)
+	}
+	if exists > 0 {
+		return fmt.Errorf("session %s already exists", export.Session.ID)
+	}
+
+	session := export.Session
+	_, err = tx.Exec(`
+		INSERT INTO sessions (id, started_at, ended_at, project_path, model_used, title, summary, title_custom)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0)
+	`, session.ID, session.StartedAt, session.EndedAt, session.ProjectPath, session.ModelUsed, session.Title, session.Summary)
+	if err != nil {
+		return fmt.Errorf("failed to import session: %w", err)
+	}
+
+	messageIDs := make(map[int]int64)
+	for _, message := range export.Messages {
+		var model sql.NullString
+		if message.Model != "" {
+			model = sql.NullString{String: message.Model, Valid: true}
+		}
+		result, err := tx.Exec(`
+			INSERT INTO messages (session_id, timestamp, role, content, tool_calls, tool_results, model)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, session.ID, message.Timestamp, message.Role, message.Content, message.ToolCalls, message.ToolResults, model)
+		if err != nil {
+			return fmt.Errorf("failed to import message: %w", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get last insert ID: %w", err)
+		}
+		messageIDs[message.ID] = id
+	}
+
+	for _, usage := range export.Usage {
+		var messageID sql.NullInt64
+		if usage.MessageID != nil {
+			if id, ok := messageIDs[*usage.MessageID]; ok {
+				messageID = sql.NullInt64{Int64: id, Valid: true}
+			}
+		}
+		_, err := tx.Exec(`
+			INSERT INTO api_usage (session_id, message_id, model, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, session.ID, messageID, usage.Model,
+			usage.PromptTokens, usage.CompletionTokens, usage.CachedTokens, usage.ReasoningTokens,
+			usage.Cost, usage.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to import usage record: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SaveUsage stores the token usage of an API call
+func (d *Database) SaveUsage(usage *Usage) error {
+	query := `
+		INSERT INTO api_usage (session_id, message_id, model, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := d.exec(query,
+		usage.SessionID, usage.MessageID, usage.Model,
+		usage.PromptTokens, usage.CompletionTokens, usage.CachedTokens, usage.ReasoningTokens,
+		usage.Cost, usage.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save usage: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	usage.ID = int(id)
+
+	return nil
+}
+
+// GetSessionUsage aggregates the token usage of a session by model
+func (d *Database) GetSessionUsage(sessionID string) ([]*UsageSummary, error) {
+	query := `
+		SELECT s.project_path, u.model, COUNT(*),
+			   SUM(u.prompt_tokens), SUM(u.completion_tokens), SUM(u.cached_tokens), SUM(u.reasoning_tokens), SUM(u.cost)
+		FROM api_usage u
+		JOIN sessions s ON s.id = u.session_id
+		WHERE u.session_id = ?
+		GROUP BY s.project_path, u.model
+		ORDER BY u.model
+	`
+	rows, err := d.db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session usage: %w", err)
+	}
+	defer rows.Close()
+
+	return scanUsageSummaries(rows)
+}
+
+// GetUsageSince aggregates the token usage of all projects by project and model
+func (d *Database) GetUsageSince(since time.Time) ([]*UsageSummary, error) {
+	query := `
+		SELECT s.project_path, u.model, COUNT(*),
+			   SUM(u.prompt_tokens), SUM(u.completion_tokens), SUM(u.cached_tokens), SUM(u.reasoning_tokens), SUM(u.cost)
+		FROM api_usage u
+		JOIN sessions s ON s.id = u.session_id
+		WHERE u.created_at >= ?
+		GROUP BY s.project_path, u.model
+		ORDER BY SUM(u.cost) DESC, s.project_path, u.model
+	`
+	rows, err := d.db.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+	defer rows.Close()
+
+	return scanUsageSummaries(rows)
+}
+
+// scanUsageSummaries reads aggregated usage rows
+func scanUsageSummaries(rows *sql.Rows) ([]*UsageSummary, error) {
+	var summaries []*UsageSummary
+	for rows.Next() {
+		var summary UsageSummary
+		err := rows.Scan(
+			&summary.ProjectPath, &summary.Model, &summary.Calls,
+			&summary.PromptTokens, &summary.CompletionTokens, &summary.CachedTokens, &summary.ReasoningTokens, &summary.Cost,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage summary: %w", err)
+		}
+		summaries = append(summaries, &summary)
+	}
+
+	return summaries, rows.Err()
+}
@@ -0,0 +1,208 @@
+package permission
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"nebula/glob"
+)
+
+// Action is the effect of a permission rule
+type Action string
+
+const (
+	Allow Action = "allow"
+	Ask   Action = "ask"
+	Deny  Action = "deny"
+)
+
+// Scope identifies where a rule comes from
+type Scope string
+
+const (
+	ScopeGlobal  Scope = "global"
+	ScopeProject Scope = "project"
+	ScopeSession Scope = "session"
+)
+
+// Rule is a declarative permission rule. Empty fields match anything.
+type Rule struct {
+	Tool    string `json:"tool,omitempty"`    // ツール名（"*"やglobも可）
+	Path    string `json:"path,omitempty"`    // プロジェクトルートからの相対パスのglob（プロジェクト外は"/"か"~"で始める）
+	Command string `json:"command,omitempty"` // 実行コマンドの前方一致
+	Action  Action `json:"action"`
+}
+
+// Request describes a tool invocation to be checked
+type Request struct {
+	Tool    string
+	Path    string // プロジェクトルートからの相対パス（スラッシュ区切り、プロジェクト外は絶対パス）
+	Command string
+}
+
+// Decision is the result of evaluating rules for a request
+type Decision struct {
+	Action Action
+	Rule   *Rule // マッチしたルール（ルールが無い場合はnil）
+	Scope  Scope
+}
+
+// Matches reports whether the rule applies to the request
+func (r Rule) Matches(req Request) bool {
+	if r.Tool != "" && r.Tool != "*" {
+		if ok, _ := path.Match(r.Tool, req.Tool); !ok {
+			return false
+		}
+	}
+	if r.Path != "" {
+		if req.Path == "" || !glob.Match(expandHome(r.Path), req.Path) {
+			return false
+		}
+	}
+	if r.Command != "" {
+		if req.Command == "" || !strings.HasPrefix(req.Command, r.Command) {
+			return false
+		}
+	}
+	return true
+}
+
+// expandHome replaces a leading "~" in a path pattern with the home directory
+func expandHome(pattern string) string {
+	if pattern != "~" && !strings.HasPrefix(pattern, "~/") {
+		return pattern
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return pattern
+	}
+	return filepath.ToSlash(home) + pattern[1:]
+}
+
+// Validate checks that the rule has a known action
+func (r Rule) Validate() error {
+	switch r.Action {
+	case Allow, Ask, Deny:
+		return nil
+	default:
+		return fmt.Errorf("invalid permission action %q (expected allow, ask or deny)", r.Action)
+	}
+}
+
+// String returns a human readable form of the rule
+func (r Rule) String() string {
+	parts := []string{string(r.Action)}
+	if r.Tool != "" {
+		parts = append(parts, r.Tool)
+	} else {
+		parts = append(parts, "*")
+	}
+	if r.Path != "" {
+		parts = append(parts, "on "+r.Path)
+	}
+	if r.Command != "" {
+		parts = append(parts, "for command "+r.Command)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Evaluate applies rules to a request. Deny wins over ask, and ask wins over
+// allow. An empty Action means no rule matched.
+func Evaluate(rules []Rule, req Request) Decision {
+	var decision Decision
+	for i := range rules {
+		rule := rules[i]
+		if !rule.Matches(req) {
+			continue
+		}
+		if actionRank(rule.Action) > actionRank(decision.Action) {
+			decision = Decision{Action: rule.Action, Rule: &rule}
+		}
+	}
+	return decision
+}
+
+// actionRank orders actions by strictness
+func actionRank(a Action) int {
+	switch a {
+	case Deny:
+		return 3
+	case Ask:
+		return 2
+	case Allow:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Checker evaluates requests against global, project and session rules
+type Checker struct {
+	mu          sync.Mutex
+	global      []Rule
+	project     []Rule
+	session     []Rule
+	saveProject func([]Rule) error
+}
+
+// NewChecker creates a checker. saveProject is called with the full project
+// rule list whenever a rule is remembered for the project.
+func NewChecker(global, project []Rule, saveProject func([]Rule) error) *Checker {
+	return &Checker{
+		global:      global,
+		project:     project,
+		saveProject: saveProject,
+	}
+}
+
+// Check evaluates a request across all scopes
+func (c *Checker) Check(req Request) Decision {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var best Decision
+	for _, layer := range []struct {
+		scope Scope
+		rules []Rule
+	}{
+		{ScopeGlobal, c.global},
+		{ScopeProject, c.project},
+		{ScopeSession, c.session},
+	} {
+		decision := Evaluate(layer.rules, req)
+		if actionRank(decision.Action) > actionRank(best.Action) {
+			decision.Scope = layer.scope
+			best = decision
+		}
+	}
+	return best
+}
+
+// Remember adds a rule to the session or project scope. Project rules are
+// persisted through the save callback.
+func (c *Checker) Remember(scope Scope, rule Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch scope {
+	case ScopeSession:
+		c.session = append(c.session, rule)
+		return nil
+	case ScopeProject:
+		c.project = append(c.project, rule)
+		if c.saveProject == nil {
+			return nil
+		}
+		return c.saveProject(append([]Rule(nil), c.project...))
+	default:
+		return fmt.Errorf("cannot remember rules in scope %q", scope)
+	}
+}
@@ -0,0 +1,147 @@
+package permission
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRuleMatches(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	homePath := filepath.ToSlash(home)
+
+	tests := []struct {
+		name string
+		rule Rule
+		req  Request
+		want bool
+	}{
+		{"empty rule", Rule{Action: Allow}, Request{Tool: "readFile", Path: "a.go"}, true},
+		{"tool name", Rule{Tool: "editFile", Action: Allow}, Request{Tool: "editFile"}, true},
+		{"other tool", Rule{Tool: "editFile", Action: Allow}, Request{Tool: "writeFile"}, false},
+		{"tool wildcard", Rule{Tool: "*", Action: Allow}, Request{Tool: "writeFile"}, true},
+		{"tool glob", Rule{Tool: "*File", Action: Allow}, Request{Tool: "readFile"}, true},
+		{"path glob", Rule{Path: "internal/**", Action: Allow}, Request{Tool: "editFile", Path: "internal/a/b.go"}, true},
+		{"path outside the glob", Rule{Path: "internal/**", Action: Allow}, Request{Tool: "editFile", Path: "cmd/main.go"}, false},
+		{"path rule without a path", Rule{Path: "internal/**", Action: Allow}, Request{Tool: "runCommand"}, false},
+		{"relative rule on an absolute path", Rule{Path: "etc/**", Action: Allow}, Request{Tool: "readFile", Path: "/etc/passwd"}, false},
+		{"absolute rule", Rule{Path: "/etc/**", Action: Deny}, Request{Tool: "readFile", Path: "/etc/passwd"}, true},
+		{"home rule", Rule{Path: "~/notes/**", Action: Allow}, Request{Tool: "readFile", Path: homePath + "/notes/todo.md"}, true},
+		{"home rule on a relative path", Rule{Path: "~/notes/**", Action: Allow}, Request{Tool: "readFile", Path: "notes/todo.md"}, false},
+		{"command prefix", Rule{Command: "go test", Action: Allow}, Request{Tool: "runCommand", Command: "go test ./..."}, true},
+		{"other command", Rule{Command: "go test", Action: Allow}, Request{Tool: "runCommand", Command: "rm -rf /"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.req); got != tt.want {
+				t.Errorf("%v matches %+v = %v, want %v", tt.rule, tt.req, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	allowInternal := Rule{Tool: "editFile", Path: "internal/**", Action: Allow}
+	askGenerated := Rule{Path: "internal/gen/**", Action: Ask}
+	denyEnv := Rule{Path: ".env*", Action: Deny}
+	allowAll := Rule{Action: Allow}
+
+	tests := []struct {
+		name     string
+		rules    []Rule
+		req      Request
+		want     Action
+		wantRule *Rule
+	}{
+		{"no rules", nil, Request{Tool: "editFile", Path: "a.go"}, "", nil},
+		{"no matching rule", []Rule{allowInternal}, Request{Tool: "editFile", Path: "cmd/a.go"}, "", nil},
+		{"allow", []Rule{allowInternal}, Request{Tool: "editFile", Path: "internal/a.go"}, Allow, &allowInternal},
+		{"ask wins over allow", []Rule{allowInternal, askGenerated}, Request{Tool: "editFile", Path: "internal/gen/a.go"}, Ask, &askGenerated},
+		{"deny wins over ask and allow", []Rule{allowAll, denyEnv, askGenerated}, Request{Tool: "readFile", Path: "internal/gen/.env"}, Deny, &denyEnv},
+		{"order does not matter", []Rule{denyEnv, allowAll}, Request{Tool: "readFile", Path: ".env.local"}, Deny, &denyEnv},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Evaluate(tt.rules, tt.req)
+			if got.Action != tt.want {
+				t.Errorf("action = %q, want %q", got.Action, tt.want)
+			}
+			if !reflect.DeepEqual(got.Rule, tt.wantRule) {
+				t.Errorf("rule = %v, want %v", got.Rule, tt.wantRule)
+			}
+		})
+	}
+}
+
+// TestCheckerScopes applies deny > ask > allow across the global, project and
+// session scopes, so a looser rule in a narrower scope never overrides a
+// stricter one
+func TestCheckerScopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		global    []Rule
+		project   []Rule
+		session   []Rule
+		want      Action
+		wantScope Scope
+	}{
+		{"no rules", nil, nil, nil, "", ""},
+		{"global allow", []Rule{{Action: Allow}}, nil, nil, Allow, ScopeGlobal},
+		{"project ask over global allow", []Rule{{Action: Allow}}, []Rule{{Tool: "read*", Action: Ask}}, nil, Ask, ScopeProject},
+		{"global deny over project allow", []Rule{{Path: ".env*", Action: Deny}}, []Rule{{Action: Allow}}, nil, Deny, ScopeGlobal},
+		{"global deny over session allow", []Rule{{Path: ".env*", Action: Deny}}, nil, []Rule{{Path: ".env", Action: Allow}}, Deny, ScopeGlobal},
+		{"session deny over project allow", nil, []Rule{{Action: Allow}}, []Rule{{Action: Deny}}, Deny, ScopeSession},
+		{"same action reports the broader scope", []Rule{{Action: Ask}}, []Rule{{Action: Ask}}, nil, Ask, ScopeGlobal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(tt.global, tt.project, nil)
+			for _, rule := range tt.session {
+				if err := checker.Remember(ScopeSession, rule); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := checker.Check(Request{Tool: "readFile", Path: ".env"})
+			if got.Action != tt.want || got.Scope != tt.wantScope {
+				t.Errorf("got %q from %q, want %q from %q", got.Action, got.Scope, tt.want, tt.wantScope)
+			}
+		})
+	}
+}
+
+// TestRememberProjectRule persists remembered project rules and rejects
+// invalid ones
+func TestRememberProjectRule(t *testing.T) {
+	existing := Rule{Path: "docs/**", Action: Allow}
+	var saved []Rule
+	checker := NewChecker(nil, []Rule{existing}, func(rules []Rule) error {
+		saved = rules
+		return nil
+	})
+
+	rule := Rule{Tool: "editFile", Path: "internal/a.go", Action: Allow}
+	if err := checker.Remember(ScopeProject, rule); err != nil {
+		t.Fatal(err)
+	}
+	if want := []Rule{existing, rule}; !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved rules = %v, want %v", saved, want)
+	}
+	if got := checker.Check(Request{Tool: "editFile", Path: "internal/a.go"}); got.Action != Allow || got.Scope != ScopeProject {
+		t.Errorf("got %q from %q, want allow from project", got.Action, got.Scope)
+	}
+	if got := checker.Check(Request{Tool: "editFile", Path: "internal/b.go"}); got.Action != "" {
+		t.Errorf("rule for internal/a.go applied to internal/b.go: %q", got.Action)
+	}
+
+	if err := checker.Remember(ScopeProject, Rule{Path: "x", Action: "always"}); err == nil {
+		t.Error("remembering a rule with an invalid action succeeded")
+	}
+	if err := checker.Remember(ScopeGlobal, rule); err == nil {
+		t.Error("remembering a global rule succeeded")
+	}
+}
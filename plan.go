@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"nebula/config"
+	"nebula/memory"
+	"nebula/tools"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// planModeInstructions はplanモードのリクエストに追加する指示
+const planModeInstructions = `# PLAN Mode
+You are in PLAN mode. Only read-only tools are available, so do not try to modify files.
+1. Investigate the project with the read-only tools until you understand what has to change.
+2. Call 'submitPlan' with a clear goal, concrete ordered steps, the files to touch and the risks. Do not write the plan as free text.
+3. If the user rejects the plan, revise it using their feedback and call 'submitPlan' again.
+Each step will later be executed on its own in AGENT mode, so make every step specific and self-contained.`
+
+// withModeInstructions はモード固有の指示を末尾に加えたリクエスト用のメッセージを返す
+// （指示は履歴には保存しない）
+func withModeInstructions(messages []openai.ChatCompletionMessage, planMode bool) []openai.ChatCompletionMessage {
+	if !planMode {
+		return messages
+	}
+
+	requestMessages := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
+	requestMessages = append(requestMessages, messages...)
+	return append(requestMessages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: planModeInstructions,
+	})
+}
+
+// stepStatusMark は計画ステップの状態を表す記号を返す
+func stepStatusMark(status string) string {
+	switch status {
+	case memory.StepStatusDone:
+		return "[x]"
+	case memory.StepStatusInProgress:
+		return "[>]"
+	default:
+		return "[ ]"
+	}
+}
+
+// formatPlan は計画を表示用の文字列に整形する
+func formatPlan(plan *memory.Plan) string {
+	var sb strings.Builder
+	done, total := plan.Progress()
+	fmt.Fprintf(&sb, "Plan #%d (%s, %d/%d done)\n", plan.ID, plan.Status, done, total)
+	fmt.Fprintf(&sb, "Goal: %s\n", plan.Goal)
+	sb.WriteString("Steps:\n")
+	for i, step := range plan.Steps {
+		fmt.Fprintf(&sb, "  %s %d. %s\n", stepStatusMark(step.Status), i+1, step.Description)
+	}
+	if len(plan.Files) > 0 {
+		fmt.Fprintf(&sb, "Files: %s\n", strings.Join(plan.Files, ", "))
+	}
+	if len(plan.Risks) > 0 {
+		sb.WriteString("Risks:\n")
+		for _, risk := range plan.Risks {
+			fmt.Fprintf(&sb, "  - %s\n", risk)
+		}
+	}
+	return sb.String()
+}
+
+// formatPlanForModel はエージェントに渡すための計画の説明を返す
+func formatPlanForModel(plan *memory.Plan) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Goal: %s\nSteps:\n", plan.Goal)
+	for i, step := range plan.Steps {
+		fmt.Fprintf(&sb, "%d. [%s] %s\n", i+1, step.Status, step.Description)
+	}
+	if len(plan.Files) > 0 {
+		fmt.Fprintf(&sb, "Files to touch: %s\n", strings.Join(plan.Files, ", "))
+	}
+	if len(plan.Risks) > 0 {
+		fmt.Fprintf(&sb, "Risks: %s\n", strings.Join(plan.Risks, "; "))
+	}
+	return sb.String()
+}
+
+// newPlanHandler はsubmitPlanツールから呼ばれる計画承認ハンドラーを作成する
+func newPlanHandler(memoryManager *memory.Manager) tools.PlanHandler {
+	return func(args tools.SubmitPlanArgs) (tools.SubmitPlanResult, error) {
+		plan := &memory.Plan{
+			Goal:   args.Goal,
+			Files:  args.Files,
+			Risks:  args.Risks,
+			Status: memory.PlanStatusDraft,
+		}
+		for _, step := range args.Steps {
+			plan.Steps = append(plan.Steps, memory.PlanStep{Description: step, Status: memory.StepStatusPending})
+		}
+
+		if err := memoryManager.SavePlan(plan); err != nil {
+			return tools.SubmitPlanResult{}, err
+		}
+
+		approved, feedback := reviewPlan(plan)
+		if approved {
+			plan.Status = memory.PlanStatusApproved
+		} else {
+			plan.Status = memory.PlanStatusRejected
+		}
+		if err := memoryManager.UpdatePlan(plan); err != nil {
+			return tools.SubmitPlanResult{}, err
+		}
+
+		if !approved {
+			fmt.Println("Plan rejected.")
+			return tools.SubmitPlanResult{Status: "rejected", PlanID: plan.ID, Feedback: feedback}, nil
+		}
+
+		fmt.Println("Plan approved. Use 'plan run' to execute it in AGENT mode.")
+		return tools.SubmitPlanResult{Status: "approved", PlanID: plan.ID}, nil
+	}
+}
+
+// reviewPlan は計画をユーザーに提示し、承認・編集・却下を尋ねる
+func reviewPlan(plan *memory.Plan) (approved bool, feedback string) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Printf("\n%s", formatPlan(plan))
+		fmt.Print("Approve this plan? (y=approve / e=edit / N=reject): ")
+		if !scanner.Scan() {
+			return false, ""
+		}
+
+		switch strings.TrimSpace(scanner.Text()) {
+		case "y", "Y":
+			return true, ""
+		case "e", "E":
+			if err := editPlan(plan); err != nil {
+				fmt.Printf("Error editing plan: %v\n", err)
+			}
+		default:
+			fmt.Print("Feedback for the model (leave empty to skip): ")
+			if scanner.Scan() {
+				feedback = strings.TrimSpace(scanner.Text())
+			}
+			return false, feedback
+		}
+	}
+}
+
+// editablePlan はエディタで編集する計画の内容
+type editablePlan struct {
+	Goal  string            `json:"goal"`
+	Steps []memory.PlanStep `json:"steps"`
+	Files []string          `json:"files"`
+	Risks []string          `json:"risks"`
+}
+
+// editPlan は計画をJSONとして$EDITORで編集する
+func editPlan(plan *memory.Plan) error {
+	data, err := json.MarshalIndent(editablePlan{
+		Goal:  plan.Goal,
+		Steps: plan.Steps,
+		Files: plan.Files,
+		Risks: plan.Risks,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+
+	file, err := os.CreateTemp("", "nebula-plan-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	file.Close()
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], file.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor exited with error: %w", err)
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return fmt.Errorf("failed to read edited plan: %w", err)
+	}
+
+	var result editablePlan
+	if err := json.Unmarshal(edited, &result); err != nil {
+		return fmt.Errorf("failed to parse edited plan: %w", err)
+	}
+	if strings.TrimSpace(result.Goal) == "" || len(result.Steps) == 0 {
+		return fmt.Errorf("goal and at least one step are required")
+	}
+	for i := range result.Steps {
+		switch result.Steps[i].Status {
+		case memory.StepStatusPending, memory.StepStatusInProgress, memory.StepStatusDone:
+		default:
+			result.Steps[i].Status = memory.StepStatusPending
+		}
+	}
+
+	plan.Goal = result.Goal
+	plan.Steps = result.Steps
+	plan.Files = result.Files
+	plan.Risks = result.Risks
+	return nil
+}
+
+// handlePlanCommand は "plan <サブコマンド>" を処理する
+func handlePlanCommand(subcommand string, router *modelRouter, cfg *config.Config, memoryManager *memory.Manager, toolsMap map[string]tools.ToolDefinition, messages []openai.ChatCompletionMessage, planMode *bool) []openai.ChatCompletionMessage {
+	switch subcommand {
+	case "show":
+		plan, err := memoryManager.GetActivePlan()
+		if err != nil {
+			fmt.Printf("Error loading plan: %v\n", err)
+		} else if plan == nil {
+			fmt.Println("No active plan. Create one in PLAN mode or use 'plan resume'.")
+		} else {
+			fmt.Print(formatPlan(plan))
+		}
+	case "edit":
+		plan, err := memoryManager.GetActivePlan()
+		if err != nil {
+			fmt.Printf("Error loading plan: %v\n", err)
+			break
+		}
+		if plan == nil {
+			fmt.Println("No active plan. Create one in PLAN mode or use 'plan resume'.")
+			break
+		}
+		if err := editPlan(plan); err != nil {
+			fmt.Printf("Error editing plan: %v\n", err)
+			break
+		}
+		if err := memoryManager.UpdatePlan(plan); err != nil {
+			fmt.Printf("Error saving plan: %v\n", err)
+			break
+		}
+		fmt.Print(formatPlan(plan))
+	case "run":
+		return runPlan(router, cfg, memoryManager, toolsMap, messages, planMode)
+	case "resume":
+		handlePlanResume(memoryManager)
+	default:
+		fmt.Println("Usage: plan [show|edit|run|resume]")
+	}
+	return messages
+}
+
+// handlePlanResume は以前のセッションの未完了の計画を選んで現在のセッションで再開する
+func handlePlanResume(memoryManager *memory.Manager) {
+	plans, err := memoryManager.GetResumablePlans(5)
+	if err != nil {
+		fmt.Printf("Error loading plans: %v\n", err)
+		return
+	}
+	if len(plans) == 0 {
+		fmt.Println("No unfinished plans for this project.")
+		return
+	}
+
+	fmt.Println("Unfinished plans for this project:")
+	for i, plan := range plans {
+		done, total := plan.Progress()
+		fmt.Printf("%d. #%d %s (%d/%d done, %s)\n", i+1, plan.ID, plan.Goal, done, total, plan.UpdatedAt.Format("2006-01-02 15:04"))
+	}
+	fmt.Printf("Select plan (1-%d): ", len(plans))
+
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+	if err != nil || index < 1 || index > len(plans) {
+		fmt.Println("Invalid choice. No changes made.")
+		return
+	}
+
+	plan := plans[index-1]
+	if err := memoryManager.ResumePlan(plan); err != nil {
+		fmt.Printf("Error resuming plan: %v\n", err)
+		return
+	}
+	fmt.Print(formatPlan(plan))
+	fmt.Println("Use 'plan run' to continue.")
+}
+
+// runPlan は承認済みの計画をAGENTモードで1ステップずつ実行する
+func runPlan(router *modelRouter, cfg *config.Config, memoryManager *memory.Manager, toolsMap map[string]tools.ToolDefinition, messages []openai.ChatCompletionMessage, planMode *bool) []openai.ChatCompletionMessage {
+	plan, err := memoryManager.GetActivePlan()
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		return messages
+	}
+	if plan == nil {
+		fmt.Println("No approved plan to run. Create one in PLAN mode or use 'plan resume'.")
+		return messages
+	}
+
+	if *planMode {
+		*planMode = false
+		fmt.Println("Mode switched to: AGENT (full capabilities)")
+	}
+
+	plan.Status = memory.PlanStatusInProgress
+	if err := memoryManager.UpdatePlan(plan); err != nil {
+		fmt.Printf("Error saving plan: %v\n", err)
+		return messages
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		index := plan.NextStep()
+		if index < 0 {
+			break
+		}
+
+		_, total := plan.Progress()
+		fmt.Printf("\n=== Step %d/%d: %s ===\n", index+1, total, plan.Steps[index].Description)
+
+		plan.Steps[index].Status = memory.StepStatusInProgress
+		if err := memoryManager.UpdatePlan(plan); err != nil {
+			fmt.Printf("Error saving plan: %v\n", err)
+			return messages
+		}
+
+		prompt := fmt.Sprintf("Execute step %d of the approved plan below. Do only this step, then briefly report what you changed.\n\nStep %d: %s\n\n%s",
+			index+1, index+1, plan.Steps[index].Description, formatPlanForModel(plan))
+		var outcome conversationOutcome
+		messages, outcome = handleConversation(router, cfg, memoryManager, toolsMap, prompt, messages, false)
+
+		// 完了しなかったステップはin_progressのまま残し、再開したときにやり直す
+		if outcome != conversationCompleted {
+			reason := "the request failed"
+			if outcome == conversationStopped {
+				reason = "it was stopped"
+			}
+			fmt.Printf("Step %d did not complete because %s. Plan paused; use 'plan run' to retry it.\n", index+1, reason)
+			return messages
+		}
+
+		plan.Steps[index].Status = memory.StepStatusDone
+		if err := memoryManager.UpdatePlan(plan); err != nil {
+			fmt.Printf("Error saving plan: %v\n", err)
+			return messages
+		}
+		fmt.Print(formatPlan(plan))
+
+		if plan.NextStep() < 0 {
+			break
+		}
+
+		fmt.Print("Continue with the next step? (Y=continue / n=pause / e=edit plan): ")
+		if !scanner.Scan() {
+			return messages
+		}
+		switch strings.TrimSpace(scanner.Text()) {
+		case "n", "N":
+			fmt.Println("Plan paused. Use 'plan run' to continue.")
+			return messages
+		case "e", "E":
+			if err := editPlan(plan); err != nil {
+				fmt.Printf("Error editing plan: %v\n", err)
+			} else if err := memoryManager.UpdatePlan(plan); err != nil {
+				fmt.Printf("Error saving plan: %v\n", err)
+			}
+		}
+	}
+
+	plan.Status = memory.PlanStatusCompleted
+	if err := memoryManager.UpdatePlan(plan); err != nil {
+		fmt.Printf("Error saving plan: %v\n", err)
+	}
+	fmt.Println("Plan completed.")
+	return messages
+}
@@ -0,0 +1,114 @@
+package project
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"nebula/glob"
+)
+
+// defaultIgnores are skipped even when no ignore file mentions them
+var defaultIgnores = []string{".git/", "node_modules/", ".DS_Store"}
+
+// ignoreRule is a single line of an ignore file
+type ignoreRule struct {
+	pattern  string
+	negate   bool // "!" で始まる行は除外を取り消す
+	dirOnly  bool // "/" で終わる行はディレクトリにだけマッチする
+	anchored bool // 先頭または途中に "/" を含む行はルートからのパスにマッチする
+}
+
+// Ignore decides which paths of a project are skipped. It understands the
+// common subset of .gitignore syntax: comments, negation with "!", trailing
+// "/" for directories, leading "/" for anchoring and "**".
+type Ignore struct {
+	rules []ignoreRule
+}
+
+// LoadIgnore reads .gitignore and .git/info/exclude in the project root.
+// Missing files are not an error.
+func LoadIgnore(root string) *Ignore {
+	ignore := &Ignore{}
+	ignore.addLines(defaultIgnores)
+	for _, name := range []string{".gitignore", filepath.Join(".git", "info", "exclude")} {
+		ignore.addFile(filepath.Join(root, name))
+	}
+	return ignore
+}
+
+// addFile adds the rules of an ignore file
+func (ig *Ignore) addFile(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	ig.addLines(lines)
+}
+
+// addLines parses ignore file lines
+func (ig *Ignore) addLines(lines []string) {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		ig.rules = append(ig.rules, rule)
+	}
+}
+
+// Match reports whether a slash-separated path relative to the project root
+// is ignored. The last matching rule wins, as in git.
+func (ig *Ignore) Match(rel string, isDir bool) bool {
+	rel = strings.Trim(path.Clean("/"+filepath.ToSlash(rel)), "/")
+	name := path.Base(rel)
+
+	ignored := false
+	for _, rule := range ig.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		var matched bool
+		switch {
+		case !rule.anchored:
+			matched, _ = path.Match(rule.pattern, name)
+		case strings.Contains(rule.pattern, "/"):
+			matched = glob.Match(rule.pattern, rel)
+		default:
+			// "/build" のようにルート直下だけを指すパターン
+			matched, _ = path.Match(rule.pattern, rel)
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
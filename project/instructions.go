@@ -0,0 +1,95 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InstructionsFileName is the name of project instruction files
+const InstructionsFileName = "NEBULA.md"
+
+// Instructions is the content of an instruction file
+type Instructions struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// GlobalInstructionsPath returns the path of the user-global instruction file
+func GlobalInstructionsPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".nebula", InstructionsFileName)
+}
+
+// LoadInstructions reads the user-global instruction file and the NEBULA.md
+// files in root and its parent directories. The result goes from the most
+// general to the most specific: the global file, then the parent directories
+// from the outermost inward, and the project root last.
+func LoadInstructions(root string) ([]Instructions, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve project root: %w", err)
+	}
+
+	// ルートから親ディレクトリへ辿り、外側から順に並べ直す
+	var dirs []string
+	for dir := absRoot; ; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	var paths []string
+	if global := GlobalInstructionsPath(); global != "" {
+		paths = append(paths, global)
+	}
+	for _, dir := range dirs {
+		paths = append(paths, filepath.Join(dir, InstructionsFileName))
+	}
+
+	var instructions []Instructions
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		content := strings.TrimSpace(string(data))
+		if content == "" {
+			continue
+		}
+		instructions = append(instructions, Instructions{Path: path, Content: content})
+	}
+
+	return instructions, nil
+}
+
+// FormatInstructions renders instruction files as a system prompt section.
+// It returns an empty string when there are no instructions.
+func FormatInstructions(instructions []Instructions) string {
+	if len(instructions) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Project Instructions\n")
+	sb.WriteString("The following instructions come from " + InstructionsFileName + " files, ordered from the most general to the most specific. When they conflict, later files take precedence over earlier ones, and all of them take precedence over the generic guidance above.\n")
+	for _, inst := range instructions {
+		fmt.Fprintf(&sb, "\n## %s\n%s\n", inst.Path, inst.Content)
+	}
+	return sb.String()
+}
@@ -0,0 +1,409 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Limits of the directory walk done for a snapshot
+const (
+	snapshotTreeDepth = 3      // ツリーに展開するディレクトリの深さ
+	snapshotMaxFiles  = 20_000 // 言語の集計で数えるファイル数の上限
+	maxReadmeHeadings = 40
+)
+
+// languageExtensions maps file extensions to language names
+var languageExtensions = map[string]string{
+	".go":    "Go",
+	".ts":    "TypeScript",
+	".tsx":   "TypeScript",
+	".js":    "JavaScript",
+	".jsx":   "JavaScript",
+	".mjs":   "JavaScript",
+	".py":    "Python",
+	".rs":    "Rust",
+	".java":  "Java",
+	".kt":    "Kotlin",
+	".rb":    "Ruby",
+	".php":   "PHP",
+	".cs":    "C#",
+	".c":     "C",
+	".h":     "C",
+	".cc":    "C++",
+	".cpp":   "C++",
+	".hpp":   "C++",
+	".swift": "Swift",
+	".scala": "Scala",
+	".sh":    "Shell",
+	".sql":   "SQL",
+	".html":  "HTML",
+	".css":   "CSS",
+	".scss":  "CSS",
+	".vue":   "Vue",
+	".dart":  "Dart",
+	".ex":    "Elixir",
+	".exs":   "Elixir",
+	".lua":   "Lua",
+	".md":    "Markdown",
+}
+
+// buildFileNames are files that tell how a project is built
+var buildFileNames = map[string]bool{
+	"go.mod":           true,
+	"go.work":          true,
+	"package.json":     true,
+	"Cargo.toml":       true,
+	"pyproject.toml":   true,
+	"requirements.txt": true,
+	"setup.py":         true,
+	"pom.xml":          true,
+	"build.gradle":     true,
+	"build.gradle.kts": true,
+	"Gemfile":          true,
+	"composer.json":    true,
+	"CMakeLists.txt":   true,
+	"Makefile":         true,
+	"Dockerfile":       true,
+	"deno.json":        true,
+}
+
+// Snapshot is a compact overview of a project given to the model at the
+// start of a session
+type Snapshot struct {
+	Root           string          `json:"root"`
+	Branch         string          `json:"branch,omitempty"`
+	Languages      []LanguageCount `json:"languages"`
+	BuildFiles     []BuildFile     `json:"build_files"`
+	ReadmeHeadings []string        `json:"readme_headings"`
+	Tree           []TreeEntry     `json:"tree"`
+}
+
+// LanguageCount is the number of files written in a language
+type LanguageCount struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+}
+
+// BuildFile is a build manifest found in the project
+type BuildFile struct {
+	Path    string `json:"path"`
+	Summary string `json:"summary,omitempty"` // モジュール名やnpmスクリプトなど
+}
+
+// TreeEntry is a line of the directory tree
+type TreeEntry struct {
+	Path  string `json:"path"`
+	Depth int    `json:"depth"`
+	Dir   bool   `json:"dir"`
+	Files int    `json:"files,omitempty"` // 展開しなかったディレクトリの配下のファイル数
+}
+
+// BuildSnapshot walks the project root, skipping ignored paths, and collects
+// the tree, languages, build files, README headings and git branch
+func BuildSnapshot(root string) (*Snapshot, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve project root: %w", err)
+	}
+
+	snapshot := &Snapshot{
+		Root:   absRoot,
+		Branch: GitBranch(absRoot),
+	}
+
+	w := &snapshotWalker{
+		root:      absRoot,
+		ignore:    LoadIgnore(absRoot),
+		languages: make(map[string]int),
+		snapshot:  snapshot,
+	}
+	if _, err := w.walk("", 0); err != nil {
+		return nil, err
+	}
+
+	for name, files := range w.languages {
+		snapshot.Languages = append(snapshot.Languages, LanguageCount{Name: name, Files: files})
+	}
+	sort.Slice(snapshot.Languages, func(i, j int) bool {
+		if snapshot.Languages[i].Files != snapshot.Languages[j].Files {
+			return snapshot.Languages[i].Files > snapshot.Languages[j].Files
+		}
+		return snapshot.Languages[i].Name < snapshot.Languages[j].Name
+	})
+
+	snapshot.ReadmeHeadings = readmeHeadings(absRoot)
+	return snapshot, nil
+}
+
+// snapshotWalker holds the state of a snapshot walk
+type snapshotWalker struct {
+	root      string
+	ignore    *Ignore
+	languages map[string]int
+	files     int
+	snapshot  *Snapshot
+}
+
+// walk visits a directory relative to the root and returns the number of
+// files below it. Directories deeper than the tree depth are counted but not
+// listed.
+func (w *snapshotWalker) walk(rel string, depth int) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(w.root, rel))
+	if err != nil {
+		if rel == "" {
+			return 0, fmt.Errorf("failed to read project root: %w", err)
+		}
+		return 0, nil
+	}
+
+	listed := depth < snapshotTreeDepth
+	count := 0
+	for _, entry := range entries {
+		entryRel := filepath.ToSlash(filepath.Join(rel, entry.Name()))
+		// シンボリックリンクはループを避けるため辿らない
+		isDir := entry.IsDir()
+		if w.ignore.Match(entryRel, isDir) {
+			continue
+		}
+
+		if isDir {
+			index := len(w.snapshot.Tree)
+			if listed {
+				w.snapshot.Tree = append(w.snapshot.Tree, TreeEntry{Path: entryRel, Depth: depth, Dir: true})
+			}
+			files, err := w.walk(entryRel, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			// 子を展開しなかったディレクトリにはファイル数を添える
+			if listed && depth+1 >= snapshotTreeDepth {
+				w.snapshot.Tree[index].Files = files
+			}
+			count += files
+			continue
+		}
+
+		count++
+		if w.files >= snapshotMaxFiles {
+			continue
+		}
+		w.files++
+
+		if listed {
+			w.snapshot.Tree = append(w.snapshot.Tree, TreeEntry{Path: entryRel, Depth: depth})
+		}
+		if language, ok := languageExtensions[strings.ToLower(filepath.Ext(entry.Name()))]; ok {
+			w.languages[language]++
+		}
+		if buildFileNames[entry.Name()] && listed {
+			w.snapshot.BuildFiles = append(w.snapshot.BuildFiles, BuildFile{
+				Path:    entryRel,
+				Summary: summarizeBuildFile(filepath.Join(w.root, entryRel)),
+			})
+		}
+	}
+	return count, nil
+}
+
+// summarizeBuildFile extracts the most useful line of a build file
+func summarizeBuildFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	switch filepath.Base(path) {
+	case "go.mod":
+		var module, goVersion string
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "module" {
+				module = fields[1]
+			}
+			if len(fields) == 2 && fields[0] == "go" {
+				goVersion = fields[1]
+			}
+		}
+		if module == "" {
+			return ""
+		}
+		if goVersion != "" {
+			return fmt.Sprintf("module %s, go %s", module, goVersion)
+		}
+		return "module " + module
+	case "package.json":
+		var pkg struct {
+			Name    string            `json:"name"`
+			Scripts map[string]string `json:"scripts"`
+		}
+		if json.Unmarshal(data, &pkg) != nil {
+			return ""
+		}
+		var scripts []string
+		for name := range pkg.Scripts {
+			scripts = append(scripts, name)
+		}
+		sort.Strings(scripts)
+		var parts []string
+		if pkg.Name != "" {
+			parts = append(parts, pkg.Name)
+		}
+		if len(scripts) > 0 {
+			parts = append(parts, "scripts: "+strings.Join(scripts, ", "))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return ""
+}
+
+// readmeHeadings returns the markdown headings of the README in the root
+func readmeHeadings(root string) []string {
+	var data []byte
+	for _, name := range []string{"README.md", "README.markdown", "readme.md", "Readme.md"} {
+		content, err := os.ReadFile(filepath.Join(root, name))
+		if err == nil {
+			data = content
+			break
+		}
+	}
+
+	var headings []string
+	inFence := false
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		// コードブロック内の "#" はコメントなので見出しとして扱わない
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || !strings.HasPrefix(line, "#") {
+			continue
+		}
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		title := strings.TrimSpace(line[level:])
+		if level > 6 || title == "" {
+			continue
+		}
+		headings = append(headings, strings.Repeat("#", level)+" "+title)
+		if len(headings) >= maxReadmeHeadings {
+			break
+		}
+	}
+	return headings
+}
+
+// GitBranch returns the current git branch of a repository, the short commit
+// hash for a detached HEAD, or "" when root is not a git repository
+func GitBranch(root string) string {
+	gitDir := filepath.Join(root, ".git")
+
+	// ワークツリーでは .git がgitdirを指すファイルになっている
+	if data, err := os.ReadFile(gitDir); err == nil {
+		dir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+		if !ok {
+			return ""
+		}
+		gitDir = strings.TrimSpace(dir)
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(root, gitDir)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	head := strings.TrimSpace(string(data))
+	if ref, ok := strings.CutPrefix(head, "ref: "); ok {
+		return strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if len(head) > 12 {
+		return "detached at " + head[:12]
+	}
+	return head
+}
+
+// EstimateTokens roughly estimates the number of tokens in a text
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// Format renders the snapshot as a system prompt section that fits in the
+// token budget. The tree is cut first, then the README headings. A budget of
+// 0 or less means no limit.
+func (s *Snapshot) Format(budget int) string {
+	var header strings.Builder
+	header.WriteString("# Project Snapshot\n")
+	header.WriteString("An overview of the project collected when this session started. Use it instead of listing the root directory; it may be out of date after you change files.\n\n")
+	fmt.Fprintf(&header, "Root: %s\n", s.Root)
+	if s.Branch != "" {
+		fmt.Fprintf(&header, "Git branch: %s\n", s.Branch)
+	}
+	if len(s.Languages) > 0 {
+		var languages []string
+		for _, language := range s.Languages {
+			languages = append(languages, fmt.Sprintf("%s (%d)", language.Name, language.Files))
+		}
+		fmt.Fprintf(&header, "Languages (files): %s\n", strings.Join(languages, ", "))
+	}
+	if len(s.BuildFiles) > 0 {
+		header.WriteString("Build files:\n")
+		for _, file := range s.BuildFiles {
+			if file.Summary != "" {
+				fmt.Fprintf(&header, "- %s: %s\n", file.Path, file.Summary)
+			} else {
+				fmt.Fprintf(&header, "- %s\n", file.Path)
+			}
+		}
+	}
+
+	result := header.String()
+	fits := func(text string) bool {
+		return budget <= 0 || EstimateTokens(result+text) <= budget
+	}
+
+	// README の見出しには残りの半分までを使い、ツリーの分を残しておく
+	if len(s.ReadmeHeadings) > 0 {
+		headingBudget := (budget - EstimateTokens(result)) / 2
+		section := "\nREADME outline:\n"
+		for _, heading := range s.ReadmeHeadings {
+			line := heading + "\n"
+			if budget > 0 && EstimateTokens(section+line) > headingBudget {
+				break
+			}
+			section += line
+		}
+		if section != "\nREADME outline:\n" {
+			result += section
+		}
+	}
+
+	if len(s.Tree) > 0 && fits("\nTree:\n") {
+		result += fmt.Sprintf("\nTree (depth %d, ignored paths skipped):\n", snapshotTreeDepth)
+		for i, entry := range s.Tree {
+			line := strings.Repeat("  ", entry.Depth) + filepath.Base(entry.Path)
+			if entry.Dir {
+				line += "/"
+				if entry.Files == 1 {
+					line += " (1 file)"
+				} else if entry.Files > 1 {
+					line += fmt.Sprintf(" (%d files)", entry.Files)
+				}
+			}
+			line += "\n"
+
+			rest := fmt.Sprintf("... (%d more entries)\n", len(s.Tree)-i)
+			if i < len(s.Tree)-1 && !fits(line+rest) || !fits(line) {
+				result += rest
+				break
+			}
+			result += line
+		}
+	}
+
+	return strings.TrimRight(result, "\n")
+}
@@ -0,0 +1,329 @@
+package repomap
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"nebula/memory"
+)
+
+// maxSignatureLength is the longest signature kept for a symbol
+const maxSignatureLength = 160
+
+// symbolPattern finds a kind of declaration with a regular expression. The
+// name group of the expression is the symbol name.
+type symbolPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// pattern compiles a symbol pattern
+func pattern(kind, expr string) symbolPattern {
+	return symbolPattern{kind: kind, re: regexp.MustCompile(expr)}
+}
+
+// Heuristic patterns for languages without a parser in the standard library
+var (
+	pythonPatterns = []symbolPattern{
+		pattern("class", `^class\s+(?P<name>\w+)`),
+		pattern("func", `^(?:async\s+)?def\s+(?P<name>\w+)`),
+		pattern("method", `^\s+(?:async\s+)?def\s+(?P<name>[A-Za-z]\w*)`),
+	}
+	javascriptPatterns = []symbolPattern{
+		pattern("func", `^(?:export\s+)?(?:default\s+)?(?:async\s+)?function\*?\s+(?P<name>\w+)`),
+		pattern("class", `^(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+(?P<name>\w+)`),
+		pattern("type", `^(?:export\s+)?(?:declare\s+)?(?:interface|type|enum)\s+(?P<name>\w+)`),
+		pattern("func", `^(?:export\s+)?(?:const|let)\s+(?P<name>\w+)\s*(?::[^=]+)?=\s*(?:async\s*)?(?:\([^)]*\)|\w+)\s*(?::[^=]+)?=>`),
+		pattern("const", `^export\s+(?:const|let|var)\s+(?P<name>\w+)`),
+	}
+	rustPatterns = []symbolPattern{
+		pattern("func", `^\s*(?:pub(?:\([\w:]+\))?\s+)?(?:async\s+)?(?:unsafe\s+)?fn\s+(?P<name>\w+)`),
+		pattern("type", `^(?:pub(?:\([\w:]+\))?\s+)?(?:struct|enum|trait|type|union)\s+(?P<name>\w+)`),
+		pattern("module", `^(?:pub\s+)?mod\s+(?P<name>\w+)`),
+	}
+	javaPatterns = []symbolPattern{
+		pattern("class", `^\s*(?:(?:public|private|protected|internal|abstract|final|static|sealed|partial|data|open)\s+)*(?:class|interface|enum|record|object|struct)\s+(?P<name>\w+)`),
+		pattern("method", `^\s+(?:(?:public|private|protected|internal|abstract|final|static|override|async|virtual|suspend)\s+)+(?:fun\s+)?[\w<>\[\],.? ]*?\b(?P<name>\w+)\s*\(`),
+		pattern("func", `^(?:(?:private|internal|public|suspend)\s+)*fun\s+(?:<[^>]+>\s*)?(?:[\w.]+\.)?(?P<name>\w+)\s*\(`),
+	}
+	rubyPatterns = []symbolPattern{
+		pattern("class", `^\s*(?:class|module)\s+(?P<name>[\w:]+)`),
+		pattern("method", `^\s*def\s+(?:self\.)?(?P<name>\w+[?!=]?)`),
+	}
+	phpPatterns = []symbolPattern{
+		pattern("class", `^\s*(?:(?:abstract|final)\s+)?(?:class|interface|trait|enum)\s+(?P<name>\w+)`),
+		pattern("func", `^\s*(?:(?:public|private|protected|static|abstract|final)\s+)*function\s+(?P<name>\w+)`),
+	}
+	cPatterns = []symbolPattern{
+		pattern("type", `^(?:typedef\s+)?(?:struct|enum|union|class)\s+(?P<name>\w+)\s*[{:]`),
+		pattern("func", `^[A-Za-z_][\w\s\*&:<>,]*?\b(?P<name>\w+)\s*\([^;]*$`),
+	}
+	swiftPatterns = []symbolPattern{
+		pattern("type", `^\s*(?:(?:public|private|internal|open|final)\s+)*(?:class|struct|enum|protocol|extension)\s+(?P<name>\w+)`),
+		pattern("func", `^\s*(?:(?:public|private|internal|open|static|override)\s+)*func\s+(?P<name>\w+)`),
+	}
+)
+
+// languagePatterns maps file extensions to their symbol patterns
+var languagePatterns = map[string][]symbolPattern{
+	".py":    pythonPatterns,
+	".js":    javascriptPatterns,
+	".jsx":   javascriptPatterns,
+	".mjs":   javascriptPatterns,
+	".ts":    javascriptPatterns,
+	".tsx":   javascriptPatterns,
+	".rs":    rustPatterns,
+	".java":  javaPatterns,
+	".kt":    javaPatterns,
+	".cs":    javaPatterns,
+	".scala": javaPatterns,
+	".rb":    rubyPatterns,
+	".php":   phpPatterns,
+	".c":     cPatterns,
+	".h":     cPatterns,
+	".cc":    cPatterns,
+	".cpp":   cPatterns,
+	".hpp":   cPatterns,
+	".swift": swiftPatterns,
+}
+
+// identifierPattern finds identifiers used as references in any language
+var identifierPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{2,}`)
+
+// commonWords are identifiers that appear everywhere and say nothing about
+// which file a reference points to
+var commonWords = map[string]bool{
+	"self": true, "this": true, "super": true, "return": true, "function": true,
+	"const": true, "let": true, "var": true, "new": true, "class": true,
+	"def": true, "import": true, "from": true, "export": true, "default": true,
+	"true": true, "false": true, "null": true, "nil": true, "None": true,
+	"True": true, "False": true, "string": true, "int": true, "error": true,
+	"main": true, "init": true, "test": true, "String": true, "Error": true,
+}
+
+// Supported reports whether symbols can be extracted from a file
+func Supported(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".go" {
+		return true
+	}
+	_, ok := languagePatterns[ext]
+	return ok
+}
+
+// Extract returns the top-level symbols of a source file and the identifiers
+// it references
+func Extract(path string, src []byte) ([]memory.RepoSymbol, []string) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".go" {
+		if symbols, refs, err := extractGo(path, src); err == nil {
+			return symbols, refs
+		}
+		// 構文エラーのあるファイルは参照だけを集める
+		return nil, extractReferences(src)
+	}
+	return extractWithPatterns(languagePatterns[ext], src), extractReferences(src)
+}
+
+// extractGo parses a Go file and collects its top-level declarations
+func extractGo(path string, src []byte) ([]memory.RepoSymbol, []string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var symbols []memory.RepoSymbol
+	// posは宣言の位置（整形用に組み立てたノードは元のファイルの位置を持たないため別に渡す）
+	add := func(name, kind string, node ast.Node, pos token.Pos) {
+		symbols = append(symbols, memory.RepoSymbol{
+			Name:      name,
+			Kind:      kind,
+			Signature: truncateSignature(formatNode(fset, node)),
+			Line:      fset.Position(pos).Line,
+		})
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			// 本体を除いたシグネチャだけを出力する
+			signature := *d
+			signature.Body = nil
+			signature.Doc = nil
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				add(receiverName(d.Recv.List[0].Type)+"."+d.Name.Name, "method", &signature, d.Pos())
+			} else {
+				add(d.Name.Name, "func", &signature, d.Pos())
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s.Name.Name, "type", &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{shortTypeSpec(s)}}, s.Pos())
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range s.Names {
+						if name.Name == "_" {
+							continue
+						}
+						symbols = append(symbols, memory.RepoSymbol{
+							Name:      name.Name,
+							Kind:      kind,
+							Signature: kind + " " + name.Name,
+							Line:      fset.Position(name.Pos()).Line,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	// 識別子とセレクタの名前を参照として集める
+	seen := make(map[string]bool)
+	var refs []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && len(ident.Name) > 1 && !seen[ident.Name] && !commonWords[ident.Name] {
+			seen[ident.Name] = true
+			refs = append(refs, ident.Name)
+		}
+		return true
+	})
+	sort.Strings(refs)
+
+	return symbols, refs, nil
+}
+
+// shortTypeSpec replaces struct and interface bodies with their field and
+// method names so that a type fits on one line
+func shortTypeSpec(spec *ast.TypeSpec) *ast.TypeSpec {
+	short := *spec
+	short.Doc = nil
+	short.Comment = nil
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		short.Type = &ast.StructType{Fields: &ast.FieldList{List: namesOnly(t.Fields)}}
+	case *ast.InterfaceType:
+		short.Type = &ast.InterfaceType{Methods: &ast.FieldList{List: namesOnly(t.Methods)}}
+	}
+	return &short
+}
+
+// namesOnly keeps the names of fields and drops their types
+func namesOnly(fields *ast.FieldList) []*ast.Field {
+	var list []*ast.Field
+	if fields == nil {
+		return list
+	}
+	for _, field := range fields.List {
+		if len(field.Names) == 0 {
+			// 埋め込みフィールドは型名をそのまま残す
+			list = append(list, &ast.Field{Type: field.Type})
+			continue
+		}
+		for _, name := range field.Names {
+			list = append(list, &ast.Field{Type: ast.NewIdent(name.Name)})
+		}
+	}
+	return list
+}
+
+// receiverName returns the type name of a method receiver
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// formatNode prints a declaration on a single line
+func formatNode(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+// extractWithPatterns finds declarations line by line
+func extractWithPatterns(patterns []symbolPattern, src []byte) []memory.RepoSymbol {
+	var symbols []memory.RepoSymbol
+	for i, line := range strings.Split(string(src), "\n") {
+		for _, p := range patterns {
+			match := p.re.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			name := match[p.re.SubexpIndex("name")]
+			if commonWords[name] || isKeyword(name) {
+				break
+			}
+
+			// 本体の開始以降は除いてシグネチャにする
+			signature := strings.TrimSpace(line)
+			if index := strings.Index(signature, "{"); index > 0 {
+				signature = strings.TrimSpace(signature[:index])
+			}
+			signature = strings.TrimSuffix(signature, ":")
+			symbols = append(symbols, memory.RepoSymbol{
+				Name:      name,
+				Kind:      p.kind,
+				Signature: truncateSignature(signature),
+				Line:      i + 1,
+			})
+			break
+		}
+	}
+	return symbols
+}
+
+// isKeyword reports control-flow keywords that the C and Java patterns can
+// mistake for function names
+func isKeyword(name string) bool {
+	switch name {
+	case "if", "for", "while", "switch", "catch", "return", "sizeof", "else":
+		return true
+	}
+	return false
+}
+
+// extractReferences collects the distinct identifiers of a file
+func extractReferences(src []byte) []string {
+	seen := make(map[string]bool)
+	var refs []string
+	for _, ident := range identifierPattern.FindAllString(string(src), -1) {
+		if seen[ident] || commonWords[ident] {
+			continue
+		}
+		seen[ident] = true
+		refs = append(refs, ident)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// truncateSignature shortens long signatures
+func truncateSignature(signature string) string {
+	runes := []rune(signature)
+	if len(runes) <= maxSignatureLength {
+		return signature
+	}
+	return string(runes[:maxSignatureLength]) + "…"
+}
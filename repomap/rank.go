@@ -0,0 +1,186 @@
+package repomap
+
+import (
+	"sort"
+	"strings"
+
+	"nebula/memory"
+)
+
+// PageRank parameters
+const (
+	damping        = 0.85
+	rankIterations = 30
+	methodWeight   = 0.25 // メソッド名は Close や Name のように別の型と衝突しやすいため軽くする
+)
+
+// definition is a file that defines a name
+type definition struct {
+	file   int
+	method bool
+}
+
+// rankFiles orders files by their centrality in the reference graph. A file
+// gets an edge to every file that defines a name it references, so files
+// whose symbols are used from many places rank first. Files and symbol
+// names listed in focus are favoured through the personalization vector.
+func rankFiles(files []memory.RepoMapFile, focus []string) []rankedFile {
+	n := len(files)
+	if n == 0 {
+		return nil
+	}
+
+	// 名前からその名前を定義しているファイルを引けるようにする
+	definedIn := make(map[string][]definition)
+	for i, file := range files {
+		seen := make(map[string]bool)
+		for _, symbol := range file.Symbols {
+			name := referenceName(symbol.Name)
+			if !seen[name] {
+				seen[name] = true
+				definedIn[name] = append(definedIn[name], definition{file: i, method: symbol.Kind == "method"})
+			}
+		}
+	}
+
+	// 参照元から定義元への重み付きの辺（多くのファイルで定義される名前ほど軽くする）
+	edges := make([]map[int]float64, n)
+	usedBy := make([]map[string]int, n)
+	for i, file := range files {
+		edges[i] = make(map[int]float64)
+		for _, ref := range file.References {
+			definers := definedIn[ref]
+			for _, def := range definers {
+				j := def.file
+				if j == i {
+					continue
+				}
+				weight := 1 / float64(len(definers))
+				if def.method {
+					weight *= methodWeight
+				}
+				edges[i][j] += weight
+				if usedBy[j] == nil {
+					usedBy[j] = make(map[string]int)
+				}
+				usedBy[j][ref]++
+			}
+		}
+	}
+
+	personalization := focusVector(files, focus, definedIn)
+
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	for iter := 0; iter < rankIterations; iter++ {
+		next := make([]float64, n)
+		dangling := 0.0
+		for i := range files {
+			total := 0.0
+			for _, weight := range edges[i] {
+				total += weight
+			}
+			if total == 0 {
+				dangling += rank[i]
+				continue
+			}
+			for j, weight := range edges[i] {
+				next[j] += damping * rank[i] * weight / total
+			}
+		}
+		for i := range next {
+			next[i] += (1-damping)*personalization[i] + damping*dangling*personalization[i]
+		}
+		rank = next
+	}
+
+	ranked := make([]rankedFile, n)
+	for i, file := range files {
+		ranked[i] = rankedFile{file: file, rank: rank[i], usedBy: usedBy[i]}
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		if ranked[a].rank != ranked[b].rank {
+			return ranked[a].rank > ranked[b].rank
+		}
+		return ranked[a].file.Path < ranked[b].file.Path
+	})
+	return ranked
+}
+
+// rankedFile is a file with its rank and the names other files use from it
+type rankedFile struct {
+	file   memory.RepoMapFile
+	rank   float64
+	usedBy map[string]int // 他のファイルから参照されている名前と参照元の数
+}
+
+// focusVector builds the personalization vector. Without focus, or when
+// nothing matches it, every file gets the same weight.
+func focusVector(files []memory.RepoMapFile, focus []string, definedIn map[string][]definition) []float64 {
+	n := len(files)
+	vector := make([]float64, n)
+	matched := 0.0
+	for _, item := range focus {
+		item = strings.TrimPrefix(strings.TrimSpace(item), "./")
+		if item == "" {
+			continue
+		}
+		for i, file := range files {
+			if file.Path == item || strings.HasPrefix(file.Path, strings.TrimSuffix(item, "/")+"/") || strings.HasSuffix(file.Path, "/"+item) {
+				vector[i]++
+				matched++
+			}
+		}
+		for _, def := range definedIn[referenceName(item)] {
+			vector[def.file]++
+			matched++
+		}
+	}
+
+	if matched == 0 {
+		for i := range vector {
+			vector[i] = 1 / float64(n)
+		}
+		return vector
+	}
+
+	// 注目していないファイルにも少しだけ重みを残して、参照を辿れるようにする
+	for i := range vector {
+		vector[i] = (vector[i] + 0.1/float64(n)) / (matched + 0.1)
+	}
+	return vector
+}
+
+// referenceName returns the name other files use to refer to a symbol, which
+// is the method name for "Type.Method"
+func referenceName(name string) string {
+	if index := strings.LastIndex(name, "."); index >= 0 {
+		return name[index+1:]
+	}
+	return name
+}
+
+// relevantSymbols returns the symbols of a file that other files reference,
+// most referenced first, up to limit. Files whose symbols are not referenced
+// anywhere else show their first declarations instead. The second result is
+// the number of symbols left out.
+func (r rankedFile) relevantSymbols(limit int) ([]memory.RepoSymbol, int) {
+	var symbols []memory.RepoSymbol
+	for _, symbol := range r.file.Symbols {
+		if r.usedBy[referenceName(symbol.Name)] > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.SliceStable(symbols, func(a, b int) bool {
+		return r.usedBy[referenceName(symbols[a].Name)] > r.usedBy[referenceName(symbols[b].Name)]
+	})
+	if len(symbols) == 0 {
+		symbols = r.file.Symbols
+	}
+	if len(symbols) > limit {
+		symbols = symbols[:limit]
+	}
+	return symbols, len(r.file.Symbols) - len(symbols)
+}
@@ -0,0 +1,233 @@
+package repomap
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"nebula/memory"
+	"nebula/project"
+)
+
+// maxFileSize is the largest source file that is parsed. Bigger files are
+// usually generated code.
+const maxFileSize = 512 * 1024
+
+// maxSymbolsPerFile keeps a single large file from taking the whole budget
+const maxSymbolsPerFile = 12
+
+// Store caches the symbols of each file between sessions
+type Store interface {
+	GetRepoMapFiles(projectPath string) ([]memory.RepoMapFile, error)
+	SaveRepoMapFiles(projectPath string, files []memory.RepoMapFile) error
+	DeleteRepoMapFiles(projectPath string, paths []string) error
+}
+
+// RepoMap is a map of the top-level symbols of a repository. Files are parsed
+// once and cached in the store; later refreshes only parse files whose size
+// or modification time changed.
+type RepoMap struct {
+	root   string
+	store  Store
+	mu     sync.Mutex
+	loaded bool
+	files  map[string]memory.RepoMapFile
+}
+
+// RefreshStats reports what a refresh did
+type RefreshStats struct {
+	Files   int // マップに含まれるファイル数
+	Parsed  int // 新しく解析したファイル数
+	Removed int // 削除されたファイル数
+}
+
+// New creates a repository map for a project root
+func New(root string, store Store) *RepoMap {
+	return &RepoMap{
+		root:  root,
+		store: store,
+		files: make(map[string]memory.RepoMapFile),
+	}
+}
+
+// Refresh brings the map up to date with the files on disk
+func (m *RepoMap) Refresh() (RefreshStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.refresh()
+}
+
+// refresh does the work of Refresh with the lock held
+func (m *RepoMap) refresh() (RefreshStats, error) {
+	var stats RefreshStats
+
+	// 初回はキャッシュを読み込む
+	if !m.loaded {
+		cached, err := m.store.GetRepoMapFiles(m.root)
+		if err != nil {
+			return stats, err
+		}
+		for _, file := range cached {
+			m.files[file.Path] = file
+		}
+		m.loaded = true
+	}
+
+	ignore := project.LoadIgnore(m.root)
+	seen := make(map[string]bool)
+	var updated []memory.RepoMapFile
+
+	err := filepath.WalkDir(m.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// 読めないディレクトリは飛ばして続ける
+			if entry != nil && entry.IsDir() && path != m.root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if path == m.root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(m.root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ignore.Match(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() || !Supported(rel) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.Size() > maxFileSize {
+			return nil
+		}
+		seen[rel] = true
+
+		// 更新時刻とサイズが変わっていないファイルはキャッシュを使う
+		if cached, ok := m.files[rel]; ok && cached.ModTime == info.ModTime().UnixNano() && cached.Size == info.Size() {
+			return nil
+		}
+
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		symbols, refs := Extract(rel, src)
+		file := memory.RepoMapFile{
+			Path:       rel,
+			ModTime:    info.ModTime().UnixNano(),
+			Size:       info.Size(),
+			Symbols:    symbols,
+			References: refs,
+		}
+		m.files[rel] = file
+		updated = append(updated, file)
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to scan repository: %w", err)
+	}
+
+	var removed []string
+	for path := range m.files {
+		if !seen[path] {
+			removed = append(removed, path)
+			delete(m.files, path)
+		}
+	}
+
+	if len(updated) > 0 {
+		if err := m.store.SaveRepoMapFiles(m.root, updated); err != nil {
+			return stats, err
+		}
+	}
+	if len(removed) > 0 {
+		if err := m.store.DeleteRepoMapFiles(m.root, removed); err != nil {
+			return stats, err
+		}
+	}
+
+	stats.Files = len(m.files)
+	stats.Parsed = len(updated)
+	stats.Removed = len(removed)
+	return stats, nil
+}
+
+// Render refreshes the map and renders the highest ranked files and their
+// signatures within the token budget. Focus lists files, directories or
+// symbol names the caller is interested in.
+func (m *RepoMap) Render(budget int, focus []string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.refresh(); err != nil {
+		return "", err
+	}
+
+	files := make([]memory.RepoMapFile, 0, len(m.files))
+	for _, file := range m.files {
+		files = append(files, file)
+	}
+	ranked := rankFiles(files, focus)
+
+	var sb strings.Builder
+	sb.WriteString("# Repository Map\n")
+	sb.WriteString("Top-level symbols of the most referenced source files, most central first. Signatures omit bodies; read a file before changing it.\n")
+
+	shown := 0
+	for _, file := range ranked {
+		if len(file.file.Symbols) == 0 {
+			continue
+		}
+
+		// 入る分だけシンボルを追加し、1つも入らないファイルで打ち切る
+		section := "\n" + file.file.Path + ":\n"
+		symbols, omitted := file.relevantSymbols(maxSymbolsPerFile)
+		added := 0
+		for _, symbol := range symbols {
+			line := "  " + symbol.Signature + "\n"
+			if budget > 0 && project.EstimateTokens(sb.String()+section+line) > budget {
+				break
+			}
+			section += line
+			added++
+		}
+		if added == 0 {
+			break
+		}
+		if omitted += len(symbols) - added; omitted > 0 {
+			section += fmt.Sprintf("  … (%d more)\n", omitted)
+		}
+		sb.WriteString(section)
+		shown++
+	}
+
+	if shown == 0 {
+		return "", nil
+	}
+	if shown < countWithSymbols(files) {
+		fmt.Fprintf(&sb, "\n(%d of %d files shown; call repoMap with a focus to see others)\n", shown, countWithSymbols(files))
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// countWithSymbols returns the number of files that define any symbol
+func countWithSymbols(files []memory.RepoMapFile) int {
+	count := 0
+	for _, file := range files {
+		if len(file.Symbols) > 0 {
+			count++
+		}
+	}
+	return count
+}
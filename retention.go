@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"nebula/config"
+	"nebula/memory"
+)
+
+// retentionPolicy は設定からセッションの保存期間と件数の上限を作成する
+func retentionPolicy(cfg *config.Config) memory.RetentionPolicy {
+	return memory.RetentionPolicy{
+		MaxSessions:           cfg.MaxSessions,
+		MaxSessionsPerProject: cfg.MaxProjectSessions,
+		MaxAge:                time.Duration(cfg.MaxSessionAgeDays) * 24 * time.Hour,
+	}
+}
+
+// pruneSessionsOnStartup は起動時に保存期間や上限を超えたセッションを削除する
+func pruneSessionsOnStartup(cfg *config.Config, memoryManager *memory.Manager) {
+	pruned, err := memoryManager.PruneSessions(retentionPolicy(cfg), false)
+	if err != nil {
+		fmt.Printf("Error pruning sessions: %v\n", err)
+		return
+	}
+	if len(pruned) == 0 {
+		return
+	}
+	fmt.Printf("Pruned %d old sessions (pin a session with 'pin' to keep it)\n", len(pruned))
+
+	if cfg.VacuumAfterPrune {
+		if err := memoryManager.Vacuum(); err != nil {
+			fmt.Printf("Error vacuuming database: %v\n", err)
+		}
+	}
+}
+
+// runPruneCommand は `nebula db prune` を実行し、保存期間や上限を超えたセッションを削除する
+func runPruneCommand(args []string) int {
+	fs := flag.NewFlagSet("db prune", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only list the sessions that would be deleted")
+	vacuum := fs.Bool("vacuum", false, "run VACUUM afterwards to shrink the database file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return 1
+	}
+	memoryManager, err := memory.NewManager(cfg.DatabasePath)
+	if err != nil {
+		fmt.Printf("Error initializing memory: %v\n", err)
+		return 1
+	}
+	defer memoryManager.Close()
+
+	pruned, err := memoryManager.PruneSessions(retentionPolicy(cfg), *dryRun)
+	if err != nil {
+		fmt.Printf("Error pruning sessions: %v\n", err)
+		return 1
+	}
+	if len(pruned) == 0 {
+		fmt.Println("No sessions to prune.")
+	} else {
+		printPrunedSessions(pruned)
+		if *dryRun {
+			fmt.Printf("\n%d sessions would be deleted (dry run)\n", len(pruned))
+			return 0
+		}
+		fmt.Printf("\nDeleted %d sessions\n", len(pruned))
+	}
+
+	if *vacuum && !*dryRun {
+		if err := memoryManager.Vacuum(); err != nil {
+			fmt.Printf("Error vacuuming database: %v\n", err)
+			return 1
+		}
+		fmt.Println("Vacuumed database")
+	}
+	return 0
+}
+
+// printPrunedSessions は削除するセッションと理由を表形式で表示する
+func printPrunedSessions(sessions []*memory.PrunedSession) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LAST ACTIVITY\tSESSION\tMESSAGES\tPROJECT\tREASON")
+	for _, s := range sessions {
+		name := s.ID
+		if s.Title != "" {
+			name = s.Title
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", s.LastActivity.Local().Format("2006-01-02 15:04"), name, s.MessageCount, s.ProjectPath, s.Reason)
+	}
+	w.Flush()
+}
+
+// handlePinCommand pins or unpins the current session
+func handlePinCommand(memoryManager *memory.Manager, pinned bool) {
+	if err := memoryManager.SetSessionPinned(pinned); err != nil {
+		fmt.Printf("Error updating session: %v\n", err)
+		return
+	}
+	if pinned {
+		fmt.Println("Session pinned: it will never be pruned")
+	} else {
+		fmt.Println("Session unpinned")
+	}
+}
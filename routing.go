@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"nebula/config"
+	"nebula/llm"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// modelRouter はモードに応じたモデルと、そのモデルを提供するプロバイダーを選ぶ
+type modelRouter struct {
+	cfg       *config.Config
+	providers map[string]llm.Provider // 作成済みのプロバイダー（プロバイダー名ごと）
+}
+
+// newModelRouter はルーターを作成する
+func newModelRouter(cfg *config.Config) *modelRouter {
+	return &modelRouter{
+		cfg:       cfg,
+		providers: make(map[string]llm.Provider),
+	}
+}
+
+// providerFor はモデルを提供するプロバイダーを返す（作成済みの場合は使い回す）
+func (r *modelRouter) providerFor(model config.ModelConfig) (llm.Provider, error) {
+	name, providerCfg, err := r.cfg.ModelProvider(model)
+	if err != nil {
+		return nil, err
+	}
+	if provider, ok := r.providers[name]; ok {
+		return provider, nil
+	}
+
+	apiKey := providerCfg.APIKey()
+	if providerCfg.APIKeyEnv != "" && apiKey == "" {
+		return nil, fmt.Errorf("%s environment variable is not set (export %s=your_api_key_here)", providerCfg.APIKeyEnv, providerCfg.APIKeyEnv)
+	}
+
+	provider, err := llm.NewProvider(name, providerCfg, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	r.providers[name] = provider
+	return provider, nil
+}
+
+// forMode はPLAN/AGENTモードに割り当てられたモデルとプロバイダーを返す
+func (r *modelRouter) forMode(planMode bool) (config.ModelConfig, llm.Provider, error) {
+	model, err := r.cfg.ModelForMode(planMode)
+	if err != nil {
+		return config.ModelConfig{}, nil, err
+	}
+	provider, err := r.providerFor(model)
+	if err != nil {
+		return config.ModelConfig{}, nil, err
+	}
+	return model, provider, nil
+}
+
+// escalate はエスカレーション先のモデルとプロバイダーを返す
+// 設定されていない場合や、すでにそのモデルを使っている場合はfalseを返す
+func (r *modelRouter) escalate(current config.ModelConfig) (config.ModelConfig, llm.Provider, bool) {
+	model, ok := r.cfg.GetEscalationModel()
+	if !ok || model.Name == current.Name {
+		return config.ModelConfig{}, nil, false
+	}
+	provider, err := r.providerFor(model)
+	if err != nil {
+		fmt.Printf("Cannot escalate to %s: %v\n", model.Name, err)
+		return config.ModelConfig{}, nil, false
+	}
+	return model, provider, true
+}
+
+// forSummary はセッションのタイトルと要約を生成するモデルとプロバイダーを返す
+// 要約用のモデルのプロバイダーが使えない場合（APIキーがないなど）は知らせてAGENTモードのモデルを使う
+func (r *modelRouter) forSummary() (config.ModelConfig, llm.Provider, error) {
+	model, err := r.cfg.GetSummaryModel()
+	if err == nil {
+		var provider llm.Provider
+		if provider, err = r.providerFor(model); err == nil {
+			return model, provider, nil
+		}
+	}
+	fmt.Printf("Cannot use summary_model for session titles: %v (using the agent model instead)\n", err)
+	return r.forMode(false)
+}
+
+// escalationReason はモデルが失敗している兆候があればその理由を返す
+// 不正なJSONの引数を含むツール呼び出しと、ターン内のツールエラー（拒否を除く）の累積回数を調べる
+func escalationReason(toolCalls []openai.ToolCall, toolMessages []openai.ChatCompletionMessage, toolErrors *int, maxToolErrors int) string {
+	for _, toolCall := range toolCalls {
+		if !json.Valid([]byte(toolCall.Function.Arguments)) {
+			return fmt.Sprintf("the model sent invalid JSON arguments to %s", toolCall.Function.Name)
+		}
+	}
+
+	for _, toolMessage := range toolMessages {
+		if toolResultFailed(toolMessage.Content) {
+			*toolErrors++
+		}
+	}
+	if maxToolErrors > 0 && *toolErrors >= maxToolErrors {
+		return fmt.Sprintf("%d tool calls failed in this turn", *toolErrors)
+	}
+	return ""
+}
+
+// toolResultFailed はツールの実行が失敗したかを返す
+// ルールやユーザーによる拒否（deniedがtrueの結果）はモデルの失敗ではないので数えない
+func toolResultFailed(content string) bool {
+	var result struct {
+		Error  string `json:"error"`
+		Denied bool   `json:"denied"`
+	}
+	return json.Unmarshal([]byte(content), &result) == nil && result.Error != "" && !result.Denied
+}
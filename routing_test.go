@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// TestEscalationReason counts only real tool failures toward the error limit
+func TestEscalationReason(t *testing.T) {
+	validCall := openai.ToolCall{ID: "call_1", Function: openai.FunctionCall{Name: "readFile", Arguments: `{"path":"a.go"}`}}
+	invalidCall := openai.ToolCall{ID: "call_2", Function: openai.FunctionCall{Name: "readFile", Arguments: `{"path":`}}
+
+	tests := []struct {
+		name       string
+		toolCalls  []openai.ToolCall
+		results    []string
+		wantErrors int
+		wantReason bool
+	}{
+		{
+			name:       "successful results",
+			toolCalls:  []openai.ToolCall{validCall},
+			results:    []string{`{"content":"package a"}`},
+			wantErrors: 0,
+		},
+		{
+			name:       "execution failures reach the limit",
+			toolCalls:  []openai.ToolCall{validCall, validCall},
+			results:    []string{`{"content":"","error":"ファイルを開けませんでした"}`, `{"error": "Tool execution failed: boom"}`},
+			wantErrors: 2,
+			wantReason: true,
+		},
+		{
+			name:      "user declines and rule denials are not counted",
+			toolCalls: []openai.ToolCall{validCall, validCall, validCall},
+			results: []string{
+				`{"success":false,"error":"ユーザーによってキャンセルされました","denied":true}`,
+				`{"content":"","error":"readFile による .env へのアクセスはパーミッションルールで拒否されています","denied":true}`,
+				`{"files":[],"error":"ユーザーによってキャンセルされました","denied":true}`,
+			},
+			wantErrors: 0,
+		},
+		{
+			name:       "invalid JSON arguments",
+			toolCalls:  []openai.ToolCall{invalidCall},
+			results:    []string{`{"error": "Tool execution failed: 引数の解析に失敗しました"}`},
+			wantErrors: 0,
+			wantReason: true,
+		},
+		{
+			name:       "results that are not JSON",
+			toolCalls:  []openai.ToolCall{validCall},
+			results:    []string{"plain text"},
+			wantErrors: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toolMessages := make([]openai.ChatCompletionMessage, len(tt.results))
+			for i, content := range tt.results {
+				toolMessages[i] = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, Content: content}
+			}
+
+			// 直前のツール呼び出しで1回失敗している状態から数える
+			toolErrors := 1
+			reason := escalationReason(tt.toolCalls, toolMessages, &toolErrors, 3)
+			if got := toolErrors - 1; got != tt.wantErrors {
+				t.Errorf("got %d new tool errors, want %d", got, tt.wantErrors)
+			}
+			if (reason != "") != tt.wantReason {
+				t.Errorf("reason = %q, want escalation %v", reason, tt.wantReason)
+			}
+		})
+	}
+}
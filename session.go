@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"nebula/config"
+	"nebula/memory"
+)
+
+// runSessionCommand は `nebula session` を実行する
+func runSessionCommand(args []string) int {
+	if len(args) == 0 {
+		printSessionUsage()
+		return 2
+	}
+
+	switch args[0] {
+	case "list":
+		return runSessionListCommand(args[1:])
+	case "export":
+		return runSessionExportCommand(args[1:])
+	case "import":
+		return runSessionImportCommand(args[1:])
+	default:
+		fmt.Printf("Unknown session command: %s\n", args[0])
+		printSessionUsage()
+		return 2
+	}
+}
+
+// printSessionUsage は `nebula session` のサブコマンドの一覧を表示する
+func printSessionUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  nebula session list [--limit N]                                   List recent sessions of all projects as a fork tree")
+	fmt.Println("  nebula session export <id> [--format md|json|html] [--output file] Export a session as a transcript")
+	fmt.Println("  nebula session import <file> [--project path]                     Import a JSON export to resume it here")
+}
+
+// parseSessionArgs はフラグを解析し、位置引数を返す
+// `export <id> --format md` のように位置引数をフラグより前に書けるようにする
+func parseSessionArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional, args = args[:1], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return append(positional, fs.Args()...), nil
+}
+
+// openSessionMemory は設定を読み込んでメモリDBを開く
+func openSessionMemory() (*memory.Manager, bool) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return nil, false
+	}
+	memoryManager, err := memory.NewManager(cfg.DatabasePath)
+	if err != nil {
+		fmt.Printf("Error initializing memory: %v\n", err)
+		return nil, false
+	}
+	return memoryManager, true
+}
+
+// runSessionListCommand は `nebula session list` を実行し、エクスポートに使うIDを表示する
+func runSessionListCommand(args []string) int {
+	fs := flag.NewFlagSet("session list", flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "maximum number of sessions to list")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	memoryManager, ok := openSessionMemory()
+	if !ok {
+		return 1
+	}
+	defer memoryManager.Close()
+
+	sessions, err := memoryManager.GetRecentSessions(*limit)
+	if err != nil {
+		fmt.Printf("Error listing sessions: %v\n", err)
+		return 1
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No sessions found")
+		return 0
+	}
+
+	// フォークしたセッションは親の下に並べる
+	for _, node := range sessionTree(sessions) {
+		s := node.Session
+		title := s.Title
+		if title == "" {
+			title = truncateText(s.LastMessage, 60)
+		}
+		if fork := formatForkPoint(s, node.Prefix != ""); fork != "" {
+			title += " (" + fork + ")"
+		}
+		fmt.Printf("%s%s  %s  %3d msgs  %s\n", node.Prefix, s.ID, s.StartedAt.Local().Format("2006-01-02 15:04"), s.MessageCount, title)
+		fmt.Printf("%s    %s\n", node.Indent, s.ProjectPath)
+	}
+	return 0
+}
+
+// runSessionExportCommand は `nebula session export` を実行する
+func runSessionExportCommand(args []string) int {
+	fs := flag.NewFlagSet("session export", flag.ContinueOnError)
+	format := fs.String("format", transcriptMarkdown, "output format: md, json or html")
+	output := fs.String("output", "", "write to this file instead of stdout")
+	positional, err := parseSessionArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fmt.Println("Usage: nebula session export <id> [--format md|json|html] [--output file]")
+		return 2
+	}
+	switch *format {
+	case transcriptMarkdown, transcriptJSON, transcriptHTML:
+	default:
+		fmt.Printf("Unknown format: %s (use md, json or html)\n", *format)
+		return 2
+	}
+
+	memoryManager, ok := openSessionMemory()
+	if !ok {
+		return 1
+	}
+	defer memoryManager.Close()
+
+	sessionID, err := memoryManager.ResolveSessionID(positional[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	export, err := memoryManager.ExportSession(sessionID)
+	if err != nil {
+		fmt.Printf("Error exporting session: %v\n", err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Printf("Error creating %s: %v\n", *output, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := writeTranscript(w, export, *format); err != nil {
+		fmt.Printf("Error writing transcript: %v\n", err)
+		return 1
+	}
+	if *output != "" {
+		fmt.Printf("Exported session %s (%d messages) to %s\n", export.Session.ID, len(export.Messages), *output)
+	}
+	return 0
+}
+
+// runSessionImportCommand は `nebula session import` を実行し、JSONのエクスポートをこのマシンのDBに取り込む
+func runSessionImportCommand(args []string) int {
+	fs := flag.NewFlagSet("session import", flag.ContinueOnError)
+	project := fs.String("project", "", "project directory to attach the session to (default: current directory)")
+	positional, err := parseSessionArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fmt.Println("Usage: nebula session import <file> [--project path]")
+		return 2
+	}
+
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", positional[0], err)
+		return 1
+	}
+	var export memory.SessionExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		fmt.Printf("Error parsing %s: %v (only JSON exports can be imported)\n", positional[0], err)
+		return 1
+	}
+
+	// 取り込んだセッションは現在のプロジェクトのセッション一覧から再開できるようにする
+	projectPath := *project
+	if projectPath == "" {
+		if projectPath, err = os.Getwd(); err != nil {
+			fmt.Printf("Error getting current directory: %v\n", err)
+			return 1
+		}
+	}
+
+	memoryManager, ok := openSessionMemory()
+	if !ok {
+		return 1
+	}
+	defer memoryManager.Close()
+
+	session, err := memoryManager.ImportSession(&export, projectPath)
+	if err != nil {
+		fmt.Printf("Error importing session: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Imported session %s (%d messages) into %s\n", session.ID, len(export.Messages), session.ProjectPath)
+	fmt.Println("Run nebula in that directory and pick the session to resume it")
+	return 0
+}
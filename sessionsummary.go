@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"nebula/memory"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 要約に渡す会話の長さの上限（文字数）
+const (
+	maxSummaryMessageChars    = 1500  // 1メッセージあたり
+	maxSummaryTranscriptChars = 12000 // 会話全体
+	maxSessionTitleRunes      = 80
+)
+
+// summaryPrompt はセッションのタイトルと要約を生成するときの指示
+const summaryPrompt = `You name and summarize coding sessions between a user and "nebula", a coding agent.
+Reply with a JSON object only: {"title": "...", "summary": "..."}
+- title: at most 8 words naming the task, e.g. "Fix race in file watcher". No quotes and no trailing period.
+- summary: one paragraph of 2-4 sentences covering what was asked, what was done or decided, and what is left to do.
+Write both in the language the user writes in.`
+
+// sessionSummarizer は安いモデルでセッションのタイトルと要約を生成し、メモリに保存する
+// 最初のやり取りの後と、セッションの終了時に会話が増えていれば生成し直す
+type sessionSummarizer struct {
+	router        *modelRouter
+	memoryManager *memory.Manager
+	summarized    int  // 前回要約したときのメッセージ数
+	failed        bool // 生成に失敗した場合はやり取りのたびに再試行しない
+}
+
+// newSessionSummarizer は現在のセッションのメッセージ数を起点にサマライザーを作成する
+func newSessionSummarizer(router *modelRouter, memoryManager *memory.Manager) *sessionSummarizer {
+	s := &sessionSummarizer{router: router, memoryManager: memoryManager}
+	if conversation, err := s.conversation(); err == nil {
+		s.summarized = len(conversation)
+	}
+	return s
+}
+
+// afterExchange はタイトルのないセッションにタイトルと要約を付ける
+func (s *sessionSummarizer) afterExchange() {
+	session := s.memoryManager.GetCurrentSession()
+	if session == nil || session.Title != "" || s.failed {
+		return
+	}
+	if err := s.summarize(); err != nil {
+		fmt.Printf("Error summarizing session: %v\n", err)
+		s.failed = true
+	}
+}
+
+// finish はセッションの終了時に、前回の要約の後に会話が続いていれば要約し直す
+func (s *sessionSummarizer) finish() {
+	session := s.memoryManager.GetCurrentSession()
+	if session == nil {
+		return
+	}
+	conversation, err := s.conversation()
+	if err != nil || len(conversation) <= s.summarized {
+		return
+	}
+	if err := s.summarize(); err != nil {
+		fmt.Printf("Error summarizing session: %v\n", err)
+		return
+	}
+	fmt.Printf("Session saved as: %s\n", session.Title)
+}
+
+// conversation は現在のセッションのユーザーとアシスタントの発言を返す（ツールの結果は含めない）
+func (s *sessionSummarizer) conversation() ([]*memory.Message, error) {
+	session := s.memoryManager.GetCurrentSession()
+	if session == nil {
+		return nil, nil
+	}
+	messages, err := s.memoryManager.GetSessionMessages(session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var conversation []*memory.Message
+	for _, msg := range messages {
+		if (msg.Role == "user" || msg.Role == "assistant") && strings.TrimSpace(msg.Content) != "" {
+			conversation = append(conversation, msg)
+		}
+	}
+	return conversation, nil
+}
+
+// summarize は会話からタイトルと要約を生成して保存する
+func (s *sessionSummarizer) summarize() error {
+	conversation, err := s.conversation()
+	if err != nil {
+		return err
+	}
+	if len(conversation) == 0 {
+		return nil
+	}
+
+	model, provider, err := s.router.forSummary()
+	if err != nil {
+		return err
+	}
+	resp, err := provider.CreateChatCompletion(context.Background(), newChatRequest(model, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: summaryPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: formatSummaryTranscript(conversation)},
+	}, nil))
+	if err != nil {
+		return fmt.Errorf("%s API error: %w", provider.Name(), err)
+	}
+	if len(resp.Choices) == 0 {
+		return fmt.Errorf("no response received from %s", provider.Name())
+	}
+	if err := s.memoryManager.RecordUsage(newUsage(model, resp)); err != nil {
+		fmt.Printf("Error recording usage: %v\n", err)
+	}
+
+	title, summary := parseSessionSummary(resp.Choices[0].Message.Content)
+	if title == "" {
+		return fmt.Errorf("the model returned no title")
+	}
+	if err := s.memoryManager.SetSessionSummary(title, summary); err != nil {
+		return err
+	}
+	s.summarized = len(conversation)
+	return nil
+}
+
+// formatSummaryTranscript は要約に渡す会話を文字数の上限に収まるように整形する
+// 上限を超える場合は最初の依頼と、最近の発言を優先して残す
+func formatSummaryTranscript(conversation []*memory.Message) string {
+	entries := make([]string, len(conversation))
+	for i, msg := range conversation {
+		content := strings.TrimSpace(msg.Content)
+		if truncated := truncateText(content, maxSummaryMessageChars); truncated != content {
+			content = truncated + "..."
+		}
+		entries[i] = fmt.Sprintf("%s: %s", strings.ToUpper(msg.Role), content)
+	}
+
+	total := len(entries[0])
+	start := len(entries)
+	for start > 1 && total+len(entries[start-1]) <= maxSummaryTranscriptChars {
+		start--
+		total += len(entries[start])
+	}
+
+	parts := []string{entries[0]}
+	if start > 1 {
+		parts = append(parts, fmt.Sprintf("[%d messages omitted]", start-1))
+	}
+	parts = append(parts, entries[start:]...)
+	return strings.Join(parts, "\n\n")
+}
+
+// parseSessionSummary はモデルの応答からタイトルと要約を取り出す
+// JSONで返ってこなかった場合は1行目をタイトル、残りを要約とみなす
+func parseSessionSummary(content string) (string, string) {
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+	content = strings.TrimSpace(content)
+
+	var result struct {
+		Title   string `json:"title"`
+		Summary string `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		result.Title, result.Summary, _ = strings.Cut(content, "\n")
+	}
+	return cleanSessionTitle(result.Title), strings.Join(strings.Fields(result.Summary), " ")
+}
+
+// cleanSessionTitle はタイトルを1行にまとめ、引用符と末尾のピリオドを取り除く
+func cleanSessionTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	title = strings.Trim(title, "\"'`#* ")
+	title = strings.TrimRight(title, ".。")
+	return truncateText(title, maxSessionTitleRunes)
+}
+
+// truncateText は文字の途中で切らないように文字数で切り詰める
+func truncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit])
+}
+
+// handleRenameCommand sets the title of the current session
+func handleRenameCommand(memoryManager *memory.Manager, title string) {
+	title = cleanSessionTitle(title)
+	if title == "" {
+		if session := memoryManager.GetCurrentSession(); session != nil && session.Title != "" {
+			fmt.Printf("Current title: %s\n", session.Title)
+		}
+		fmt.Println("Usage: /rename <title>")
+		return
+	}
+	if err := memoryManager.RenameSession(title); err != nil {
+		fmt.Printf("Error renaming session: %v\n", err)
+		return
+	}
+	fmt.Printf("Session renamed to: %s\n", title)
+}
@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"nebula/permission"
+)
+
+// promptMu は並列実行中のツールからのユーザーへの問い合わせが重ならないようにする
+var promptMu sync.Mutex
+
+// defaultPageLines はページャーを使い始める行数の既定値
+const defaultPageLines = 40
+
+// ApprovalDecision はユーザーによる承認結果を表す構造体
+type ApprovalDecision struct {
+	Approved    bool
+	SelectHunks bool   // ハンクごとに適用するかを選ぶ場合にtrue
+	Feedback    string // 理由付きで拒否された場合のユーザーからのフィードバック
+	// Remember は「常に許可」が選ばれた場合のスコープ（選ばれなかった場合は空）
+	Remember permission.Scope
+}
+
+// approvalOptions は承認プロンプトで提示する選択肢を表す構造体
+type approvalOptions struct {
+	AllowHunks    bool // ハンクごとの選択を提示する
+	AllowRemember bool // セッション・プロジェクト単位の「常に許可」を提示する
+}
+
+// HunkSelection はハンクごとの選択結果を表す構造体
+type HunkSelection struct {
+	Accepted []bool
+	Aborted  bool
+}
+
+// readUserLine は標準入力から1行読み込む
+func readUserLine() (string, bool) {
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return "", false
+	}
+	return strings.TrimSpace(scanner.Text()), true
+}
+
+// pageThreshold はページャーを使う行数のしきい値を返す（LINES環境変数があれば使用）
+func pageThreshold() int {
+	if lines, err := strconv.Atoi(os.Getenv("LINES")); err == nil && lines > 5 {
+		return lines - 5
+	}
+	return defaultPageLines
+}
+
+// showPreview はプレビューを表示する。長い場合はページャーで表示する
+func showPreview(text string) {
+	if strings.Count(text, "\n") <= pageThreshold() {
+		fmt.Print(text)
+		return
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -R"
+	}
+	fields := strings.Fields(pager)
+
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// ページャーが使えない場合はそのまま表示
+		fmt.Print(text)
+	}
+}
+
+// previewNewFile は新規ファイルの内容を全行追加の差分として整形する
+func previewNewFile(path, content string) string {
+	lines := splitLines(content)
+	if len(lines) == 0 {
+		return colorize(colorBold, "+++ "+path) + "\n(空のファイル)\n"
+	}
+
+	ops := make([]DiffOp, 0, len(lines))
+	for _, line := range lines {
+		ops = append(ops, DiffOp{Kind: '+', Line: line})
+	}
+	return formatUnifiedDiff("/dev/null", path, []Hunk{{NewStart: 1, NewLines: len(lines), Ops: ops}})
+}
+
+// askApproval は変更の実行についてユーザーの承認を求める
+func askApproval(opts approvalOptions) (ApprovalDecision, error) {
+	choices := []string{"y=はい", "N=いいえ", "f=理由を添えて拒否"}
+	if opts.AllowHunks {
+		choices = append(choices, "h=ハンクごとに選択")
+	}
+	if opts.AllowRemember {
+		choices = append(choices, "s=このセッションでは常に許可", "p=このプロジェクトでは常に許可")
+	}
+	fmt.Printf("実行してもよろしいですか？ (%s): ", strings.Join(choices, " / "))
+
+	response, ok := readUserLine()
+	if !ok {
+		return ApprovalDecision{}, fmt.Errorf("ユーザー入力の読み取りに失敗しました")
+	}
+
+	switch response {
+	case "y", "Y":
+		return ApprovalDecision{Approved: true}, nil
+	case "h", "H":
+		if !opts.AllowHunks {
+			return ApprovalDecision{Approved: false}, nil
+		}
+		return ApprovalDecision{Approved: true, SelectHunks: true}, nil
+	case "s", "S":
+		if !opts.AllowRemember {
+			return ApprovalDecision{Approved: false}, nil
+		}
+		return ApprovalDecision{Approved: true, Remember: permission.ScopeSession}, nil
+	case "p", "P":
+		if !opts.AllowRemember {
+			return ApprovalDecision{Approved: false}, nil
+		}
+		return ApprovalDecision{Approved: true, Remember: permission.ScopeProject}, nil
+	case "f", "F":
+		fmt.Print("モデルへのフィードバックを入力してください: ")
+		feedback, ok := readUserLine()
+		if !ok {
+			return ApprovalDecision{}, fmt.Errorf("ユーザー入力の読み取りに失敗しました")
+		}
+		return ApprovalDecision{Approved: false, Feedback: feedback}, nil
+	default:
+		return ApprovalDecision{Approved: false}, nil
+	}
+}
+
+// selectHunks はgit add -pのようにハンクを1つずつ表示して適用するかを尋ねる
+func selectHunks(hunks []Hunk) (HunkSelection, error) {
+	selection := HunkSelection{Accepted: make([]bool, len(hunks))}
+
+	for i := 0; i < len(hunks); i++ {
+		fmt.Printf("\n(%d/%d)\n", i+1, len(hunks))
+		fmt.Print(formatHunk(hunks[i], true))
+		fmt.Print("このハンクを適用しますか？ (y=適用 / n=スキップ / a=残りを全て適用 / d=残りを全てスキップ / q=中止): ")
+
+		response, ok := readUserLine()
+		if !ok {
+			return HunkSelection{}, fmt.Errorf("ユーザー入力の読み取りに失敗しました")
+		}
+
+		switch response {
+		case "y", "Y":
+			selection.Accepted[i] = true
+		case "n", "N":
+			selection.Accepted[i] = false
+		case "a", "A":
+			for j := i; j < len(hunks); j++ {
+				selection.Accepted[j] = true
+			}
+			return selection, nil
+		case "d", "D":
+			return selection, nil
+		case "q", "Q":
+			selection.Aborted = true
+			return selection, nil
+		default:
+			fmt.Println("y, n, a, d, q のいずれかを入力してください")
+			i-- // 同じハンクをもう一度尋ねる
+		}
+	}
+
+	return selection, nil
+}
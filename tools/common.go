@@ -4,8 +4,25 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
+// Capabilities はツールの副作用と承認の要否を表す構造体
+type Capabilities struct {
+	ReadOnly          bool // ワークスペースやシステムの状態を変更しない
+	WritesFiles       bool // ファイルを作成・変更する
+	ExecutesProcesses bool // 外部プロセスを実行する
+	UsesNetwork       bool // ネットワークにアクセスする
+	NeedsApproval     bool // 実行前にユーザーの承認を求める
+	PlanOnly          bool // planモードでのみモデルに提供する
+	Sequential        bool // 共有の状態を書き換えるため、他のツールと並列に実行しない
+}
+
+// AllowedInPlanMode はplanモード（読み取り専用）で使えるツールかどうかを返す
+func (c Capabilities) AllowedInPlanMode() bool {
+	return c.ReadOnly && !c.WritesFiles && !c.ExecutesProcesses
+}
+
 // ToolDefinition はLLMが呼び出せるツールを表す構造体
 type ToolDefinition struct {
-	Schema   openai.Tool
-	Function func(args string) (string, error)
-}
\ No newline at end of file
+	Schema       openai.Tool
+	Function     func(args string) (string, error)
+	Capabilities Capabilities
+}
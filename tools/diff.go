@@ -0,0 +1,278 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// diffContextLines はハンクの前後に表示するコンテキスト行数
+const diffContextLines = 3
+
+// maxDiffMatrixCells はLCS計算に使う表の最大サイズ（これを超える場合は全置換として扱う）
+const maxDiffMatrixCells = 4_000_000
+
+// ANSIカラーコード
+const (
+	colorReset = "\033[0m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+	colorBold  = "\033[1m"
+)
+
+// DiffOp は差分の1行分の操作を表す構造体
+type DiffOp struct {
+	Kind byte   // ' ' (変更なし), '-' (削除), '+' (追加)
+	Line string // 改行を含む行の内容
+}
+
+// Hunk は連続した変更とその前後のコンテキストをまとめた構造体
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Ops      []DiffOp
+	// opStart はcomputeDiffが返した操作列の中でのこのハンクの開始位置
+	opStart int
+}
+
+// splitLines は改行を保持したまま文字列を行に分割する
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// computeDiff は2つの行リストの差分を行単位の操作列として返す
+func computeDiff(oldLines, newLines []string) []DiffOp {
+	// 共通の先頭・末尾を除外して計算量を減らす
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	var ops []DiffOp
+	for _, line := range oldLines[:prefix] {
+		ops = append(ops, DiffOp{Kind: ' ', Line: line})
+	}
+	ops = append(ops, diffMiddle(oldLines[prefix:len(oldLines)-suffix], newLines[prefix:len(newLines)-suffix])...)
+	for _, line := range oldLines[len(oldLines)-suffix:] {
+		ops = append(ops, DiffOp{Kind: ' ', Line: line})
+	}
+	return ops
+}
+
+// diffMiddle はLCS（最長共通部分列）を用いて差分を計算する
+func diffMiddle(a, b []string) []DiffOp {
+	var ops []DiffOp
+
+	// 表が大きすぎる場合は全削除・全追加として扱う
+	if len(a)*len(b) > maxDiffMatrixCells {
+		for _, line := range a {
+			ops = append(ops, DiffOp{Kind: '-', Line: line})
+		}
+		for _, line := range b {
+			ops = append(ops, DiffOp{Kind: '+', Line: line})
+		}
+		return ops
+	}
+
+	// lcs[i][j] は a[i:] と b[j:] のLCSの長さ
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, DiffOp{Kind: ' ', Line: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, DiffOp{Kind: '-', Line: a[i]})
+			i++
+		default:
+			ops = append(ops, DiffOp{Kind: '+', Line: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, DiffOp{Kind: '-', Line: a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, DiffOp{Kind: '+', Line: b[j]})
+	}
+	return ops
+}
+
+// buildHunks は操作列をコンテキスト付きのハンクにまとめる
+func buildHunks(ops []DiffOp) []Hunk {
+	var hunks []Hunk
+
+	// 変更のある操作の位置を集める
+	var changes []int
+	for i, op := range ops {
+		if op.Kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	// 近接する変更を同じハンクにまとめる
+	start := max(changes[0]-diffContextLines, 0)
+	end := changes[0]
+	ranges := [][2]int{}
+	for _, c := range changes[1:] {
+		if c-end > diffContextLines*2 {
+			ranges = append(ranges, [2]int{start, min(end+diffContextLines+1, len(ops))})
+			start = max(c-diffContextLines, 0)
+		}
+		end = c
+	}
+	ranges = append(ranges, [2]int{start, min(end+diffContextLines+1, len(ops))})
+
+	// 各ハンクの行番号を計算
+	oldLine, newLine := 1, 1
+	pos := 0
+	for _, r := range ranges {
+		for ; pos < r[0]; pos++ {
+			oldLine, newLine = advanceLines(ops[pos], oldLine, newLine)
+		}
+		hunk := Hunk{OldStart: oldLine, NewStart: newLine, Ops: ops[r[0]:r[1]], opStart: r[0]}
+		for ; pos < r[1]; pos++ {
+			switch ops[pos].Kind {
+			case ' ':
+				hunk.OldLines++
+				hunk.NewLines++
+			case '-':
+				hunk.OldLines++
+			case '+':
+				hunk.NewLines++
+			}
+			oldLine, newLine = advanceLines(ops[pos], oldLine, newLine)
+		}
+		hunks = append(hunks, hunk)
+	}
+	return hunks
+}
+
+// advanceLines は操作に応じて旧・新ファイルの行番号を進める
+func advanceLines(op DiffOp, oldLine, newLine int) (int, int) {
+	switch op.Kind {
+	case ' ':
+		return oldLine + 1, newLine + 1
+	case '-':
+		return oldLine + 1, newLine
+	default:
+		return oldLine, newLine + 1
+	}
+}
+
+// colorEnabled は色付き出力を行うかどうかを返す（NO_COLOR環境変数で無効化できる）
+func colorEnabled() bool {
+	return os.Getenv("NO_COLOR") == ""
+}
+
+// colorize は色付き出力が有効な場合に文字列をANSIカラーで囲む
+func colorize(color, s string) string {
+	if !colorEnabled() {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// applyHunks は承認されたハンクだけを元の内容に適用した結果を返す
+func applyHunks(ops []DiffOp, hunks []Hunk, accepted []bool) string {
+	// 拒否されたハンクに含まれる操作をマークする
+	rejected := make([]bool, len(ops))
+	for i, hunk := range hunks {
+		if accepted[i] {
+			continue
+		}
+		for j := hunk.opStart; j < hunk.opStart+len(hunk.Ops); j++ {
+			rejected[j] = true
+		}
+	}
+
+	var sb strings.Builder
+	for i, op := range ops {
+		switch {
+		case op.Kind == ' ':
+			sb.WriteString(op.Line)
+		case op.Kind == '-' && rejected[i]:
+			sb.WriteString(op.Line) // 削除を取り消して元の行を残す
+		case op.Kind == '+' && !rejected[i]:
+			sb.WriteString(op.Line)
+		}
+	}
+	return sb.String()
+}
+
+// formatHunkHeader はハンクの "@@ -a,b +c,d @@" ヘッダーを返す
+func formatHunkHeader(hunk Hunk) string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", hunk.OldStart, hunk.OldLines, hunk.NewStart, hunk.NewLines)
+}
+
+// formatHunk は1つのハンクを文字列に整形する（coloredがtrueなら色付き）
+func formatHunk(hunk Hunk, colored bool) string {
+	paint := func(color, s string) string {
+		if !colored {
+			return s
+		}
+		return colorize(color, s)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(paint(colorCyan, formatHunkHeader(hunk)))
+	sb.WriteString("\n")
+	for _, op := range hunk.Ops {
+		line := string(op.Kind) + strings.TrimSuffix(op.Line, "\n")
+		switch op.Kind {
+		case '-':
+			line = paint(colorRed, line)
+		case '+':
+			line = paint(colorGreen, line)
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+		if !strings.HasSuffix(op.Line, "\n") {
+			sb.WriteString("\\ No newline at end of file\n")
+		}
+	}
+	return sb.String()
+}
+
+// formatUnifiedDiff はハンクのリストを色付きのunified diff形式に整形する
+func formatUnifiedDiff(oldName, newName string, hunks []Hunk) string {
+	var sb strings.Builder
+	sb.WriteString(colorize(colorBold, "--- "+oldName))
+	sb.WriteString("\n")
+	sb.WriteString(colorize(colorBold, "+++ "+newName))
+	sb.WriteString("\n")
+	for _, hunk := range hunks {
+		sb.WriteString(formatHunk(hunk, true))
+	}
+	return sb.String()
+}
@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns "line1\n" ... "lineN\n" with the given lines replaced
+func numberedLines(n int, replace map[int]string) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		if line, ok := replace[i]; ok {
+			sb.WriteString(line)
+		} else {
+			fmt.Fprintf(&sb, "line%d\n", i)
+		}
+	}
+	return sb.String()
+}
+
+// describeOps formats diff operations as " a", "-b" and "+c" for comparison
+func describeOps(ops []DiffOp) []string {
+	var out []string
+	for _, op := range ops {
+		out = append(out, string(op.Kind)+strings.TrimSuffix(op.Line, "\n"))
+	}
+	return out
+}
+
+func TestComputeDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want []string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", []string{" a", " b"}},
+		{"insertion", "a\nc\n", "a\nb\nc\n", []string{" a", "+b", " c"}},
+		{"deletion", "a\nb\nc\n", "a\nc\n", []string{" a", "-b", " c"}},
+		{"replacement", "a\nb\nc\n", "a\nB\nc\n", []string{" a", "-b", "+B", " c"}},
+		{"new file", "", "a\nb\n", []string{"+a", "+b"}},
+		{"emptied file", "a\nb\n", "", []string{"-a", "-b"}},
+		{"moved line", "a\nb\nc\n", "b\nc\na\n", []string{"-a", " b", " c", "+a"}},
+		{"missing final newline", "a\nb", "a\nb\n", []string{" a", "-b", "+b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := computeDiff(splitLines(tt.old), splitLines(tt.new))
+			if got := describeOps(ops); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ops = %q, want %q", got, tt.want)
+			}
+
+			// 変更なしと削除の行は元の内容に、変更なしと追加の行は新しい内容になる
+			var oldText, newText strings.Builder
+			for _, op := range ops {
+				if op.Kind != '+' {
+					oldText.WriteString(op.Line)
+				}
+				if op.Kind != '-' {
+					newText.WriteString(op.Line)
+				}
+			}
+			if oldText.String() != tt.old || newText.String() != tt.new {
+				t.Errorf("ops rebuild %q -> %q, want %q -> %q", oldText.String(), newText.String(), tt.old, tt.new)
+			}
+		})
+	}
+}
+
+func TestBuildHunks(t *testing.T) {
+	tests := []struct {
+		name        string
+		old         string
+		new         string
+		wantHeaders []string
+	}{
+		{"no changes", numberedLines(10, nil), numberedLines(10, nil), nil},
+		{
+			name:        "distant changes are separate hunks",
+			old:         numberedLines(20, nil),
+			new:         numberedLines(20, map[int]string{2: "LINE2\n", 18: "LINE18\n"}),
+			wantHeaders: []string{"@@ -1,5 +1,5 @@", "@@ -15,6 +15,6 @@"},
+		},
+		{
+			name:        "nearby changes share a hunk",
+			old:         numberedLines(20, nil),
+			new:         numberedLines(20, map[int]string{2: "LINE2\n", 8: "LINE8\n"}),
+			wantHeaders: []string{"@@ -1,11 +1,11 @@"},
+		},
+		{
+			name:        "insertion shifts the new line numbers",
+			old:         numberedLines(20, nil),
+			new:         numberedLines(20, map[int]string{1: "header\nline1\n", 18: "LINE18\n"}),
+			wantHeaders: []string{"@@ -1,3 +1,4 @@", "@@ -15,6 +16,6 @@"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks := buildHunks(computeDiff(splitLines(tt.old), splitLines(tt.new)))
+			var got []string
+			for _, hunk := range hunks {
+				got = append(got, formatHunkHeader(hunk))
+			}
+			if !reflect.DeepEqual(got, tt.wantHeaders) {
+				t.Errorf("hunk headers = %q, want %q", got, tt.wantHeaders)
+			}
+		})
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	old := numberedLines(20, nil)
+	edited := numberedLines(20, map[int]string{2: "LINE2\n", 17: "", 18: "LINE18\nextra\n"})
+
+	tests := []struct {
+		name     string
+		accepted []bool
+		want     string
+	}{
+		{"all hunks", []bool{true, true}, edited},
+		{"no hunks", []bool{false, false}, old},
+		{"first hunk only", []bool{true, false}, numberedLines(20, map[int]string{2: "LINE2\n"})},
+		{"second hunk only", []bool{false, true}, numberedLines(20, map[int]string{17: "", 18: "LINE18\nextra\n"})},
+	}
+
+	ops := computeDiff(splitLines(old), splitLines(edited))
+	hunks := buildHunks(ops)
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2", len(hunks))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyHunks(ops, hunks, tt.accepted); got != tt.want {
+				t.Errorf("applyHunks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestApplyHunksWithoutFinalNewline keeps the last line as it was when the
+// hunk touching it is rejected
+func TestApplyHunksWithoutFinalNewline(t *testing.T) {
+	old := numberedLines(20, nil) + "last"
+	edited := numberedLines(20, map[int]string{1: "first\n"}) + "last line\n"
+
+	ops := computeDiff(splitLines(old), splitLines(edited))
+	hunks := buildHunks(ops)
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2", len(hunks))
+	}
+	if got, want := applyHunks(ops, hunks, []bool{true, false}), numberedLines(20, map[int]string{1: "first\n"})+"last"; got != want {
+		t.Errorf("applyHunks = %q, want %q", got, want)
+	}
+	if !strings.Contains(formatHunk(hunks[1], false), "\\ No newline at end of file") {
+		t.Errorf("hunk does not mark the missing newline:\n%s", formatHunk(hunks[1], false))
+	}
+}
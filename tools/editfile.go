@@ -1,11 +1,11 @@
 package tools
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"os"
-	"strings"
+
+	"nebula/permission"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/sashabaranov/go-openai/jsonschema"
@@ -19,8 +19,20 @@ type EditFileArgs struct {
 
 // EditFileResult はeditFileツールの結果を表す構造体
 type EditFileResult struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error,omitempty"`
+	Success       bool           `json:"success"`
+	Error         string         `json:"error,omitempty"`
+	Denied        bool           `json:"denied,omitempty"`         // ルールやユーザーによって拒否された場合はtrue
+	Feedback      string         `json:"feedback,omitempty"`       // 拒否時のユーザーからのフィードバック
+	Message       string         `json:"message,omitempty"`        // 一部のハンクのみ適用された場合の説明
+	AppliedHunks  []int          `json:"applied_hunks,omitempty"`  // 適用されたハンクの番号（1始まり）
+	RejectedHunks []RejectedHunk `json:"rejected_hunks,omitempty"` // 拒否されたハンクの詳細
+}
+
+// RejectedHunk はユーザーが拒否したハンクを表す構造体
+type RejectedHunk struct {
+	Index  int    `json:"index"`  // ハンクの番号（1始まり）
+	Header string `json:"header"` // "@@ -a,b +c,d @@" 形式の位置情報
+	Diff   string `json:"diff"`   // 拒否された変更内容（unified diff形式）
 }
 
 // EditFile は既存ファイルの内容を完全に上書きする（ユーザー許可が必要）
@@ -30,8 +42,31 @@ func EditFile(args string) (string, error) {
 		return "", fmt.Errorf("引数の解析に失敗しました: %v", err)
 	}
 
+	// ワークスペース内のパスに解決
+	path, err := resolvePath(editArgs.Path)
+	if err != nil {
+		result := EditFileResult{
+			Success: false,
+			Error:   err.Error(),
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
+	// パーミッションルールを確認
+	permissionDecision := checkPermission("editFile", path)
+	if permissionDecision.Action == permission.Deny {
+		result := EditFileResult{
+			Success: false,
+			Error:   deniedMessage("editFile", editArgs.Path, permissionDecision),
+			Denied:  true,
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
 	// ファイルが存在するかチェック
-	if _, err := os.Stat(editArgs.Path); os.IsNotExist(err) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
 		result := EditFileResult{
 			Success: false,
 			Error:   "ファイルが存在しません。新しいファイルの作成にはwriteFileを使用してください。",
@@ -40,32 +75,104 @@ func EditFile(args string) (string, error) {
 		return string(resultJSON), nil
 	}
 
+	// 現在の内容を読み込み差分を表示
+	currentContent, err := os.ReadFile(path)
+	if err != nil {
+		result := EditFileResult{
+			Success: false,
+			Error:   fmt.Sprintf("ファイルの読み込みに失敗しました: %v", err),
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
+	// 制御文字をクリーンアップ
+	editArgs.NewContent = CleanControlCharacters(editArgs.NewContent)
+
+	ops := computeDiff(splitLines(string(currentContent)), splitLines(editArgs.NewContent))
+	hunks := buildHunks(ops)
+	if len(hunks) == 0 {
+		fmt.Printf("\n%s に変更はありません\n", editArgs.Path)
+		result := EditFileResult{
+			Success: true,
+			Error:   "",
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
 	// ユーザーに許可を求める
 	fmt.Printf("\n既存ファイルを編集します: %s\n", editArgs.Path)
-	fmt.Print("実行してもよろしいですか？ (y/N): ")
-
-	scanner := bufio.NewScanner(os.Stdin)
-	if !scanner.Scan() {
+	preview := formatUnifiedDiff("a/"+editArgs.Path, "b/"+editArgs.Path, hunks)
+	decision, err := confirmChange("editFile", path, permissionDecision, preview, len(hunks) > 1)
+	if err != nil {
 		result := EditFileResult{
 			Success: false,
-			Error:   "ユーザー入力の読み取りに失敗しました",
+			Error:   err.Error(),
 		}
 		resultJSON, _ := json.Marshal(result)
 		return string(resultJSON), nil
 	}
 
-	userResponse := strings.TrimSpace(scanner.Text())
-	if userResponse != "y" && userResponse != "Y" {
+	if !decision.Approved {
 		result := EditFileResult{
-			Success: false,
-			Error:   "ユーザーによってキャンセルされました",
+			Success:  false,
+			Error:    "ユーザーによってキャンセルされました",
+			Denied:   true,
+			Feedback: decision.Feedback,
 		}
 		resultJSON, _ := json.Marshal(result)
 		return string(resultJSON), nil
 	}
 
+	// ハンクごとに選択する場合は承認されたハンクだけを適用
+	result := EditFileResult{Success: true}
+	if decision.SelectHunks {
+		selection, err := selectHunks(hunks)
+		if err != nil {
+			result := EditFileResult{
+				Success: false,
+				Error:   err.Error(),
+			}
+			resultJSON, _ := json.Marshal(result)
+			return string(resultJSON), nil
+		}
+
+		for i, hunk := range hunks {
+			if selection.Accepted[i] {
+				result.AppliedHunks = append(result.AppliedHunks, i+1)
+				continue
+			}
+			result.RejectedHunks = append(result.RejectedHunks, RejectedHunk{
+				Index:  i + 1,
+				Header: formatHunkHeader(hunk),
+				Diff:   formatHunk(hunk, false),
+			})
+		}
+
+		if selection.Aborted || len(result.AppliedHunks) == 0 {
+			result := EditFileResult{
+				Success: false,
+				Error:   "ユーザーによって全てのハンクが拒否されました。ファイルは変更されていません。",
+				Denied:  true,
+			}
+			resultJSON, _ := json.Marshal(result)
+			return string(resultJSON), nil
+		}
+
+		if len(result.RejectedHunks) > 0 {
+			fmt.Print("拒否したハンクについてモデルへのフィードバックがあれば入力してください（空欄でスキップ）: ")
+			if feedback, ok := readUserLine(); ok {
+				result.Feedback = feedback
+			}
+			result.Message = fmt.Sprintf("%d個中%d個のハンクのみ適用しました。rejected_hunksの変更はファイルに書き込まれていません。", len(hunks), len(result.AppliedHunks))
+		}
+
+		editArgs.NewContent = applyHunks(ops, hunks, selection.Accepted)
+	}
+
 	// ファイルを開いて完全に上書き
-	file, err := os.Create(editArgs.Path)
+	file, err := os.Create(path)
 	if err != nil {
 		result := EditFileResult{
 			Success: false,
@@ -76,9 +183,6 @@ func EditFile(args string) (string, error) {
 	}
 	defer file.Close()
 
-	// 制御文字をクリーンアップ
-	editArgs.NewContent = CleanControlCharacters(editArgs.NewContent)
-
 	// 新しい内容を書き込み
 	if _, err := file.WriteString(editArgs.NewContent); err != nil {
 		result := EditFileResult{
@@ -89,10 +193,6 @@ func EditFile(args string) (string, error) {
 		return string(resultJSON), nil
 	}
 
-	result := EditFileResult{
-		Success: true,
-		Error:   "",
-	}
 	resultJSON, _ := json.Marshal(result)
 	return string(resultJSON), nil
 }
@@ -104,7 +204,7 @@ func GetEditFileTool() ToolDefinition {
 			Type: openai.ToolTypeFunction,
 			Function: &openai.FunctionDefinition{
 				Name:        "editFile",
-				Description: "既存ファイルの内容を完全に上書きします。安全な編集のため、必ずreadFileで現在の内容を確認してから使用してください。実行前にユーザーの許可を求めます。",
+				Description: "既存ファイルの内容を完全に上書きします。安全な編集のため、必ずreadFileで現在の内容を確認してから使用してください。実行前に差分を表示してユーザーの許可を求めます。拒否された場合、結果のfeedbackにユーザーからの指示が含まれることがあります。ユーザーがハンクごとに選択した場合は、適用されなかった変更がrejected_hunksで返されます。",
 				Parameters: jsonschema.Definition{
 					Type: jsonschema.Object,
 					Properties: map[string]jsonschema.Definition{
@@ -121,6 +221,7 @@ func GetEditFileTool() ToolDefinition {
 				},
 			},
 		},
-		Function: EditFile,
+		Function:     EditFile,
+		Capabilities: Capabilities{WritesFiles: true, NeedsApproval: true},
 	}
 }
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 
+	"nebula/permission"
+
 	"github.com/sashabaranov/go-openai"
 	"github.com/sashabaranov/go-openai/jsonschema"
 )
@@ -18,8 +20,9 @@ type ListArgs struct {
 
 // ListResult はlistツールの結果を表す構造体
 type ListResult struct {
-	Files []string `json:"files"`
-	Error string   `json:"error,omitempty"`
+	Files  []string `json:"files"`
+	Error  string   `json:"error,omitempty"`
+	Denied bool     `json:"denied,omitempty"` // ルールやユーザーによって拒否された場合はtrue
 }
 
 // List は指定されたパス内のファイルとディレクトリをリストする
@@ -29,14 +32,48 @@ func List(args string) (string, error) {
 		return "", fmt.Errorf("引数の解析に失敗しました: %v", err)
 	}
 
+	// ワークスペース内のパスに解決
+	root, err := resolvePath(listArgs.Path)
+	if err != nil {
+		result := ListResult{
+			Files: []string{},
+			Error: err.Error(),
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
+	// パーミッションルールを確認
+	if message, denied := authorizeRead("list", listArgs.Path, root); message != "" {
+		result := ListResult{
+			Files:  []string{},
+			Error:  message,
+			Denied: denied,
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
 	var files []string
 
 	if listArgs.Recursive {
-		err := filepath.Walk(listArgs.Path, func(path string, info os.FileInfo, err error) error {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			files = append(files, path)
+			// ルールで拒否されたファイルやディレクトリは名前も返さない
+			if path != root && checkPermission("list", path).Action == permission.Deny {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// 結果はモデルが指定したパスを基準に返す
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.Join(listArgs.Path, rel))
 			return nil
 		})
 		if err != nil {
@@ -48,7 +85,7 @@ func List(args string) (string, error) {
 			return string(resultJSON), nil
 		}
 	} else {
-		entries, err := os.ReadDir(listArgs.Path)
+		entries, err := os.ReadDir(root)
 		if err != nil {
 			result := ListResult{
 				Files: []string{},
@@ -59,6 +96,9 @@ func List(args string) (string, error) {
 		}
 
 		for _, entry := range entries {
+			if checkPermission("list", filepath.Join(root, entry.Name())).Action == permission.Deny {
+				continue
+			}
 			files = append(files, filepath.Join(listArgs.Path, entry.Name()))
 		}
 	}
@@ -95,6 +135,7 @@ func GetListTool() ToolDefinition {
 				},
 			},
 		},
-		Function: List,
+		Function:     List,
+		Capabilities: Capabilities{ReadOnly: true},
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"nebula/permission"
+)
+
+// setupWorkspace creates the files under a temporary workspace root and
+// applies the permission rules for the duration of the test
+func setupWorkspace(t *testing.T, files []string, rules ...permission.Rule) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, name := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := SetWorkspace(root, nil); err != nil {
+		t.Fatal(err)
+	}
+	SetPermissionChecker(permission.NewChecker(rules, nil, nil))
+	t.Cleanup(func() {
+		workspace = nil
+		permissionChecker = nil
+	})
+	return root
+}
+
+// TestListSkipsDeniedEntries hides files and directories denied by the rules
+func TestListSkipsDeniedEntries(t *testing.T) {
+	setupWorkspace(t,
+		[]string{"main.go", ".env", ".env.local", "config/.env.production", "config/app.json", "secret/key.pem"},
+		permission.Rule{Path: ".env*", Action: permission.Deny},
+		permission.Rule{Path: "secret/**", Action: permission.Deny},
+	)
+
+	tests := []struct {
+		name      string
+		recursive bool
+		want      []string
+	}{
+		{"top level", false, []string{"config", "main.go"}},
+		{"recursive", true, []string{".", "config", "config/app.json", "main.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, _ := json.Marshal(ListArgs{Path: ".", Recursive: tt.recursive})
+			out, err := List(string(args))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result ListResult
+			if err := json.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, len(result.Files))
+			for i, file := range result.Files {
+				got[i] = filepath.ToSlash(file)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"nebula/permission"
+)
+
+// permissionChecker はツールの実行可否を判定するチェッカー（nilの場合はルールなし）
+var permissionChecker *permission.Checker
+
+// SetPermissionChecker はツールが使うパーミッションチェッカーを設定する
+func SetPermissionChecker(checker *permission.Checker) {
+	permissionChecker = checker
+}
+
+// relativePath はルールとの照合に使うワークスペースルートからの相対パスを返す
+// ワークスペース外（許可ディレクトリなど）の場合は絶対パスを返す
+func relativePath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	root := "."
+	if workspace != nil {
+		root = workspace.Root
+	}
+	root, err = filepath.Abs(root)
+	if err != nil || !isWithin(root, abs) {
+		return filepath.ToSlash(abs)
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// checkPermission はツールとパスに対するルールの判定結果を返す
+// pにはresolvePathで解決済みのパスを渡す
+func checkPermission(tool, p string) permission.Decision {
+	if permissionChecker == nil {
+		return permission.Decision{}
+	}
+	return permissionChecker.Check(permission.Request{Tool: tool, Path: relativePath(p)})
+}
+
+// deniedMessage はルールで拒否されたことを示すエラーメッセージを返す
+func deniedMessage(tool, p string, decision permission.Decision) string {
+	return fmt.Sprintf("%s による %s へのアクセスはパーミッションルール（%s: %s）で拒否されています", tool, p, decision.Scope, decision.Rule)
+}
+
+// rememberApproval は「常に許可」の選択をルールとして保存する
+// ルールは承認したファイルだけに適用し、ユーザーがglobを入力した場合はそのパスに広げる
+// pには解決済みのパスを渡す
+func rememberApproval(tool, p string, scope permission.Scope) {
+	if permissionChecker == nil {
+		return
+	}
+
+	rel := relativePath(p)
+	suggestion := "**"
+	if dir := path.Dir(rel); dir != "." && dir != "/" {
+		suggestion = dir + "/**"
+	}
+	fmt.Printf("自動承認するパス (Enterで %s のみ、例: %s): ", rel, suggestion)
+	pattern, ok := readUserLine()
+	if !ok || pattern == "" {
+		pattern = rel
+	}
+
+	rule := permission.Rule{Tool: tool, Path: filepath.ToSlash(pattern), Action: permission.Allow}
+	if err := permissionChecker.Remember(scope, rule); err != nil {
+		fmt.Printf("ルールの保存に失敗しました: %v\n", err)
+		return
+	}
+	if scope == permission.ScopeProject {
+		fmt.Printf("このプロジェクトでは以降 %s への %s を自動承認します\n", rule.Path, tool)
+	} else {
+		fmt.Printf("このセッションでは以降 %s への %s を自動承認します\n", rule.Path, tool)
+	}
+}
+
+// authorizeRead は読み取り系ツールのアクセス可否を判定し、必要ならユーザーに確認する
+// pはモデルが指定したパス、resolvedは解決済みのパス。許可されない場合はエラーメッセージを返し、
+// ルールでの拒否やユーザーの拒否であればdeniedをtrueにする
+func authorizeRead(tool, p, resolved string) (message string, denied bool) {
+	decision := checkPermission(tool, resolved)
+	switch decision.Action {
+	case permission.Deny:
+		return deniedMessage(tool, p, decision), true
+	case permission.Ask:
+		promptMu.Lock()
+		defer promptMu.Unlock()
+
+		fmt.Printf("\n%s が %s へのアクセスを求めています\n", tool, p)
+		approval, err := askApproval(approvalOptions{})
+		if err != nil {
+			return err.Error(), false
+		}
+		if !approval.Approved {
+			if approval.Feedback != "" {
+				return fmt.Sprintf("ユーザーによってキャンセルされました: %s", approval.Feedback), true
+			}
+			return "ユーザーによってキャンセルされました", true
+		}
+	}
+	return "", false
+}
+
+// confirmChange は書き込み系ツールの変更内容を表示し、ルールに従って承認を判定する
+// pには変更するファイルの解決済みのパスを渡す
+func confirmChange(tool, p string, decision permission.Decision, preview string, allowHunks bool) (ApprovalDecision, error) {
+	if decision.Action == permission.Allow {
+		fmt.Printf("パーミッションルール（%s: %s）により自動承認しました\n", decision.Scope, decision.Rule)
+		return ApprovalDecision{Approved: true}, nil
+	}
+
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	showPreview(preview)
+
+	// 明示的なaskルールがある場合は「常に許可」を提示しない
+	approval, err := askApproval(approvalOptions{AllowHunks: allowHunks, AllowRemember: decision.Rule == nil})
+	if err != nil {
+		return ApprovalDecision{}, err
+	}
+	if approval.Approved && approval.Remember != "" {
+		rememberApproval(tool, p, approval.Remember)
+	}
+	return approval, nil
+}
@@ -19,6 +19,7 @@ type ReadFileArgs struct {
 type ReadFileResult struct {
 	Content string `json:"content"`
 	Error   string `json:"error,omitempty"`
+	Denied  bool   `json:"denied,omitempty"` // ルールやユーザーによって拒否された場合はtrue
 }
 
 // ReadFile は指定されたパスのファイル内容を読み込む
@@ -28,7 +29,29 @@ func ReadFile(args string) (string, error) {
 		return "", fmt.Errorf("引数の解析に失敗しました: %v", err)
 	}
 
-	file, err := os.Open(readFileArgs.Path)
+	// ワークスペース内のパスに解決
+	path, err := resolvePath(readFileArgs.Path)
+	if err != nil {
+		result := ReadFileResult{
+			Content: "",
+			Error:   err.Error(),
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
+	// パーミッションルールを確認
+	if message, denied := authorizeRead("readFile", readFileArgs.Path, path); message != "" {
+		result := ReadFileResult{
+			Content: "",
+			Error:   message,
+			Denied:  denied,
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
+	file, err := os.Open(path)
 	if err != nil {
 		result := ReadFileResult{
 			Content: "",
@@ -79,6 +102,7 @@ func GetReadFileTool() ToolDefinition {
 				},
 			},
 		},
-		Function: ReadFile,
+		Function:     ReadFile,
+		Capabilities: Capabilities{ReadOnly: true},
 	}
-}
\ No newline at end of file
+}
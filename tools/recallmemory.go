@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"nebula/memory"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// 過去の会話の検索結果の件数
+const (
+	defaultRecallLimit = 10
+	maxRecallLimit     = 30
+)
+
+// HistorySearcher は過去のセッションの会話を検索するインターフェース
+type HistorySearcher interface {
+	SearchHistory(query string, allProjects bool, limit int) ([]*memory.SearchResult, error)
+}
+
+// RecallMemoryArgs はrecallMemoryツールの引数を表す構造体
+type RecallMemoryArgs struct {
+	Query       string `json:"query" description:"過去の会話から探す語句"`
+	Limit       int    `json:"limit" description:"返す結果の最大件数"`
+	AllProjects bool   `json:"all_projects" description:"他のプロジェクトのセッションも検索するか"`
+}
+
+// RecallMemoryResult はrecallMemoryツールの結果を表す構造体
+type RecallMemoryResult struct {
+	Results []*memory.SearchResult `json:"results"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// newRecallMemory はサーチャーを使うrecallMemory関数を作成する
+func newRecallMemory(searcher HistorySearcher) func(args string) (string, error) {
+	return func(args string) (string, error) {
+		var recallArgs RecallMemoryArgs
+		if err := json.Unmarshal([]byte(args), &recallArgs); err != nil {
+			return "", fmt.Errorf("引数の解析に失敗しました: %v", err)
+		}
+
+		recallArgs.Query = strings.TrimSpace(recallArgs.Query)
+		if recallArgs.Query == "" {
+			result := RecallMemoryResult{
+				Results: []*memory.SearchResult{},
+				Error:   "queryは必須です",
+			}
+			resultJSON, _ := json.Marshal(result)
+			return string(resultJSON), nil
+		}
+		if recallArgs.Limit <= 0 {
+			recallArgs.Limit = defaultRecallLimit
+		}
+		recallArgs.Limit = min(recallArgs.Limit, maxRecallLimit)
+
+		found, err := searcher.SearchHistory(recallArgs.Query, recallArgs.AllProjects, recallArgs.Limit)
+		if err != nil {
+			result := RecallMemoryResult{
+				Results: []*memory.SearchResult{},
+				Error:   fmt.Sprintf("検索に失敗しました: %v", err),
+			}
+			resultJSON, _ := json.Marshal(result)
+			return string(resultJSON), nil
+		}
+		if found == nil {
+			found = []*memory.SearchResult{}
+		}
+
+		resultJSON, _ := json.Marshal(RecallMemoryResult{Results: found})
+		return string(resultJSON), nil
+	}
+}
+
+// GetRecallMemoryTool はrecallMemoryツールの定義を返す
+func GetRecallMemoryTool(searcher HistorySearcher) ToolDefinition {
+	return ToolDefinition{
+		Schema: openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "recallMemory",
+				Description: "以前のセッションでのユーザーとの会話やツールの実行結果を全文検索し、一致した箇所の前後をセッション・日時とともに返します。以前に同じ問題をどう解決したか、どんな方針で合意したかを確認したいときに使います。",
+				Parameters: jsonschema.Definition{
+					Type: jsonschema.Object,
+					Properties: map[string]jsonschema.Definition{
+						"query": {
+							Type:        jsonschema.String,
+							Description: "過去の会話から探す語句（スペース区切りの語をすべて含むメッセージを返す）",
+						},
+						"limit": {
+							Type:        jsonschema.Integer,
+							Description: fmt.Sprintf("返す結果の最大件数（デフォルト: %d、最大: %d）", defaultRecallLimit, maxRecallLimit),
+						},
+						"all_projects": {
+							Type:        jsonschema.Boolean,
+							Description: "trueの場合、他のプロジェクトのセッションも検索する（デフォルト: false）",
+						},
+					},
+					Required: []string{"query"},
+				},
+			},
+		},
+		Function:     newRecallMemory(searcher),
+		Capabilities: Capabilities{ReadOnly: true},
+	}
+}
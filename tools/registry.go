@@ -1,5 +1,11 @@
 package tools
 
+import (
+	"sort"
+
+	"github.com/sashabaranov/go-openai"
+)
+
 // GetAvailableTools は利用可能な全てのツールを返す
 func GetAvailableTools() map[string]ToolDefinition {
 	return map[string]ToolDefinition{
@@ -10,3 +16,30 @@ func GetAvailableTools() map[string]ToolDefinition {
 		"editFile":          GetEditFileTool(),
 	}
 }
+
+// ToolNames はツール名を名前順で返す
+func ToolNames(toolsMap map[string]ToolDefinition) []string {
+	names := make([]string, 0, len(toolsMap))
+	for name := range toolsMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ToolSchemas はモデルに送るツールスキーマを名前順で返す
+// planモードでは読み取り専用のツールだけに絞り込み、agentモードではplan専用のツールを除く
+func ToolSchemas(toolsMap map[string]ToolDefinition, planMode bool) []openai.Tool {
+	var schemas []openai.Tool
+	for _, name := range ToolNames(toolsMap) {
+		tool := toolsMap[name]
+		if planMode && !tool.Capabilities.AllowedInPlanMode() {
+			continue
+		}
+		if !planMode && tool.Capabilities.PlanOnly {
+			continue
+		}
+		schemas = append(schemas, tool.Schema)
+	}
+	return schemas
+}
@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// defaultRepoMapTokens はmax_tokensを省略したときのリポジトリマップのトークン数
+const defaultRepoMapTokens = 2000
+
+// RepoMapper はリポジトリマップを作成するインターフェース
+type RepoMapper interface {
+	Render(budget int, focus []string) (string, error)
+}
+
+// RepoMapArgs はrepoMapツールの引数を表す構造体
+type RepoMapArgs struct {
+	Focus     []string `json:"focus" description:"注目するファイル・ディレクトリ・シンボル名"`
+	MaxTokens int      `json:"max_tokens" description:"マップの最大トークン数"`
+}
+
+// RepoMapResult はrepoMapツールの結果を表す構造体
+type RepoMapResult struct {
+	Map   string `json:"map"`
+	Error string `json:"error,omitempty"`
+}
+
+// newRepoMap はマッパーを使うrepoMap関数を作成する
+func newRepoMap(mapper RepoMapper) func(args string) (string, error) {
+	return func(args string) (string, error) {
+		var mapArgs RepoMapArgs
+		if err := json.Unmarshal([]byte(args), &mapArgs); err != nil {
+			return "", fmt.Errorf("引数の解析に失敗しました: %v", err)
+		}
+		if mapArgs.MaxTokens <= 0 {
+			mapArgs.MaxTokens = defaultRepoMapTokens
+		}
+
+		var result RepoMapResult
+		repoMap, err := mapper.Render(mapArgs.MaxTokens, mapArgs.Focus)
+		if err != nil {
+			result.Error = fmt.Sprintf("リポジトリマップの作成に失敗しました: %v", err)
+		} else if repoMap == "" {
+			result.Error = "シンボルを抽出できるソースファイルが見つかりませんでした"
+		} else {
+			result.Map = repoMap
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+}
+
+// GetRepoMapTool はrepoMapツールの定義を返す
+func GetRepoMapTool(mapper RepoMapper) ToolDefinition {
+	return ToolDefinition{
+		Schema: openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "repoMap",
+				Description: "リポジトリ全体のトップレベルのシンボル（関数・型・クラスなど）のシグネチャを、他のファイルから多く参照されている順に返します。大きなリポジトリで関連するファイルを探すときに使います。focusを指定すると、そのファイルやシンボルと関係の深いファイルを優先します。",
+				Parameters: jsonschema.Definition{
+					Type: jsonschema.Object,
+					Properties: map[string]jsonschema.Definition{
+						"focus": {
+							Type:        jsonschema.Array,
+							Description: "注目するファイル・ディレクトリのパスやシンボル名（省略可）",
+							Items:       &jsonschema.Definition{Type: jsonschema.String},
+						},
+						"max_tokens": {
+							Type:        jsonschema.Integer,
+							Description: fmt.Sprintf("マップの最大トークン数（デフォルト: %d）", defaultRepoMapTokens),
+						},
+					},
+				},
+			},
+		},
+		Function:     newRepoMap(mapper),
+		Capabilities: Capabilities{ReadOnly: true},
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"nebula/permission"
+
 	"github.com/sashabaranov/go-openai"
 	"github.com/sashabaranov/go-openai/jsonschema"
 )
@@ -20,8 +22,9 @@ type SearchInDirectoryArgs struct {
 
 // SearchInDirectoryResult はsearchInDirectoryツールの結果を表す構造体
 type SearchInDirectoryResult struct {
-	Files []string `json:"files"`
-	Error string   `json:"error,omitempty"`
+	Files  []string `json:"files"`
+	Error  string   `json:"error,omitempty"`
+	Denied bool     `json:"denied,omitempty"` // ルールやユーザーによって拒否された場合はtrue
 }
 
 // SearchInDirectory は指定されたディレクトリ配下を再帰的に検索し、キーワードを含むファイルを見つける
@@ -31,9 +34,31 @@ func SearchInDirectory(args string) (string, error) {
 		return "", fmt.Errorf("引数の解析に失敗しました: %v", err)
 	}
 
+	// ワークスペース内のパスに解決
+	root, err := resolvePath(searchArgs.Directory)
+	if err != nil {
+		result := SearchInDirectoryResult{
+			Files: []string{},
+			Error: err.Error(),
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
+	// パーミッションルールを確認
+	if message, denied := authorizeRead("searchInDirectory", searchArgs.Directory, root); message != "" {
+		result := SearchInDirectoryResult{
+			Files:  []string{},
+			Error:  message,
+			Denied: denied,
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
 	var matchingFiles []string
 
-	err := filepath.Walk(searchArgs.Directory, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -43,8 +68,19 @@ func SearchInDirectory(args string) (string, error) {
 			return nil
 		}
 
+		// シンボリックリンクでワークスペース外を指すファイルは検索対象から外す
+		resolved, err := resolvePath(path)
+		if err != nil {
+			return nil
+		}
+
+		// ルールで拒否されたファイルは検索対象から外す
+		if checkPermission("searchInDirectory", resolved).Action == permission.Deny {
+			return nil
+		}
+
 		// ファイルの内容を読み込み
-		file, err := os.Open(path)
+		file, err := os.Open(resolved)
 		if err != nil {
 			// ファイルが開けない場合はスキップ
 			return nil
@@ -54,7 +90,12 @@ func SearchInDirectory(args string) (string, error) {
 		scanner := bufio.NewScanner(file)
 		for scanner.Scan() {
 			if strings.Contains(scanner.Text(), searchArgs.Keyword) {
-				matchingFiles = append(matchingFiles, path)
+				// 結果はモデルが指定したパスを基準に返す
+				rel, err := filepath.Rel(root, path)
+				if err != nil {
+					rel = path
+				}
+				matchingFiles = append(matchingFiles, filepath.Join(searchArgs.Directory, rel))
 				break // ファイル内で見つかったら次のファイルへ
 			}
 		}
@@ -103,6 +144,7 @@ func GetSearchInDirectoryTool() ToolDefinition {
 				},
 			},
 		},
-		Function: SearchInDirectory,
+		Function:     SearchInDirectory,
+		Capabilities: Capabilities{ReadOnly: true},
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"nebula/indexer"
+	"nebula/permission"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// セマンティック検索の結果の件数と、結果に含める行数
+const (
+	defaultSemanticSearchLimit = 5
+	maxSemanticSearchLimit     = 20
+	maxSnippetLines            = 40
+)
+
+// SemanticSearcher はコードの意味検索を行うインターフェース
+type SemanticSearcher interface {
+	Search(ctx context.Context, query string, limit int) ([]indexer.Result, error)
+}
+
+// SemanticSearchArgs はsemanticSearchツールの引数を表す構造体
+type SemanticSearchArgs struct {
+	Query string `json:"query" description:"探しているコードを説明する自然言語の質問"`
+	Limit int    `json:"limit" description:"返す結果の最大件数"`
+}
+
+// SemanticSearchResult はsemanticSearchツールの結果を表す構造体
+type SemanticSearchResult struct {
+	Results []indexer.Result `json:"results"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// newSemanticSearch はサーチャーを使うsemanticSearch関数を作成する
+func newSemanticSearch(searcher SemanticSearcher) func(args string) (string, error) {
+	return func(args string) (string, error) {
+		var searchArgs SemanticSearchArgs
+		if err := json.Unmarshal([]byte(args), &searchArgs); err != nil {
+			return "", fmt.Errorf("引数の解析に失敗しました: %v", err)
+		}
+
+		searchArgs.Query = strings.TrimSpace(searchArgs.Query)
+		if searchArgs.Query == "" {
+			result := SemanticSearchResult{
+				Results: []indexer.Result{},
+				Error:   "queryは必須です",
+			}
+			resultJSON, _ := json.Marshal(result)
+			return string(resultJSON), nil
+		}
+		if searchArgs.Limit <= 0 {
+			searchArgs.Limit = defaultSemanticSearchLimit
+		}
+		searchArgs.Limit = min(searchArgs.Limit, maxSemanticSearchLimit)
+
+		// 拒否されたファイルを除いても件数が足りるように多めに検索する
+		found, err := searcher.Search(context.Background(), searchArgs.Query, searchArgs.Limit*2)
+		if err != nil {
+			result := SemanticSearchResult{
+				Results: []indexer.Result{},
+				Error:   fmt.Sprintf("検索に失敗しました: %v", err),
+			}
+			resultJSON, _ := json.Marshal(result)
+			return string(resultJSON), nil
+		}
+
+		results := []indexer.Result{}
+		for _, r := range found {
+			if len(results) >= searchArgs.Limit {
+				break
+			}
+			// ルールで拒否されたファイルは結果から外す
+			resolved, err := resolvePath(r.Path)
+			if err != nil || checkPermission("semanticSearch", resolved).Action == permission.Deny {
+				continue
+			}
+			r.Content = truncateLines(r.Content, maxSnippetLines)
+			results = append(results, r)
+		}
+
+		resultJSON, _ := json.Marshal(SemanticSearchResult{Results: results})
+		return string(resultJSON), nil
+	}
+}
+
+// truncateLines は長い内容を先頭の指定行数に切り詰める
+func truncateLines(content string, limit int) string {
+	lines := strings.Split(content, "\n")
+	if len(lines) <= limit {
+		return content
+	}
+	return strings.Join(lines[:limit], "\n") + fmt.Sprintf("\n...（残り%d行）", len(lines)-limit)
+}
+
+// GetSemanticSearchTool はsemanticSearchツールの定義を返す
+// 埋め込みにリモートのAPIを使う場合は、質問がそのエンドポイントに送られるためusesNetworkをtrueにする
+func GetSemanticSearchTool(searcher SemanticSearcher, usesNetwork bool) ToolDefinition {
+	return ToolDefinition{
+		Schema: openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "semanticSearch",
+				Description: "「todoのタイトルをどこで検証しているか」のような自然言語の質問に意味の近いコードを、関数やブロック単位で類似度の高い順に返します。キーワードが分からないときに使い、見つかったファイルは変更前にreadFileで読んでください。",
+				Parameters: jsonschema.Definition{
+					Type: jsonschema.Object,
+					Properties: map[string]jsonschema.Definition{
+						"query": {
+							Type:        jsonschema.String,
+							Description: "探しているコードを説明する自然言語の質問",
+						},
+						"limit": {
+							Type:        jsonschema.Integer,
+							Description: fmt.Sprintf("返す結果の最大件数（デフォルト: %d、最大: %d）", defaultSemanticSearchLimit, maxSemanticSearchLimit),
+						},
+					},
+					Required: []string{"query"},
+				},
+			},
+		},
+		Function:     newSemanticSearch(searcher),
+		Capabilities: Capabilities{ReadOnly: true, UsesNetwork: usesNetwork},
+	}
+}
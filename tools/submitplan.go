@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// SubmitPlanArgs はsubmitPlanツールの引数を表す構造体
+type SubmitPlanArgs struct {
+	Goal  string   `json:"goal" description:"計画の目的"`
+	Steps []string `json:"steps" description:"実行する手順"`
+	Files []string `json:"files" description:"変更・作成する予定のファイル"`
+	Risks []string `json:"risks" description:"想定されるリスクや注意点"`
+}
+
+// SubmitPlanResult はsubmitPlanツールの結果を表す構造体
+type SubmitPlanResult struct {
+	Status   string `json:"status"` // approved, rejected
+	PlanID   int    `json:"plan_id,omitempty"`
+	Feedback string `json:"feedback,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// PlanHandler は提出された計画をユーザーに提示し、その判断結果を返す関数
+type PlanHandler func(args SubmitPlanArgs) (SubmitPlanResult, error)
+
+// newSubmitPlan はハンドラーを使うsubmitPlan関数を作成する
+func newSubmitPlan(handler PlanHandler) func(args string) (string, error) {
+	return func(args string) (string, error) {
+		var planArgs SubmitPlanArgs
+		if err := json.Unmarshal([]byte(args), &planArgs); err != nil {
+			return "", fmt.Errorf("引数の解析に失敗しました: %v", err)
+		}
+
+		// 必須項目をチェック
+		planArgs.Goal = strings.TrimSpace(planArgs.Goal)
+		if planArgs.Goal == "" || len(planArgs.Steps) == 0 {
+			result := SubmitPlanResult{
+				Status: "rejected",
+				Error:  "goalとstepsは必須です",
+			}
+			resultJSON, _ := json.Marshal(result)
+			return string(resultJSON), nil
+		}
+
+		result, err := handler(planArgs)
+		if err != nil {
+			result = SubmitPlanResult{
+				Status: "rejected",
+				Error:  fmt.Sprintf("計画の保存に失敗しました: %v", err),
+			}
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+}
+
+// GetSubmitPlanTool はsubmitPlanツールの定義を返す
+func GetSubmitPlanTool(handler PlanHandler) ToolDefinition {
+	return ToolDefinition{
+		Schema: openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "submitPlan",
+				Description: "調査が終わったら、実装計画を構造化してユーザーに提出します。ユーザーが承認した計画はagentモードで1ステップずつ実行されます。却下された場合はfeedbackを踏まえて計画を修正し、再提出してください。",
+				Parameters: jsonschema.Definition{
+					Type: jsonschema.Object,
+					Properties: map[string]jsonschema.Definition{
+						"goal": {
+							Type:        jsonschema.String,
+							Description: "計画の目的（何を達成するか）",
+						},
+						"steps": {
+							Type:        jsonschema.Array,
+							Description: "順番に実行する手順。各手順は単独で実行できる具体的な作業にする",
+							Items:       &jsonschema.Definition{Type: jsonschema.String},
+						},
+						"files": {
+							Type:        jsonschema.Array,
+							Description: "変更・作成する予定のファイルのパス",
+							Items:       &jsonschema.Definition{Type: jsonschema.String},
+						},
+						"risks": {
+							Type:        jsonschema.Array,
+							Description: "想定されるリスクや注意点",
+							Items:       &jsonschema.Definition{Type: jsonschema.String},
+						},
+					},
+					Required: []string{"goal", "steps", "files", "risks"},
+				},
+			},
+		},
+		Function:     newSubmitPlan(handler),
+		Capabilities: Capabilities{ReadOnly: true, NeedsApproval: true, PlanOnly: true},
+	}
+}
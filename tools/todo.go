@@ -0,0 +1,201 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"nebula/memory"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// TodoStore はセッションのtodoリストの保存先を表すインターフェース
+type TodoStore interface {
+	GetTodos() ([]memory.TodoItem, error)
+	SaveTodos(items []memory.TodoItem) error
+}
+
+// TodoWriteArgs はtodoWriteツールの引数を表す構造体
+type TodoWriteArgs struct {
+	Todos []memory.TodoItem `json:"todos" description:"更新後のtodoリスト全体"`
+}
+
+// TodoResult はtodoWrite/todoReadツールの結果を表す構造体
+type TodoResult struct {
+	Todos []memory.TodoItem `json:"todos"`
+	Error string            `json:"error,omitempty"`
+}
+
+// FormatTodos はtodoリストを表示用の文字列に整形する
+func FormatTodos(items []memory.TodoItem) string {
+	if len(items) == 0 {
+		return "（todoはありません）\n"
+	}
+
+	var sb strings.Builder
+	done := 0
+	for _, item := range items {
+		mark := "[ ]"
+		switch item.Status {
+		case memory.TodoStatusDone:
+			mark = "[x]"
+			done++
+		case memory.TodoStatusInProgress:
+			mark = "[>]"
+		}
+		fmt.Fprintf(&sb, "  %s %s\n", mark, item.Content)
+	}
+	fmt.Fprintf(&sb, "  (%d/%d 完了)\n", done, len(items))
+	return sb.String()
+}
+
+// newTodoWrite はストアを使うtodoWrite関数を作成する
+func newTodoWrite(store TodoStore) func(args string) (string, error) {
+	return func(args string) (string, error) {
+		var todoArgs TodoWriteArgs
+		if err := json.Unmarshal([]byte(args), &todoArgs); err != nil {
+			return "", fmt.Errorf("引数の解析に失敗しました: %v", err)
+		}
+
+		// 内容と状態をチェック
+		inProgress := 0
+		for i, item := range todoArgs.Todos {
+			todoArgs.Todos[i].Content = strings.TrimSpace(item.Content)
+			if todoArgs.Todos[i].Content == "" {
+				result := TodoResult{
+					Todos: []memory.TodoItem{},
+					Error: fmt.Sprintf("%d番目のtodoの内容が空です", i+1),
+				}
+				resultJSON, _ := json.Marshal(result)
+				return string(resultJSON), nil
+			}
+			switch item.Status {
+			case memory.TodoStatusPending, memory.TodoStatusDone:
+			case memory.TodoStatusInProgress:
+				inProgress++
+			default:
+				result := TodoResult{
+					Todos: []memory.TodoItem{},
+					Error: fmt.Sprintf("不正な状態です: %q（pending, in_progress, doneのいずれか）", item.Status),
+				}
+				resultJSON, _ := json.Marshal(result)
+				return string(resultJSON), nil
+			}
+		}
+		if inProgress > 1 {
+			result := TodoResult{
+				Todos: []memory.TodoItem{},
+				Error: "in_progressにできるtodoは同時に1つだけです",
+			}
+			resultJSON, _ := json.Marshal(result)
+			return string(resultJSON), nil
+		}
+
+		if err := store.SaveTodos(todoArgs.Todos); err != nil {
+			result := TodoResult{
+				Todos: []memory.TodoItem{},
+				Error: fmt.Sprintf("todoリストの保存に失敗しました: %v", err),
+			}
+			resultJSON, _ := json.Marshal(result)
+			return string(resultJSON), nil
+		}
+
+		// 更新後のリストを表示
+		fmt.Println("\nTodo:")
+		fmt.Print(FormatTodos(todoArgs.Todos))
+
+		result := TodoResult{
+			Todos: todoArgs.Todos,
+			Error: "",
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+}
+
+// newTodoRead はストアを使うtodoRead関数を作成する
+func newTodoRead(store TodoStore) func(args string) (string, error) {
+	return func(args string) (string, error) {
+		items, err := store.GetTodos()
+		if err != nil {
+			result := TodoResult{
+				Todos: []memory.TodoItem{},
+				Error: fmt.Sprintf("todoリストの読み込みに失敗しました: %v", err),
+			}
+			resultJSON, _ := json.Marshal(result)
+			return string(resultJSON), nil
+		}
+		if items == nil {
+			items = []memory.TodoItem{}
+		}
+
+		result := TodoResult{
+			Todos: items,
+			Error: "",
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+}
+
+// GetTodoWriteTool はtodoWriteツールの定義を返す
+func GetTodoWriteTool(store TodoStore) ToolDefinition {
+	return ToolDefinition{
+		Schema: openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "todoWrite",
+				Description: "セッションのtodoリスト全体を置き換えます。複数ファイルにまたがる作業では、最初に作業を分解して登録し、着手時にin_progress、完了時にdoneへ更新してください。in_progressは同時に1つだけにします。",
+				Parameters: jsonschema.Definition{
+					Type: jsonschema.Object,
+					Properties: map[string]jsonschema.Definition{
+						"todos": {
+							Type:        jsonschema.Array,
+							Description: "更新後のtodoリスト全体（既存の項目も含める）",
+							Items: &jsonschema.Definition{
+								Type: jsonschema.Object,
+								Properties: map[string]jsonschema.Definition{
+									"content": {
+										Type:        jsonschema.String,
+										Description: "作業内容",
+									},
+									"status": {
+										Type:        jsonschema.String,
+										Description: "作業の状態",
+										Enum:        []string{memory.TodoStatusPending, memory.TodoStatusInProgress, memory.TodoStatusDone},
+									},
+								},
+								Required: []string{"content", "status"},
+							},
+						},
+					},
+					Required: []string{"todos"},
+				},
+			},
+		},
+		Function: newTodoWrite(store),
+		// ワークスペースは変更しないがセッションのtodoリストを書き換えるため、他のツールと並列には実行しない
+		Capabilities: Capabilities{ReadOnly: true, Sequential: true},
+	}
+}
+
+// GetTodoReadTool はtodoReadツールの定義を返す
+func GetTodoReadTool(store TodoStore) ToolDefinition {
+	return ToolDefinition{
+		Schema: openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "todoRead",
+				Description: "セッションのtodoリストを返します。作業を再開するときや、次に何をするか確認するときに使います。",
+				Parameters: jsonschema.Definition{
+					Type:       jsonschema.Object,
+					Properties: map[string]jsonschema.Definition{},
+				},
+			},
+		},
+		Function:     newTodoRead(store),
+		Capabilities: Capabilities{ReadOnly: true},
+	}
+}
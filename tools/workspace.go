@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Workspace はファイルツールがアクセスできるディレクトリを表す構造体
+type Workspace struct {
+	Root    string   // ワークスペースのルート（シンボリックリンク解決済みの絶対パス）
+	Allowed []string // ルート以外に許可されたディレクトリ（解決済みの絶対パス）
+}
+
+// workspace は現在のワークスペース（nilの場合は制限なし）
+var workspace *Workspace
+
+// SetWorkspace はファイルツールのワークスペースを設定する
+// allowedDirsの相対パスはrootを基準に解決する
+func SetWorkspace(root string, allowedDirs []string) error {
+	resolvedRoot, err := resolveDir(root)
+	if err != nil {
+		return fmt.Errorf("ワークスペースのルートを解決できません: %w", err)
+	}
+
+	ws := &Workspace{Root: resolvedRoot}
+	for _, dir := range allowedDirs {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(resolvedRoot, dir)
+		}
+		resolved, err := resolveDir(dir)
+		if err != nil {
+			return fmt.Errorf("許可ディレクトリ %s を解決できません: %w", dir, err)
+		}
+		ws.Allowed = append(ws.Allowed, resolved)
+	}
+
+	workspace = ws
+	return nil
+}
+
+// GetWorkspace は現在のワークスペースを返す
+func GetWorkspace() *Workspace {
+	return workspace
+}
+
+// resolveDir はディレクトリを絶対パスにしてシンボリックリンクを解決する
+func resolveDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s はディレクトリではありません", resolved)
+	}
+	return resolved, nil
+}
+
+// contains はパスがワークスペースのルートまたは許可ディレクトリの中にあるかを返す
+func (w *Workspace) contains(p string) bool {
+	for _, dir := range append([]string{w.Root}, w.Allowed...) {
+		if isWithin(dir, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin はpがdir自身またはその配下かどうかを返す
+func isWithin(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// evalSymlinksPartial は存在する部分までシンボリックリンクを解決し、残りを連結する
+// （これから作成するファイルのパスにも使えるようにするため）
+func evalSymlinksPartial(p string) (string, error) {
+	var rest []string
+	current := p
+	for {
+		if _, err := os.Lstat(current); err == nil {
+			resolved, err := filepath.EvalSymlinks(current)
+			if err != nil {
+				return "", fmt.Errorf("シンボリックリンクを解決できません: %s", current)
+			}
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return p, nil
+		}
+		rest = append([]string{filepath.Base(current)}, rest...)
+		current = parent
+	}
+}
+
+// resolvePath はワークスペースを基準にパスを解決する
+// シンボリックリンクを解決した結果がワークスペースの外を指す場合はエラーを返す
+func resolvePath(p string) (string, error) {
+	if workspace == nil {
+		return p, nil
+	}
+
+	target := p
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(workspace.Root, target)
+	}
+
+	resolved, err := evalSymlinksPartial(filepath.Clean(target))
+	if err != nil {
+		return "", err
+	}
+
+	if !workspace.contains(resolved) {
+		return "", fmt.Errorf("パス %s はワークスペース（%s）の外を指しているためアクセスできません。必要な場合は設定のallowed_dirsにディレクトリを追加してください", p, workspace.Root)
+	}
+
+	return resolved, nil
+}
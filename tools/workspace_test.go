@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupSymlinkWorkspace creates a project next to a sibling whose name shares
+// its prefix, a shared directory allowed by the config and symlinks pointing
+// inside and outside the project
+func setupSymlinkWorkspace(t *testing.T) (base, root string) {
+	t.Helper()
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = filepath.Join(base, "proj")
+	for _, dir := range []string{"proj/sub", "proj-evil", "outside", "shared"} {
+		if err := os.MkdirAll(filepath.Join(base, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"proj/main.go", "proj/sub/util.go", "proj-evil/secret.txt", "outside/secret.txt", "shared/notes.txt"} {
+		if err := os.WriteFile(filepath.Join(base, file), []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlinks := map[string]string{
+		"proj/link-in":       filepath.Join(root, "sub"),
+		"proj/link-out":      filepath.Join(base, "outside"),
+		"proj/link-file-out": filepath.Join(base, "outside", "secret.txt"),
+		"proj/link-relative": "../outside",
+	}
+	for link, target := range symlinks {
+		if err := os.Symlink(target, filepath.Join(base, link)); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+
+	if err := SetWorkspace(root, []string{"../shared"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { workspace = nil })
+	return base, root
+}
+
+func TestResolvePath(t *testing.T) {
+	base, root := setupSymlinkWorkspace(t)
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "relative file", path: "main.go", want: filepath.Join(root, "main.go")},
+		{name: "absolute file", path: filepath.Join(root, "sub", "util.go"), want: filepath.Join(root, "sub", "util.go")},
+		{name: "root itself", path: ".", want: root},
+		{name: "dot-dot staying inside", path: "sub/../main.go", want: filepath.Join(root, "main.go")},
+		{name: "new file in new directories", path: "new/dir/file.go", want: filepath.Join(root, "new", "dir", "file.go")},
+		{name: "symlink inside the root", path: "link-in/util.go", want: filepath.Join(root, "sub", "util.go")},
+		{name: "allowed directory", path: "../shared/notes.txt", want: filepath.Join(base, "shared", "notes.txt")},
+		{name: "dot-dot escape", path: "../outside/secret.txt", wantErr: true},
+		{name: "deep dot-dot escape", path: "sub/../../outside/secret.txt", wantErr: true},
+		{name: "parent of the root", path: "..", wantErr: true},
+		{name: "sibling sharing the prefix", path: "../proj-evil/secret.txt", wantErr: true},
+		{name: "absolute sibling sharing the prefix", path: filepath.Join(base, "proj-evil", "secret.txt"), wantErr: true},
+		{name: "absolute path outside", path: filepath.Join(base, "outside", "secret.txt"), wantErr: true},
+		{name: "symlinked directory outside", path: "link-out/secret.txt", wantErr: true},
+		{name: "symlinked file outside", path: "link-file-out", wantErr: true},
+		{name: "relative symlink outside", path: "link-relative/secret.txt", wantErr: true},
+		{name: "new file under a symlink outside", path: "link-out/new.txt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolvePath(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("resolvePath(%q) = %q, want an error", tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolvePath(%q) failed: %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("resolvePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalSymlinksPartial(t *testing.T) {
+	base, root := setupSymlinkWorkspace(t)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"existing file", filepath.Join(root, "main.go"), filepath.Join(root, "main.go")},
+		{"symlinked directory", filepath.Join(root, "link-in", "util.go"), filepath.Join(root, "sub", "util.go")},
+		{"missing tail after a symlink", filepath.Join(root, "link-out", "a", "b.txt"), filepath.Join(base, "outside", "a", "b.txt")},
+		{"relative symlink", filepath.Join(root, "link-relative", "secret.txt"), filepath.Join(base, "outside", "secret.txt")},
+		{"missing path", filepath.Join(root, "missing", "file.go"), filepath.Join(root, "missing", "file.go")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evalSymlinksPartial(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("evalSymlinksPartial(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	dir := filepath.FromSlash("/work/proj")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/work/proj", true},
+		{"/work/proj/main.go", true},
+		{"/work/proj/..data/file", true},
+		{"/work/proj-evil/secret.txt", false},
+		{"/work/projects", false},
+		{"/work", false},
+		{"/work/proj/../other", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isWithin(dir, filepath.FromSlash(tt.path)); got != tt.want {
+				t.Errorf("isWithin(%q, %q) = %v, want %v", dir, tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,12 @@
 package tools
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+
+	"nebula/permission"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/sashabaranov/go-openai/jsonschema"
@@ -20,8 +20,10 @@ type WriteFileArgs struct {
 
 // WriteFileResult はwriteFileツールの結果を表す構造体
 type WriteFileResult struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error,omitempty"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+	Denied   bool   `json:"denied,omitempty"`   // ルールやユーザーによって拒否された場合はtrue
+	Feedback string `json:"feedback,omitempty"` // 拒否時のユーザーからのフィードバック
 }
 
 // WriteFile は指定されたパスに新しいファイルを作成する（ユーザー許可が必要）
@@ -31,8 +33,31 @@ func WriteFile(args string) (string, error) {
 		return "", fmt.Errorf("引数の解析に失敗しました: %v", err)
 	}
 
+	// ワークスペース内のパスに解決
+	path, err := resolvePath(writeArgs.Path)
+	if err != nil {
+		result := WriteFileResult{
+			Success: false,
+			Error:   err.Error(),
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
+	// パーミッションルールを確認
+	permissionDecision := checkPermission("writeFile", path)
+	if permissionDecision.Action == permission.Deny {
+		result := WriteFileResult{
+			Success: false,
+			Error:   deniedMessage("writeFile", writeArgs.Path, permissionDecision),
+			Denied:  true,
+		}
+		resultJSON, _ := json.Marshal(result)
+		return string(resultJSON), nil
+	}
+
 	// ファイルが既に存在するかチェック
-	if _, err := os.Stat(writeArgs.Path); err == nil {
+	if _, err := os.Stat(path); err == nil {
 		result := WriteFileResult{
 			Success: false,
 			Error:   "ファイルが既に存在します。既存ファイルの編集にはeditFileを使用してください。",
@@ -41,32 +66,34 @@ func WriteFile(args string) (string, error) {
 		return string(resultJSON), nil
 	}
 
+	// 制御文字をクリーンアップ
+	writeArgs.Content = CleanControlCharacters(writeArgs.Content)
+
 	// ユーザーに許可を求める
 	fmt.Printf("\n新しいファイルを作成します: %s\n", writeArgs.Path)
-	fmt.Print("実行してもよろしいですか？ (y/N): ")
-
-	scanner := bufio.NewScanner(os.Stdin)
-	if !scanner.Scan() {
+	decision, err := confirmChange("writeFile", path, permissionDecision, previewNewFile(writeArgs.Path, writeArgs.Content), false)
+	if err != nil {
 		result := WriteFileResult{
 			Success: false,
-			Error:   "ユーザー入力の読み取りに失敗しました",
+			Error:   err.Error(),
 		}
 		resultJSON, _ := json.Marshal(result)
 		return string(resultJSON), nil
 	}
 
-	userResponse := strings.TrimSpace(scanner.Text())
-	if userResponse != "y" && userResponse != "Y" {
+	if !decision.Approved {
 		result := WriteFileResult{
-			Success: false,
-			Error:   "ユーザーによってキャンセルされました",
+			Success:  false,
+			Error:    "ユーザーによってキャンセルされました",
+			Denied:   true,
+			Feedback: decision.Feedback,
 		}
 		resultJSON, _ := json.Marshal(result)
 		return string(resultJSON), nil
 	}
 
 	// 親ディレクトリを作成
-	dir := filepath.Dir(writeArgs.Path)
+	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		result := WriteFileResult{
 			Success: false,
@@ -77,7 +104,7 @@ func WriteFile(args string) (string, error) {
 	}
 
 	// ファイルを作成
-	file, err := os.Create(writeArgs.Path)
+	file, err := os.Create(path)
 	if err != nil {
 		result := WriteFileResult{
 			Success: false,
@@ -88,9 +115,6 @@ func WriteFile(args string) (string, error) {
 	}
 	defer file.Close()
 
-	// 制御文字をクリーンアップ
-	writeArgs.Content = CleanControlCharacters(writeArgs.Content)
-
 	// 内容を書き込み
 	if _, err := file.WriteString(writeArgs.Content); err != nil {
 		result := WriteFileResult{
@@ -116,7 +140,7 @@ func GetWriteFileTool() ToolDefinition {
 			Type: openai.ToolTypeFunction,
 			Function: &openai.FunctionDefinition{
 				Name:        "writeFile",
-				Description: "指定されたパスに新しいファイルを作成し、内容を書き込みます。親ディレクトリが存在しない場合は自動で作成します。既存ファイルが存在する場合は失敗します。実行前にユーザーの許可を求めます。",
+				Description: "指定されたパスに新しいファイルを作成し、内容を書き込みます。親ディレクトリが存在しない場合は自動で作成します。既存ファイルが存在する場合は失敗します。実行前に内容のプレビューを表示してユーザーの許可を求めます。拒否された場合、結果のfeedbackにユーザーからの指示が含まれることがあります。",
 				Parameters: jsonschema.Definition{
 					Type: jsonschema.Object,
 					Properties: map[string]jsonschema.Definition{
@@ -133,6 +157,7 @@ func GetWriteFileTool() ToolDefinition {
 				},
 			},
 		},
-		Function: WriteFile,
+		Function:     WriteFile,
+		Capabilities: Capabilities{WritesFiles: true, NeedsApproval: true},
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"nebula/memory"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Transcript export formats
+const (
+	transcriptMarkdown = "md"
+	transcriptJSON     = "json"
+	transcriptHTML     = "html"
+)
+
+// transcript はエクスポートしたセッションを書き出し用に整理したもの
+type transcript struct {
+	Session memory.Session
+	Title   string
+	Models  []string
+	Total   *memory.Usage // セッション全体のトークン使用量と料金
+	Entries []transcriptEntry
+}
+
+// transcriptEntry は書き出す1つのメッセージ
+type transcriptEntry struct {
+	ID         int
+	Role       string
+	Timestamp  time.Time
+	Model      string
+	Content    string
+	ToolCalls  []transcriptToolCall // アシスタントが呼び出したツール
+	ToolName   string               // roleがtoolの場合の実行したツールと引数、結果
+	ToolArgs   string
+	ToolResult string
+	Usage      *memory.Usage // この応答を生成したAPI呼び出しのトークン使用量
+}
+
+// transcriptToolCall はアシスタントのツール呼び出し
+type transcriptToolCall struct {
+	Name      string
+	Arguments string
+}
+
+// newTranscript はエクスポートしたセッションのメッセージにツール呼び出しとトークン使用量を対応付ける
+func newTranscript(export *memory.SessionExport) *transcript {
+	t := &transcript{Session: export.Session, Title: export.Session.Title, Total: &memory.Usage{}}
+	if t.Title == "" {
+		t.Title = "Session " + export.Session.ID
+	}
+
+	usageByMessage := make(map[int]*memory.Usage)
+	seenModels := make(map[string]bool)
+	for _, usage := range export.Usage {
+		if usage.MessageID != nil {
+			usageByMessage[*usage.MessageID] = usage
+		}
+		if !seenModels[usage.Model] {
+			seenModels[usage.Model] = true
+			t.Models = append(t.Models, usage.Model)
+		}
+		t.Total.PromptTokens += usage.PromptTokens
+		t.Total.CachedTokens += usage.CachedTokens
+		t.Total.CompletionTokens += usage.CompletionTokens
+		t.Total.ReasoningTokens += usage.ReasoningTokens
+		t.Total.Cost += usage.Cost
+	}
+
+	for _, msg := range export.Messages {
+		entry := transcriptEntry{
+			ID:        msg.ID,
+			Role:      msg.Role,
+			Timestamp: msg.Timestamp,
+			Model:     msg.Model,
+			Content:   msg.Content,
+			Usage:     usageByMessage[msg.ID],
+		}
+		if msg.ToolCalls != nil {
+			var toolCalls []openai.ToolCall
+			if err := json.Unmarshal([]byte(*msg.ToolCalls), &toolCalls); err == nil {
+				for _, toolCall := range toolCalls {
+					entry.ToolCalls = append(entry.ToolCalls, transcriptToolCall{
+						Name:      toolCall.Function.Name,
+						Arguments: indentJSON(toolCall.Function.Arguments),
+					})
+				}
+			}
+		}
+		// ツールの結果は「ツール名 引数」を本文、結果をtool_resultsとして保存している
+		if msg.Role == "tool" {
+			name, args, _ := strings.Cut(msg.Content, " ")
+			entry.Content = ""
+			entry.ToolName = name
+			entry.ToolArgs = indentJSON(args)
+			if msg.ToolResults != nil {
+				entry.ToolResult = indentJSON(*msg.ToolResults)
+			}
+		}
+		t.Entries = append(t.Entries, entry)
+	}
+	return t
+}
+
+// indentJSON はJSONを読みやすく整形する（JSONでない場合はそのまま返す）
+func indentJSON(text string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(text), "", "  "); err != nil {
+		return text
+	}
+	return buf.String()
+}
+
+// writeTranscript はセッションを指定した形式で書き出す
+func writeTranscript(w io.Writer, export *memory.SessionExport, format string) error {
+	switch format {
+	case transcriptJSON:
+		data, err := json.MarshalIndent(export, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case transcriptMarkdown:
+		_, err := io.WriteString(w, renderTranscriptMarkdown(newTranscript(export)))
+		return err
+	case transcriptHTML:
+		return transcriptHTMLTemplate.Execute(w, newTranscript(export))
+	default:
+		return fmt.Errorf("unknown format %q (use md, json or html)", format)
+	}
+}
+
+// renderTranscriptMarkdown はセッションをMarkdownで書き出す
+func renderTranscriptMarkdown(t *transcript) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", t.Title)
+	fmt.Fprintf(&sb, "- Session: `%s`\n", t.Session.ID)
+	fmt.Fprintf(&sb, "- Project: `%s`\n", t.Session.ProjectPath)
+	fmt.Fprintf(&sb, "- Started: %s\n", formatTranscriptTime(t.Session.StartedAt))
+	if t.Session.EndedAt != nil {
+		fmt.Fprintf(&sb, "- Ended: %s\n", formatTranscriptTime(*t.Session.EndedAt))
+	}
+	if len(t.Models) > 0 {
+		fmt.Fprintf(&sb, "- Models: %s\n", strings.Join(t.Models, ", "))
+	}
+	fmt.Fprintf(&sb, "- Tokens: %s\n", formatTranscriptUsage(t.Total))
+	if t.Session.Summary != "" {
+		fmt.Fprintf(&sb, "\n> %s\n", t.Session.Summary)
+	}
+
+	for _, entry := range t.Entries {
+		switch entry.Role {
+		case "tool":
+			fmt.Fprintf(&sb, "\n### Tool result: %s (#%d, %s)\n\n", entry.ToolName, entry.ID, formatTranscriptTime(entry.Timestamp))
+			if entry.ToolArgs != "" {
+				sb.WriteString(markdownFence(entry.ToolArgs, "json"))
+			}
+			sb.WriteString(markdownFence(entry.ToolResult, ""))
+		default:
+			heading := entry.Role
+			if heading != "" {
+				heading = strings.ToUpper(heading[:1]) + heading[1:]
+			}
+			if entry.Model != "" {
+				heading += " (" + entry.Model + ")"
+			}
+			fmt.Fprintf(&sb, "\n## %s (#%d, %s)\n\n", heading, entry.ID, formatTranscriptTime(entry.Timestamp))
+			if entry.Content != "" {
+				sb.WriteString(entry.Content + "\n")
+			}
+			for _, toolCall := range entry.ToolCalls {
+				fmt.Fprintf(&sb, "\n**Tool call:** `%s`\n\n", toolCall.Name)
+				sb.WriteString(markdownFence(toolCall.Arguments, "json"))
+			}
+			if entry.Usage != nil {
+				fmt.Fprintf(&sb, "\n_Tokens: %s_\n", formatTranscriptUsage(entry.Usage))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// markdownFence はコードブロックで囲む。内容にバッククォートが続く場合はそれより長いフェンスを使う
+func markdownFence(content, lang string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fence + lang + "\n" + strings.TrimRight(content, "\n") + "\n" + fence + "\n"
+}
+
+// formatTranscriptTime は書き出す時刻を整形する
+func formatTranscriptTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// formatTranscriptUsage はトークン使用量と料金を1行にまとめる
+func formatTranscriptUsage(usage *memory.Usage) string {
+	text := fmt.Sprintf("%d prompt (%d cached), %d completion", usage.PromptTokens, usage.CachedTokens, usage.CompletionTokens)
+	if usage.ReasoningTokens > 0 {
+		text += fmt.Sprintf(" (%d reasoning)", usage.ReasoningTokens)
+	}
+	return text + fmt.Sprintf(", $%.4f", usage.Cost)
+}
+
+// transcriptHTMLTemplate はセッションを1つのHTMLファイルとして書き出すテンプレート
+// ツール呼び出しと結果は<details>で折りたためるようにする
+var transcriptHTMLTemplate = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"time":  formatTranscriptTime,
+	"usage": formatTranscriptUsage,
+	"join":  strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #1f2328; }
+.meta { color: #59636e; }
+.message { border: 1px solid #d1d9e0; border-radius: 6px; margin: 1em 0; padding: 0.5em 1em; }
+.user { background: #f6f8fa; }
+.tool { border-style: dashed; }
+.header { color: #59636e; font-size: 0.9em; }
+.content { white-space: pre-wrap; }
+pre { background: #f6f8fa; padding: 0.5em; overflow-x: auto; white-space: pre-wrap; }
+summary { cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<ul class="meta">
+<li>Session: <code>{{.Session.ID}}</code></li>
+<li>Project: <code>{{.Session.ProjectPath}}</code></li>
+<li>Started: {{time .Session.StartedAt}}</li>
+{{- with .Session.EndedAt}}
+<li>Ended: {{time .}}</li>
+{{- end}}
+{{- if .Models}}
+<li>Models: {{join .Models ", "}}</li>
+{{- end}}
+<li>Tokens: {{usage .Total}}</li>
+</ul>
+{{- with .Session.Summary}}
+<blockquote>{{.}}</blockquote>
+{{- end}}
+{{range .Entries}}
+{{- if eq .Role "tool"}}
+<div class="message tool" id="m{{.ID}}">
+<details>
+<summary>Tool result: <code>{{.ToolName}}</code> <span class="header">#{{.ID}} · {{time .Timestamp}}</span></summary>
+{{- if .ToolArgs}}
+<pre>{{.ToolArgs}}</pre>
+{{- end}}
+<pre>{{.ToolResult}}</pre>
+</details>
+</div>
+{{- else}}
+<div class="message {{.Role}}" id="m{{.ID}}">
+<div class="header"><strong>{{.Role}}</strong>{{with .Model}} ({{.}}){{end}} · #{{.ID}} · {{time .Timestamp}}</div>
+{{- if .Content}}
+<div class="content">{{.Content}}</div>
+{{- end}}
+{{- range .ToolCalls}}
+<details>
+<summary>Tool call: <code>{{.Name}}</code></summary>
+<pre>{{.Arguments}}</pre>
+</details>
+{{- end}}
+{{- with .Usage}}
+<div class="header">Tokens: {{usage .}}</div>
+{{- end}}
+</div>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"nebula/config"
+	"nebula/llm"
+	"nebula/memory"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// saveAssistantResponse はアシスタントの応答をメモリに保存し、そのAPI呼び出しのトークン使用量を記録する
+func saveAssistantResponse(model config.ModelConfig, memoryManager *memory.Manager, resp openai.ChatCompletionResponse) {
+	responseMessage := resp.Choices[0].Message
+
+	// ツール呼び出しはJSONとして保存
+	var toolCalls interface{}
+	if len(responseMessage.ToolCalls) > 0 {
+		if toolCallsJSON, err := json.Marshal(responseMessage.ToolCalls); err == nil {
+			toolCalls = string(toolCallsJSON)
+		}
+	}
+
+	usage := newUsage(model, resp)
+	saved, err := memoryManager.SaveAssistantMessage(model.ModelID, responseMessage.Content, toolCalls)
+	if err != nil {
+		fmt.Printf("Error saving message: %v\n", err)
+	} else if saved != nil {
+		usage.MessageID = &saved.ID
+	}
+
+	if err := memoryManager.RecordUsage(usage); err != nil {
+		fmt.Printf("Error recording usage: %v\n", err)
+	}
+}
+
+// newUsage はAPI呼び出しのトークン使用量と料金を記録用に変換する
+func newUsage(model config.ModelConfig, resp openai.ChatCompletionResponse) *memory.Usage {
+	// レスポンスのモデル名には日付が付くことがあるため、リクエストしたモデルの識別子で記録する
+	usage := &memory.Usage{
+		Model:            model.ModelID,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}
+	if resp.Usage.PromptTokensDetails != nil {
+		usage.CachedTokens = resp.Usage.PromptTokensDetails.CachedTokens
+	}
+	if resp.Usage.CompletionTokensDetails != nil {
+		usage.ReasoningTokens = resp.Usage.CompletionTokensDetails.ReasoningTokens
+	}
+	usage.Cost = model.Cost(usage.PromptTokens, usage.CachedTokens, llm.CacheWriteTokens(resp), usage.CompletionTokens)
+	return usage
+}
+
+// handleCostShow は現在のセッションのトークン使用量と料金を表示する
+func handleCostShow(memoryManager *memory.Manager) {
+	summaries, err := memoryManager.GetSessionUsage()
+	if err != nil {
+		fmt.Printf("Error loading usage: %v\n", err)
+		return
+	}
+	if len(summaries) == 0 {
+		fmt.Println("No API usage recorded in this session yet.")
+		return
+	}
+
+	printUsageTable(summaries, false)
+}
+
+// printUsageTable は集計したトークン使用量を表形式で表示する
+func printUsageTable(summaries []*memory.UsageSummary, withProject bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := "MODEL\tCALLS\tPROMPT\tCACHED\tCOMPLETION\tREASONING\tCOST (USD)\t"
+	if withProject {
+		header = "PROJECT\t" + header
+	}
+	fmt.Fprintln(w, header)
+
+	var total memory.UsageSummary
+	for _, s := range summaries {
+		row := fmt.Sprintf("%s\t%d\t%d\t%d\t%d\t%d\t%.4f\t", s.Model, s.Calls, s.PromptTokens, s.CachedTokens, s.CompletionTokens, s.ReasoningTokens, s.Cost)
+		if withProject {
+			row = s.ProjectPath + "\t" + row
+		}
+		fmt.Fprintln(w, row)
+
+		total.Calls += s.Calls
+		total.PromptTokens += s.PromptTokens
+		total.CachedTokens += s.CachedTokens
+		total.CompletionTokens += s.CompletionTokens
+		total.ReasoningTokens += s.ReasoningTokens
+		total.Cost += s.Cost
+	}
+
+	row := fmt.Sprintf("TOTAL\t%d\t%d\t%d\t%d\t%d\t%.4f\t", total.Calls, total.PromptTokens, total.CachedTokens, total.CompletionTokens, total.ReasoningTokens, total.Cost)
+	if withProject {
+		row = "\t" + row
+	}
+	fmt.Fprintln(w, row)
+	w.Flush()
+}
+
+// runUsageCommand は `nebula usage` を実行し、全プロジェクトのトークン使用量を表示する
+func runUsageCommand(args []string) int {
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	sinceFlag := fs.String("since", "30d", "report usage since this point (e.g. 7d, 12h, 2025-01-31)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	since, err := parseSince(*sinceFlag, time.Now())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return 1
+	}
+	memoryManager, err := memory.NewManager(cfg.DatabasePath)
+	if err != nil {
+		fmt.Printf("Error initializing memory: %v\n", err)
+		return 1
+	}
+	defer memoryManager.Close()
+
+	summaries, err := memoryManager.GetUsageSince(since)
+	if err != nil {
+		fmt.Printf("Error loading usage: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("API usage since %s\n\n", since.Format("2006-01-02 15:04"))
+	if len(summaries) == 0 {
+		fmt.Println("No API usage recorded.")
+		return 0
+	}
+	printUsageTable(summaries, true)
+	return 0
+}
+
+// parseSince は「7d」のような日数、Goの期間表記、または日付を起点の時刻に変換する
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value %q (use e.g. 7d, 12h or 2025-01-31)", value)
+}